@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	expogluster "github.com/aminueza/docker-gluester-exporter/expogluster"
+)
+
+// check evaluates the thresholds on the state of gluster as a Nagios plugin,
+// the exit code is the state of the check
+func check(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	flags.SetOutput(os.Stdout)
+	thresholds := expogluster.Thresholds{}
+	threshold := func(threshold *expogluster.Threshold, name, description string, warning, critical float64) {
+		flags.Float64Var(&threshold.Warning, name+"-warning", warning, "Warning when "+description+" is above, disabled when negative")
+		flags.Float64Var(&threshold.Critical, name+"-critical", critical, "Critical when "+description+" is above, disabled when negative")
+	}
+	threshold(&thresholds.BricksDown, "bricks-down", "the number of bricks down", -1, 0)
+	threshold(&thresholds.HealPending, "heal-pending", "the number of entries pending heal", 0, 1000)
+	threshold(&thresholds.SplitBrain, "split-brain", "the number of entries in split-brain", -1, 0)
+	threshold(&thresholds.QuotaUsage, "quota-usage", "the highest usage of the quota limits in percent", 80, 90)
+	threshold(&thresholds.BrickFill, "brick-fill", "the highest usage of the bricks in percent", 80, 90)
+	threshold(&thresholds.PeersDisconnected, "peers-disconnected", "the number of disconnected peers", -1, 0)
+	collectors := flags.String("collectors", "", "Comma separated collectors to run, all collectors run when empty")
+	if err := flags.Parse(args); err != nil {
+		return expogluster.CheckUnknown
+	}
+
+	exporter := expogluster.NewPromExporter()
+	// the profile isn't checked
+	exporter.Profile = false
+	// the check reads the split-brain entries itself
+	exporter.SplitBrain = false
+	// the benchmark runs in background, the check wouldn't wait for it
+	exporter.Benchmark = nil
+	// the whole cluster is checked on any node, the heal and quota collectors don't wait for an election
+	exporter.ClusterMode = "all"
+	if *collectors != "" {
+		exporter.Collectors = strings.Split(*collectors, ",")
+	}
+
+	result := exporter.Check(thresholds)
+	if err := result.Write(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return expogluster.CheckUnknown
+	}
+	return result.State
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	expogluster "github.com/aminueza/docker-gluester-exporter/expogluster"
+)
+
+func TestCheckExitCode(t *testing.T) {
+	cleanup := fakeGluster(t)
+	defer cleanup()
+	restore := discardStdout(t)
+	defer restore()
+
+	for _, test := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"-collectors", "volume"}, expogluster.CheckOK},
+		// the state is unknown when a collector failed
+		{[]string{"-collectors", "volume,peer"}, expogluster.CheckUnknown},
+		{[]string{"-collectors", "peer"}, expogluster.CheckUnknown},
+		{[]string{"-bricks-down-critical"}, expogluster.CheckUnknown},
+	} {
+		if code := check(test.args); code != test.code {
+			t.Errorf("check %v exited with %d, expected %d", test.args, code, test.code)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	expogluster "github.com/aminueza/docker-gluester-exporter/expogluster"
+)
+
+// collect runs the collectors without the server and prints the state of gluster or the metrics,
+// the exit code is 1 when a collector failed
+func collect(args []string) int {
+	flags := flag.NewFlagSet("collect", flag.ExitOnError)
+	once := flags.Bool("once", false, "Collect once and exit, instead of collecting on every interval")
+	interval := flags.Duration("interval", 30*time.Second, "Time between two collections when not collecting once")
+	format := flags.String("format", expogluster.StateFormatJSON, "Output format: json, yaml or prom")
+	collectors := flags.String("collectors", "", "Comma separated collectors to run, all collectors run when empty")
+	flags.Parse(args)
+
+	if *format != expogluster.StateFormatJSON && *format != expogluster.StateFormatYAML && *format != expogluster.StateFormatProm {
+		fmt.Fprintf(os.Stderr, "Unknown format: %v\n", *format)
+		return 2
+	}
+
+	exporter := expogluster.NewPromExporter()
+	// the benchmark runs in background, the collection wouldn't wait for it
+	exporter.Benchmark = nil
+	if *collectors != "" {
+		exporter.Collectors = strings.Split(*collectors, ",")
+	}
+
+	for {
+		var errors map[string]string
+		var err error
+		if *format == expogluster.StateFormatProm {
+			errors, err = exporter.WriteMetrics(os.Stdout)
+		} else {
+			state := exporter.State()
+			errors, err = state.Errors, expogluster.WriteState(os.Stdout, state, *format)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, collector := range expogluster.FailedCollectors(errors) {
+			fmt.Fprintf(os.Stderr, "collector %v failed: %v\n", collector, errors[collector])
+		}
+
+		if *once {
+			if len(errors) > 0 {
+				return 1
+			}
+			return 0
+		}
+		time.Sleep(*interval)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeGluster puts a gluster command printing the volume info fixture in the PATH, the other commands fail
+func fakeGluster(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "gluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture, err := filepath.Abs(filepath.Join("expogluster", "testdata", "volume_info_single.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := fmt.Sprintf(`#!/bin/sh
+if [ "$1 $2" = "volume info" ]; then
+	cat %q
+	exit 0
+fi
+echo "Connection failed. Please check if gluster daemon is operational."
+exit 1
+`, fixture)
+	if err := ioutil.WriteFile(filepath.Join(dir, "gluster"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"PATH":                     dir + string(os.PathListSeparator) + os.Getenv("PATH"),
+		"PROM_FORECAST_STATE_FILE": filepath.Join(dir, "forecast.json"),
+	}
+	previous := map[string]string{}
+	for key, value := range env {
+		previous[key] = os.Getenv(key)
+		os.Setenv(key, value)
+	}
+	return func() {
+		for key, value := range previous {
+			os.Setenv(key, value)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+// discardStdout drops the output of the commands until the returned function is called
+func discardStdout(t *testing.T) func() {
+	stdout := os.Stdout
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = devNull
+	return func() {
+		os.Stdout = stdout
+		devNull.Close()
+	}
+}
+
+func TestCollectExitCode(t *testing.T) {
+	cleanup := fakeGluster(t)
+	defer cleanup()
+	restore := discardStdout(t)
+	defer restore()
+
+	for _, test := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"-once", "-collectors", "volume"}, 0},
+		{[]string{"-once", "-collectors", "volume", "-format", "yaml"}, 0},
+		{[]string{"-once", "-collectors", "volume", "-format", "prom"}, 0},
+		// the exit code is 1 when a collector failed
+		{[]string{"-once", "-collectors", "volume,peer"}, 1},
+		{[]string{"-once", "-collectors", "volume,peer", "-format", "prom"}, 1},
+		{[]string{"-once", "-format", "xml"}, 2},
+	} {
+		if code := collect(test.args); code != test.code {
+			t.Errorf("collect %v exited with %d, expected %d", test.args, code, test.code)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package expogluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// VolumeHeal is the heal state of a volume returned by the API
+type VolumeHeal struct {
+	Volume           string          `json:"volume"`
+	EntriesOutOfSync int             `json:"entriesOutOfSync"`
+	Bricks           []HealInfoBrick `json:"bricks"`
+}
+
+func writeJSON(w http.ResponseWriter, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	js, err := json.MarshalIndent(payload, "", " ")
+	if err != nil {
+		httpError(err, http.StatusInternalServerError, w)
+		return
+	}
+	w.Write(js)
+}
+
+// findVolume returns the monitored volume of the snapshot with the given name
+func (e *Exporter) findVolume(snapshot *Snapshot, name string) (Volume, bool) {
+	if !e.monitored(name) {
+		return Volume{}, false
+	}
+	for _, volume := range snapshot.VolumeInfo.Volumes() {
+		if volume.Name == name {
+			return volume, true
+		}
+	}
+	return Volume{}, false
+}
+
+func (e *Exporter) volumesHandler(w http.ResponseWriter, r *http.Request) {
+	volumes := []Volume{}
+	for _, volume := range e.Snapshot().VolumeInfo.Volumes() {
+		if e.monitored(volume.Name) {
+			volumes = append(volumes, volume)
+		}
+	}
+	writeJSON(w, volumes)
+}
+
+func (e *Exporter) volumeHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	volume, ok := e.findVolume(e.Snapshot(), name)
+	if !ok {
+		volumeNotFound(name, w)
+		return
+	}
+	writeJSON(w, volume)
+}
+
+func (e *Exporter) volumeBricksHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	snapshot := e.Snapshot()
+	if _, ok := e.findVolume(snapshot, name); !ok {
+		volumeNotFound(name, w)
+		return
+	}
+	writeJSON(w, snapshot.VolumeStatus.Bricks(name))
+}
+
+func (e *Exporter) volumeHealHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	snapshot := e.Snapshot()
+	if _, ok := e.findVolume(snapshot, name); !ok {
+		volumeNotFound(name, w)
+		return
+	}
+
+	healInfo, ok := snapshot.HealInfo[name]
+	if !ok {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		httpError(fmt.Errorf("Heal info of volume %v is not available", name), http.StatusServiceUnavailable, w)
+		return
+	}
+	entries, err := healInfo.EntriesOutOfSync()
+	if err != nil {
+		entries = -1
+	}
+	bricks := healInfo.HealInfo.Bricks.Brick
+	if bricks == nil {
+		bricks = []HealInfoBrick{}
+	}
+	writeJSON(w, VolumeHeal{
+		Volume:           name,
+		EntriesOutOfSync: entries,
+		Bricks:           bricks,
+	})
+}
+
+func (e *Exporter) peersHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, e.Snapshot().PeerStatus.Peers())
+}
+
+func volumeNotFound(name string, w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	httpError(fmt.Errorf("Volume %v not found", name), http.StatusNotFound, w)
+}
@@ -0,0 +1,251 @@
+package expogluster
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	benchmarkThroughput = newDesc(
+		prometheus.BuildFQName(namespace, "", "mount_benchmark_throughput_bytes_per_second"),
+		"Throughput of the last benchmark of the mount, write includes fsync",
+		[]string{"volume", "mountpoint", "op"}, nil)
+
+	benchmarkSuccess = newDesc(
+		prometheus.BuildFQName(namespace, "", "mount_benchmark_success"),
+		"Displays whether or not the last benchmark of the mount succeeded",
+		[]string{"volume", "mountpoint"}, nil)
+
+	benchmarkLastRun = newDesc(
+		prometheus.BuildFQName(namespace, "", "mount_benchmark_last_run_timestamp_seconds"),
+		"Time of the last benchmark of the mount",
+		[]string{"volume", "mountpoint"}, nil)
+)
+
+// Benchmark runs a synthetic I/O probe on the mounts: a payload is written, fsynced, read and deleted,
+// then a burst of small files is created, stated and unlinked
+type Benchmark struct {
+	// Size of the payload in bytes
+	Size int
+	// Files is the number of files of the small files burst
+	Files int
+	// Interval is the minimum time between two benchmarks of a mount, whatever the scrape frequency
+	Interval time.Duration
+
+	mu       sync.Mutex
+	running  map[string]bool
+	results  map[string]benchmarkResult
+	duration *prometheus.HistogramVec
+	once     sync.Once
+}
+
+type benchmarkResult struct {
+	mount      Mount
+	time       time.Time
+	err        error
+	throughput map[string]float64
+}
+
+// NewBenchmark creates the benchmark from environment variables, it returns nil when the benchmark isn't enabled
+func NewBenchmark() *Benchmark {
+	if !parseBool(getEnv("PROM_MOUNT_BENCHMARK", "false")) {
+		return nil
+	}
+	benchmark := &Benchmark{
+		Size:     parseInt(getEnv("PROM_MOUNT_BENCHMARK_SIZE", "1048576")),
+		Files:    parseInt(getEnv("PROM_MOUNT_BENCHMARK_FILES", "10")),
+		Interval: time.Duration(parseInt(getEnv("PROM_MOUNT_BENCHMARK_INTERVAL", "300"))) * time.Second,
+	}
+	// invalid numbers are parsed as 0
+	if benchmark.Size <= 0 {
+		log.Fatalf("PROM_MOUNT_BENCHMARK_SIZE must be a positive number of bytes: %v", getEnv("PROM_MOUNT_BENCHMARK_SIZE", ""))
+	}
+	if benchmark.Files <= 0 {
+		log.Fatalf("PROM_MOUNT_BENCHMARK_FILES must be a positive number of files: %v", getEnv("PROM_MOUNT_BENCHMARK_FILES", ""))
+	}
+	if benchmark.Interval <= 0 {
+		log.Fatalf("PROM_MOUNT_BENCHMARK_INTERVAL must be a positive number of seconds: %v", getEnv("PROM_MOUNT_BENCHMARK_INTERVAL", ""))
+	}
+	return benchmark
+}
+
+func (b *Benchmark) init() {
+	b.once.Do(func() {
+		b.running = make(map[string]bool)
+		b.results = make(map[string]benchmarkResult)
+		b.duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "mount_benchmark_op_duration_seconds",
+			Help:      "Duration of the operations of the mount benchmarks",
+			Buckets:   []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"volume", "mountpoint", "op"})
+	})
+}
+
+// Start benchmarks in background the mounts whose last benchmark is older than the interval,
+// a mount isn't benchmarked again while its previous benchmark is running
+func (b *Benchmark) Start(mounts []Mount) {
+	b.init()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// results of unmounted mounts are dropped
+	mounted := make(map[string]bool, len(mounts))
+	for _, mount := range mounts {
+		mounted[mount.MountPoint] = true
+	}
+	for mountPoint := range b.results {
+		if !mounted[mountPoint] {
+			delete(b.results, mountPoint)
+		}
+	}
+
+	for _, mount := range mounts {
+		if b.running[mount.MountPoint] {
+			continue
+		}
+		if result, ok := b.results[mount.MountPoint]; ok && time.Since(result.time) < b.Interval {
+			continue
+		}
+		b.running[mount.MountPoint] = true
+		go func(mount Mount) {
+			result := b.run(mount)
+			if result.err != nil {
+				log.Errorf("benchmark of %v failed: %v", mount.MountPoint, result.err)
+			}
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.running, mount.MountPoint)
+			b.results[mount.MountPoint] = result
+		}(mount)
+	}
+}
+
+func (b *Benchmark) run(mount Mount) benchmarkResult {
+	result := benchmarkResult{mount: mount, time: time.Now(), throughput: make(map[string]float64)}
+	timed := func(op string, fn func() error) (time.Duration, error) {
+		start := time.Now()
+		err := fn()
+		duration := time.Since(start)
+		if err == nil {
+			b.duration.WithLabelValues(mount.Volume, mount.MountPoint, op).Observe(duration.Seconds())
+		}
+		return duration, err
+	}
+
+	payload := make([]byte, b.Size)
+	if _, err := rand.Read(payload); err != nil {
+		result.err = err
+		return result
+	}
+	prefix := filepath.Join(mount.MountPoint, fmt.Sprintf(".gluster_benchmark_%v_%v", os.Getpid(), result.time.UnixNano()))
+
+	file, err := os.OpenFile(prefix, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	defer os.Remove(prefix)
+	writeDuration, err := timed("write", func() error {
+		_, err := file.Write(payload)
+		return err
+	})
+	var fsyncDuration time.Duration
+	if err == nil {
+		fsyncDuration, err = timed("fsync", file.Sync)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		result.err = err
+		return result
+	}
+	result.throughput["write"] = float64(b.Size) / (writeDuration + fsyncDuration).Seconds()
+
+	var read []byte
+	readDuration, err := timed("read", func() error {
+		read, err = ioutil.ReadFile(prefix)
+		return err
+	})
+	if err == nil && !bytes.Equal(read, payload) {
+		err = errReadBack
+	}
+	if err != nil {
+		result.err = err
+		return result
+	}
+	result.throughput["read"] = float64(b.Size) / readDuration.Seconds()
+
+	if _, err := timed("delete", func() error { return os.Remove(prefix) }); err != nil {
+		result.err = err
+		return result
+	}
+
+	for i := 0; i < b.Files; i++ {
+		name := fmt.Sprintf("%v_%v", prefix, i)
+		_, err := timed("create", func() error {
+			file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if err != nil {
+				return err
+			}
+			return file.Close()
+		})
+		if err == nil {
+			_, err = timed("stat", func() error {
+				_, err := os.Stat(name)
+				return err
+			})
+		}
+		if err == nil {
+			_, err = timed("unlink", func() error { return os.Remove(name) })
+		}
+		if err != nil {
+			os.Remove(name)
+			result.err = err
+			return result
+		}
+	}
+	return result
+}
+
+// Describe sends the descriptors of the benchmark metrics
+func (b *Benchmark) Describe(ch chan<- *prometheus.Desc) {
+	b.init()
+	ch <- benchmarkThroughput
+	ch <- benchmarkSuccess
+	ch <- benchmarkLastRun
+	b.duration.Describe(ch)
+}
+
+// Collect sends the results of the last benchmarks
+func (b *Benchmark) Collect(ch chan<- prometheus.Metric) {
+	b.init()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, result := range b.results {
+		success := 0.0
+		if result.err == nil {
+			success = 1
+		}
+		labels := []string{result.mount.Volume, result.mount.MountPoint}
+		ch <- prometheus.MustNewConstMetric(benchmarkSuccess, prometheus.GaugeValue, success, labels...)
+		ch <- prometheus.MustNewConstMetric(
+			benchmarkLastRun, prometheus.GaugeValue, float64(result.time.UnixNano())/1e9, labels...,
+		)
+		for op, throughput := range result.throughput {
+			ch <- prometheus.MustNewConstMetric(
+				benchmarkThroughput, prometheus.GaugeValue, throughput, append(labels, op)...,
+			)
+		}
+	}
+	b.duration.Collect(ch)
+}
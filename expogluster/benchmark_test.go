@@ -0,0 +1,124 @@
+package expogluster
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// waitBenchmarks waits until no benchmark is running
+func waitBenchmarks(t *testing.T, b *Benchmark) {
+	waitFor(t, "the benchmarks", func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return len(b.running) == 0
+	})
+}
+
+func collectBenchmark(b *Benchmark) []prometheus.Metric {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		b.Collect(ch)
+		close(ch)
+	}()
+	metrics := []prometheus.Metric{}
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+func TestBenchmark(t *testing.T) {
+	dir, err := ioutil.TempDir("", "benchmark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := &Benchmark{Size: 4096, Files: 3, Interval: time.Hour}
+	mount := Mount{MountPoint: dir, Volume: "gfs"}
+	missing := Mount{MountPoint: filepath.Join(dir, "missing"), Volume: "backup"}
+	b.Start([]Mount{mount, missing})
+	waitBenchmarks(t, b)
+
+	// the files of the benchmark are removed
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 0 {
+		t.Errorf("files left by the benchmark %v: %v", files, err)
+	}
+
+	metrics := collectBenchmark(b)
+	for _, test := range []struct {
+		desc   *prometheus.Desc
+		labels map[string]string
+		value  float64
+	}{
+		{benchmarkSuccess, map[string]string{"mountpoint": dir}, 1},
+		{benchmarkSuccess, map[string]string{"mountpoint": missing.MountPoint}, 0},
+	} {
+		if value, ok := metricValue(t, metrics, test.desc, test.labels); !ok || value != test.value {
+			t.Errorf("%v %v is %v (found %v), expected %v", test.desc, test.labels, value, ok, test.value)
+		}
+	}
+	for _, op := range []string{"write", "read"} {
+		if value, ok := metricValue(t, metrics, benchmarkThroughput, map[string]string{"mountpoint": dir, "op": op}); !ok || value <= 0 {
+			t.Errorf("%v throughput is %v (found %v)", op, value, ok)
+		}
+	}
+	if _, ok := metricValue(t, metrics, benchmarkThroughput, map[string]string{"mountpoint": missing.MountPoint}); ok {
+		t.Error("throughput reported for a failed benchmark")
+	}
+
+	// the payload is written, fsynced, read and deleted once, the small files are created, stated and unlinked
+	for op, count := range map[string]uint64{
+		"write": 1, "fsync": 1, "read": 1, "delete": 1, "create": 3, "stat": 3, "unlink": 3,
+	} {
+		m := &dto.Metric{}
+		if err := b.duration.WithLabelValues("gfs", dir, op).(prometheus.Metric).Write(m); err != nil {
+			t.Fatal(err)
+		}
+		if samples := m.GetHistogram().GetSampleCount(); samples != count {
+			t.Errorf("%v observed %d times, expected %d", op, samples, count)
+		}
+	}
+}
+
+func TestBenchmarkInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "benchmark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := &Benchmark{Size: 1024, Files: 1, Interval: time.Hour}
+	mount := Mount{MountPoint: dir, Volume: "gfs"}
+	b.Start([]Mount{mount})
+	waitBenchmarks(t, b)
+	first := b.results[dir].time
+
+	// the mount isn't benchmarked again within the interval, whatever the refreshes
+	b.Start([]Mount{mount})
+	waitBenchmarks(t, b)
+	if last := b.results[dir].time; !last.Equal(first) {
+		t.Errorf("benchmarked again within the interval at %v", last)
+	}
+
+	b.mu.Lock()
+	b.results[dir] = benchmarkResult{mount: mount, time: first.Add(-2 * time.Hour)}
+	b.mu.Unlock()
+	b.Start([]Mount{mount})
+	waitBenchmarks(t, b)
+	if last := b.results[dir].time; !last.After(first) {
+		t.Errorf("not benchmarked again after the interval, last run at %v", last)
+	}
+
+	// the results of unmounted mounts are dropped
+	b.Start(nil)
+	if len(b.results) != 0 {
+		t.Errorf("results of unmounted mounts %+v", b.results)
+	}
+}
@@ -0,0 +1,301 @@
+package expogluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// sectorSize is the unit of the sector counters of /sys/class/block/<dev>/stat
+const sectorSize = 512
+
+var (
+	brickFilesystemInfo = newDesc(
+		prometheus.BuildFQName(namespace, "", "brick_filesystem_info"),
+		"Filesystem of the brick reported by volume status, value is always 1",
+		[]string{"volume", "hostname", "path", "device", "fs_name", "mnt_options", "block_size"}, nil)
+
+	brickDeviceReads = newDesc(
+		prometheus.BuildFQName(namespace, "", "brick_device_reads_completed_total"),
+		"Number of reads completed by the device of the local brick",
+		[]string{"volume", "path", "device"}, nil)
+
+	brickDeviceReadBytes = newDesc(
+		prometheus.BuildFQName(namespace, "", "brick_device_read_bytes_total"),
+		"Number of bytes read by the device of the local brick",
+		[]string{"volume", "path", "device"}, nil)
+
+	brickDeviceReadTime = newDesc(
+		prometheus.BuildFQName(namespace, "", "brick_device_read_time_seconds_total"),
+		"Time spent reading by the device of the local brick",
+		[]string{"volume", "path", "device"}, nil)
+
+	brickDeviceWrites = newDesc(
+		prometheus.BuildFQName(namespace, "", "brick_device_writes_completed_total"),
+		"Number of writes completed by the device of the local brick",
+		[]string{"volume", "path", "device"}, nil)
+
+	brickDeviceWrittenBytes = newDesc(
+		prometheus.BuildFQName(namespace, "", "brick_device_written_bytes_total"),
+		"Number of bytes written by the device of the local brick",
+		[]string{"volume", "path", "device"}, nil)
+
+	brickDeviceWriteTime = newDesc(
+		prometheus.BuildFQName(namespace, "", "brick_device_write_time_seconds_total"),
+		"Time spent writing by the device of the local brick",
+		[]string{"volume", "path", "device"}, nil)
+
+	brickDeviceIONow = newDesc(
+		prometheus.BuildFQName(namespace, "", "brick_device_io_now"),
+		"Number of I/Os in progress on the device of the local brick",
+		[]string{"volume", "path", "device"}, nil)
+
+	brickDeviceIOTime = newDesc(
+		prometheus.BuildFQName(namespace, "", "brick_device_io_time_seconds_total"),
+		"Time spent doing I/Os by the device of the local brick",
+		[]string{"volume", "path", "device"}, nil)
+
+	brickThinPoolData = newDesc(
+		prometheus.BuildFQName(namespace, "", "brick_thinpool_data_percent"),
+		"Data usage of the LVM thin pool of the local brick",
+		[]string{"volume", "path", "vg", "pool"}, nil)
+
+	brickThinPoolMetadata = newDesc(
+		prometheus.BuildFQName(namespace, "", "brick_thinpool_metadata_percent"),
+		"Metadata usage of the LVM thin pool of the local brick",
+		[]string{"volume", "path", "vg", "pool"}, nil)
+)
+
+// DeviceStats are the I/O statistics of a block device read from /sys/class/block/<dev>/stat
+type DeviceStats struct {
+	Device          string
+	ReadsCompleted  uint64
+	SectorsRead     uint64
+	ReadTimeMs      uint64
+	WritesCompleted uint64
+	SectorsWritten  uint64
+	WriteTimeMs     uint64
+	IONow           uint64
+	IOTimeMs        uint64
+}
+
+// ReadDeviceStats resolves the device of a brick, like /dev/mapper/vg-lv, to its kernel name
+// and reads its statistics from the sysfs mounted on sysPath
+func ReadDeviceStats(sysPath, device string) (DeviceStats, error) {
+	resolved, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		return DeviceStats{}, err
+	}
+	stats := DeviceStats{Device: filepath.Base(resolved)}
+	content, err := ioutil.ReadFile(filepath.Join(sysPath, "class", "block", stats.Device, "stat"))
+	if err != nil {
+		return stats, err
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) < 11 {
+		return stats, fmt.Errorf("malformed stat of device %v", stats.Device)
+	}
+	values := make([]uint64, 11)
+	for i := range values {
+		if values[i], err = strconv.ParseUint(fields[i], 10, 64); err != nil {
+			return stats, fmt.Errorf("malformed stat of device %v: %v", stats.Device, err)
+		}
+	}
+	stats.ReadsCompleted = values[0]
+	stats.SectorsRead = values[2]
+	stats.ReadTimeMs = values[3]
+	stats.WritesCompleted = values[4]
+	stats.SectorsWritten = values[6]
+	stats.WriteTimeMs = values[7]
+	stats.IONow = values[8]
+	stats.IOTimeMs = values[9]
+	return stats, nil
+}
+
+// ThinPool is the usage of a LVM thin pool
+type ThinPool struct {
+	VG              string
+	Name            string
+	DataPercent     float64
+	MetadataPercent float64
+}
+
+type lvsReport struct {
+	Report []struct {
+		LV []struct {
+			VGName          string `json:"vg_name"`
+			LVName          string `json:"lv_name"`
+			LVDMPath        string `json:"lv_dm_path"`
+			PoolLV          string `json:"pool_lv"`
+			LVAttr          string `json:"lv_attr"`
+			DataPercent     string `json:"data_percent"`
+			MetadataPercent string `json:"metadata_percent"`
+		} `json:"lv"`
+	} `json:"report"`
+}
+
+// ThinPools runs lvs and returns the thin pools indexed by the resolved device of their thin volumes
+func ThinPools(runner Runner) (map[string]ThinPool, error) {
+	output, err := runner.Run("lvs", "--reportformat", "json",
+		"-o", "vg_name,lv_name,lv_dm_path,pool_lv,lv_attr,data_percent,metadata_percent")
+	if err != nil {
+		return nil, fmt.Errorf("lvs failed: %v: %s", err, output)
+	}
+	report := lvsReport{}
+	if err := json.Unmarshal(output, &report); err != nil {
+		return nil, err
+	}
+
+	pools := make(map[string]ThinPool)
+	for _, r := range report.Report {
+		for _, lv := range r.LV {
+			// thin pools have the "t" volume type
+			if strings.HasPrefix(lv.LVAttr, "t") {
+				data, _ := strconv.ParseFloat(lv.DataPercent, 64)
+				metadata, _ := strconv.ParseFloat(lv.MetadataPercent, 64)
+				pools[lv.VGName+"/"+lv.LVName] = ThinPool{VG: lv.VGName, Name: lv.LVName, DataPercent: data, MetadataPercent: metadata}
+			}
+		}
+	}
+	devices := make(map[string]ThinPool)
+	for _, r := range report.Report {
+		for _, lv := range r.LV {
+			pool, ok := pools[lv.VGName+"/"+lv.PoolLV]
+			if lv.PoolLV == "" || !ok {
+				continue
+			}
+			if device, err := filepath.EvalSymlinks(lv.LVDMPath); err == nil {
+				devices[device] = pool
+			}
+		}
+	}
+	return devices, nil
+}
+
+// isLocalHost checks if the hostname of a brick is the host running the exporter
+func isLocalHost(hostname string) bool {
+	if hostname == "localhost" {
+		return true
+	}
+	if name, err := os.Hostname(); err == nil {
+		if hostname == name || hostname == strings.SplitN(name, ".", 2)[0] {
+			return true
+		}
+	}
+	ip := net.ParseIP(hostname)
+	if ip == nil {
+		return false
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// collectBrickDevices sends the filesystem of the bricks,
+// and the device and thin pool usage of the local bricks when the device collector is enabled
+func (e *Exporter) collectBrickDevices(ch chan<- prometheus.Metric, volumeStatus VolumeStatusJSON) {
+	var pools map[string]ThinPool
+	poolsRead := false
+	for _, vol := range volumeStatus.CliOutput.VolStatus.Volumes.Volume {
+		if !e.monitored(vol.VolName) {
+			continue
+		}
+		for _, brick := range volumeStatus.Bricks(vol.VolName) {
+			if brick.Device == "" {
+				// self-heal and other daemons don't have a device
+				continue
+			}
+			if !e.reportBrick(brick.Hostname, brick.PeerID) {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				brickFilesystemInfo, prometheus.GaugeValue, 1,
+				vol.VolName, brick.Hostname, brick.Path, brick.Device, brick.FsName, brick.MntOptions, fmt.Sprint(brick.BlockSize),
+			)
+			if !e.enabled("device") || !e.isLocalBrick(brick.Hostname, brick.PeerID) {
+				continue
+			}
+
+			stats, err := ReadDeviceStats(e.sysPath(), brick.Device)
+			if err != nil {
+				log.Errorf("Cannot read stats of device %v of brick %v: %v", brick.Device, brick.Path, err)
+			} else {
+				labels := []string{vol.VolName, brick.Path, stats.Device}
+				for desc, value := range map[*prometheus.Desc]float64{
+					brickDeviceReads:        float64(stats.ReadsCompleted),
+					brickDeviceReadBytes:    float64(stats.SectorsRead * sectorSize),
+					brickDeviceReadTime:     float64(stats.ReadTimeMs) / 1000,
+					brickDeviceWrites:       float64(stats.WritesCompleted),
+					brickDeviceWrittenBytes: float64(stats.SectorsWritten * sectorSize),
+					brickDeviceWriteTime:    float64(stats.WriteTimeMs) / 1000,
+					brickDeviceIOTime:       float64(stats.IOTimeMs) / 1000,
+				} {
+					ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, labels...)
+				}
+				ch <- prometheus.MustNewConstMetric(brickDeviceIONow, prometheus.GaugeValue, float64(stats.IONow), labels...)
+			}
+
+			// lvs is only run once per scrape, and only when there are local bricks
+			if !poolsRead {
+				poolsRead = true
+				if pools, err = ThinPools(e.runner()); err != nil {
+					log.Errorf("Cannot read LVM thin pools: %v", err)
+				}
+			}
+			device, err := filepath.EvalSymlinks(brick.Device)
+			if err != nil {
+				continue
+			}
+			if pool, ok := pools[device]; ok {
+				ch <- prometheus.MustNewConstMetric(
+					brickThinPoolData, prometheus.GaugeValue, pool.DataPercent, vol.VolName, brick.Path, pool.VG, pool.Name,
+				)
+				ch <- prometheus.MustNewConstMetric(
+					brickThinPoolMetadata, prometheus.GaugeValue, pool.MetadataPercent, vol.VolName, brick.Path, pool.VG, pool.Name,
+				)
+			}
+		}
+	}
+}
+
+func (e *Exporter) sysPath() string {
+	if e.SysPath == "" {
+		return "/sys"
+	}
+	return e.SysPath
+}
+
+// onlineBricks returns the names, "host:/path", of the online bricks
+func onlineBricks(bricks []BrickStatus) map[string]bool {
+	online := make(map[string]bool, len(bricks))
+	for _, brick := range bricks {
+		if brick.Status == 1 {
+			online[brick.Hostname+":"+brick.Path] = true
+		}
+	}
+	return online
+}
+
+// splitBrickName splits the name of a brick, "host:/path", into its host and path
+func splitBrickName(name string) (string, string) {
+	parts := strings.SplitN(name, ":", 2)
+	if len(parts) < 2 {
+		return name, ""
+	}
+	return parts[0], parts[1]
+}
@@ -0,0 +1,192 @@
+package expogluster
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// runnerFunc runs the commands with a function
+type runnerFunc func(name string, args ...string) ([]byte, error)
+
+func (f runnerFunc) Run(name string, args ...string) ([]byte, error) {
+	return f(name, args...)
+}
+
+// deviceTree creates the device of a brick, a device mapper link like /dev/mapper/gluster-brick
+// to dm-3, and its statistics in a sysfs tree. It returns the root of the tree
+func deviceTree(t *testing.T) string {
+	root, err := ioutil.TempDir("", "device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"dev/mapper", "sys/class/block/dm-3"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "dev", "dm-3"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../dm-3", filepath.Join(root, "dev", "mapper", "gluster-brick")); err != nil {
+		t.Fatal(err)
+	}
+	// reads, read merges, read sectors, read ms, writes, write merges, written sectors, write ms,
+	// in flight, io ms, weighted io ms and the discard and flush fields of recent kernels
+	stat := "    1200       30    96000     4500      800       10    64000     7000        2     9000    11500        0        0        0        0      100       50\n"
+	if err := ioutil.WriteFile(filepath.Join(root, "sys", "class", "block", "dm-3", "stat"), []byte(stat), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestReadDeviceStats(t *testing.T) {
+	root := deviceTree(t)
+	defer os.RemoveAll(root)
+
+	stats, err := ReadDeviceStats(filepath.Join(root, "sys"), filepath.Join(root, "dev", "mapper", "gluster-brick"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := DeviceStats{
+		Device:          "dm-3",
+		ReadsCompleted:  1200,
+		SectorsRead:     96000,
+		ReadTimeMs:      4500,
+		WritesCompleted: 800,
+		SectorsWritten:  64000,
+		WriteTimeMs:     7000,
+		IONow:           2,
+		IOTimeMs:        9000,
+	}
+	if stats != expected {
+		t.Errorf("stats %+v, expected %+v", stats, expected)
+	}
+
+	if _, err := ReadDeviceStats(filepath.Join(root, "sys"), filepath.Join(root, "dev", "mapper", "missing")); err == nil {
+		t.Error("no error for a missing device")
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "sys", "class", "block", "dm-3", "stat"), []byte("1 2 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadDeviceStats(filepath.Join(root, "sys"), filepath.Join(root, "dev", "dm-3")); err == nil {
+		t.Error("no error for a malformed stat")
+	}
+}
+
+// lvsOutput is the report of "lvs --reportformat json" with a thin pool, a thin volume of the pool on the
+// device of the brick and a linear volume
+func lvsOutput(root string) []byte {
+	return []byte(fmt.Sprintf(`  {
+      "report": [
+          {
+              "lv": [
+                  {"vg_name":"gluster", "lv_name":"brick", "lv_dm_path":"%[1]v/dev/mapper/gluster-brick", "pool_lv":"thinpool", "lv_attr":"Vwi-aotz--", "data_percent":"60.00", "metadata_percent":""},
+                  {"vg_name":"gluster", "lv_name":"thinpool", "lv_dm_path":"%[1]v/dev/mapper/gluster-thinpool", "pool_lv":"", "lv_attr":"twi-aotz--", "data_percent":"42.50", "metadata_percent":"3.10"},
+                  {"vg_name":"system", "lv_name":"root", "lv_dm_path":"%[1]v/dev/mapper/system-root", "pool_lv":"", "lv_attr":"-wi-ao----", "data_percent":"", "metadata_percent":""}
+              ]
+          }
+      ]
+  }
+`, root))
+}
+
+func TestThinPools(t *testing.T) {
+	root := deviceTree(t)
+	defer os.RemoveAll(root)
+
+	var command string
+	pools, err := ThinPools(runnerFunc(func(name string, args ...string) ([]byte, error) {
+		command = name + " " + strings.Join(args, " ")
+		return lvsOutput(root), nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(command, "lvs --reportformat json -o ") {
+		t.Errorf("command %q", command)
+	}
+	// thin volumes are indexed by their resolved device
+	expected := ThinPool{VG: "gluster", Name: "thinpool", DataPercent: 42.5, MetadataPercent: 3.1}
+	if len(pools) != 1 || pools[filepath.Join(root, "dev", "dm-3")] != expected {
+		t.Errorf("pools %+v, expected %+v", pools, expected)
+	}
+
+	_, err = ThinPools(runnerFunc(func(name string, args ...string) ([]byte, error) {
+		return []byte("  No volume groups found"), errors.New("exit status 5")
+	}))
+	if err == nil || !strings.Contains(err.Error(), "No volume groups found") {
+		t.Errorf("error %v, expected the output of lvs", err)
+	}
+}
+
+func TestCollectBrickDevices(t *testing.T) {
+	root := deviceTree(t)
+	defer os.RemoveAll(root)
+
+	lvsCalls := 0
+	runner := runnerFunc(func(name string, args ...string) ([]byte, error) {
+		if name != "lvs" {
+			return nil, errors.New("exit status 1")
+		}
+		lvsCalls++
+		return lvsOutput(root), nil
+	})
+	e := &Exporter{
+		Volumes:    []string{allVolumes},
+		Collectors: []string{"status", "device"},
+		Backend:    &CLI{Runner: runner},
+		SysPath:    filepath.Join(root, "sys"),
+	}
+
+	status := VolumeStatusJSON{}
+	volume := VolumeStatusVolume{VolName: "gfs"}
+	for _, path := range []string{"/data/brick1", "/data/brick2"} {
+		volume.Node = append(volume.Node, VolumeStatusNode{
+			Hostname: "localhost", Path: path, Status: "1",
+			Device: filepath.Join(root, "dev", "mapper", "gluster-brick"), FsName: "xfs", BlockSize: "4096",
+		})
+	}
+	volume.Node = append(volume.Node, VolumeStatusNode{Hostname: "Self-heal Daemon", Path: "localhost", Status: "1"})
+	status.CliOutput.VolStatus.Volumes.Volume = []VolumeStatusVolume{volume}
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		e.collectBrickDevices(ch, status)
+		close(ch)
+	}()
+	metrics := []prometheus.Metric{}
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+
+	// lvs runs once per collection with the runner of the exporter
+	if lvsCalls != 1 {
+		t.Errorf("lvs ran %d times, expected once", lvsCalls)
+	}
+	for _, test := range []struct {
+		desc  *prometheus.Desc
+		value float64
+	}{
+		{brickDeviceReadBytes, 96000 * 512},
+		{brickDeviceWrittenBytes, 64000 * 512},
+		{brickDeviceWriteTime, 7},
+		{brickDeviceIONow, 2},
+		{brickThinPoolData, 42.5},
+		{brickThinPoolMetadata, 3.1},
+	} {
+		value, ok := metricValue(t, metrics, test.desc, map[string]string{"path": "/data/brick2"})
+		if !ok || value != test.value {
+			t.Errorf("%v is %v (found %v), expected %v", test.desc, value, ok, test.value)
+		}
+	}
+	if _, ok := metricValue(t, metrics, brickFilesystemInfo, map[string]string{"path": "localhost"}); ok {
+		t.Error("filesystem reported for the self-heal daemon")
+	}
+}
@@ -0,0 +1,76 @@
+package expogluster
+
+// Capacity is the usable capacity of a volume, computed from the sizes of its bricks
+type Capacity struct {
+	Volume    string  `json:"volume"`
+	SizeTotal uint64  `json:"sizeTotal"`
+	SizeFree  uint64  `json:"sizeFree"`
+	Imbalance float64 `json:"imbalance"`
+}
+
+// VolumeCapacity computes the usable capacity of the volume from the status of its bricks.
+// A replicated subvolume holds as much as its smallest data brick, arbiters only hold metadata,
+// and a dispersed subvolume holds its data bricks, without the redundancy ones, times its smallest brick.
+// Imbalance is the difference between the fill ratio of the most and the least filled data bricks.
+// It returns false when the status of every data brick of a subvolume is unknown
+func VolumeCapacity(volume Volume, bricks []BrickStatus) (Capacity, bool) {
+	capacity := Capacity{Volume: volume.Name}
+	if len(volume.Bricks) == 0 {
+		return capacity, false
+	}
+
+	status := make(map[string]BrickStatus, len(bricks))
+	for _, brick := range bricks {
+		if brick.SizeTotal > 0 {
+			status[brick.Hostname+":"+brick.Path] = brick
+		}
+	}
+
+	subvolumeSize, dataBricks := 1, uint64(1)
+	switch {
+	case volume.DisperseCount > 0:
+		subvolumeSize = volume.DisperseCount
+		dataBricks = uint64(volume.DisperseCount - volume.RedundancyCount)
+	case volume.ReplicaCount > 1:
+		subvolumeSize = volume.ReplicaCount
+	}
+
+	minFill, maxFill := 1.0, 0.0
+	for start := 0; start < len(volume.Bricks); start += subvolumeSize {
+		end := start + subvolumeSize
+		if end > len(volume.Bricks) {
+			end = len(volume.Bricks)
+		}
+
+		found := false
+		var total, free uint64
+		for _, brick := range volume.Bricks[start:end] {
+			s, ok := status[brick.Name]
+			if !ok || brick.IsArbiter == 1 {
+				continue
+			}
+			if !found || s.SizeTotal < total {
+				total = s.SizeTotal
+			}
+			if !found || s.SizeFree < free {
+				free = s.SizeFree
+			}
+			found = true
+
+			fill := 1 - float64(s.SizeFree)/float64(s.SizeTotal)
+			if fill < minFill {
+				minFill = fill
+			}
+			if fill > maxFill {
+				maxFill = fill
+			}
+		}
+		if !found {
+			return capacity, false
+		}
+		capacity.SizeTotal += total * dataBricks
+		capacity.SizeFree += free * dataBricks
+	}
+	capacity.Imbalance = maxFill - minFill
+	return capacity, true
+}
@@ -0,0 +1,103 @@
+package expogluster
+
+import (
+	"math"
+	"testing"
+)
+
+func TestVolumeCapacity(t *testing.T) {
+	const gb = 1 << 30
+	bricks := func(names ...string) []Brick {
+		list := make([]Brick, 0, len(names))
+		for _, name := range names {
+			list = append(list, Brick{Name: name})
+		}
+		return list
+	}
+	status := func(name string, total, free uint64) BrickStatus {
+		return BrickStatus{Hostname: name[:2], Path: name[3:], SizeTotal: total * gb, SizeFree: free * gb}
+	}
+
+	arbiter := Volume{Name: "arbiter", ReplicaCount: 3, ArbiterCount: 1, Bricks: bricks("s1:/b", "s2:/b", "s3:/a")}
+	arbiter.Bricks[2].IsArbiter = 1
+
+	for _, test := range []struct {
+		name      string
+		volume    Volume
+		status    []BrickStatus
+		ok        bool
+		total     uint64
+		free      uint64
+		imbalance float64
+	}{
+		{
+			name:   "distribute",
+			volume: Volume{Name: "distribute", DistCount: 3, Bricks: bricks("s1:/b", "s2:/b", "s3:/b")},
+			status: []BrickStatus{status("s1:/b", 100, 50), status("s2:/b", 200, 50), status("s3:/b", 100, 100)},
+			ok:     true, total: 400, free: 200, imbalance: 0.75,
+		},
+		{
+			name:   "replica 3",
+			volume: Volume{Name: "replica", ReplicaCount: 3, Bricks: bricks("s1:/b", "s2:/b", "s3:/b")},
+			status: []BrickStatus{status("s1:/b", 100, 40), status("s2:/b", 120, 60), status("s3:/b", 100, 50)},
+			ok:     true, total: 100, free: 40, imbalance: 0.1,
+		},
+		{
+			// the arbiter holds metadata only, its size doesn't limit the subvolume
+			name:   "arbiter 2+1",
+			volume: arbiter,
+			status: []BrickStatus{status("s1:/b", 100, 50), status("s2:/b", 100, 30), status("s3:/a", 10, 9)},
+			ok:     true, total: 100, free: 30, imbalance: 0.2,
+		},
+		{
+			name: "disperse 4+2",
+			volume: Volume{Name: "disperse", DisperseCount: 6, RedundancyCount: 2,
+				Bricks: bricks("s1:/b", "s2:/b", "s3:/b", "s4:/b", "s5:/b", "s6:/b")},
+			status: []BrickStatus{
+				status("s1:/b", 100, 60), status("s2:/b", 100, 50), status("s3:/b", 100, 40),
+				status("s4:/b", 100, 60), status("s5:/b", 100, 60), status("s6:/b", 100, 60),
+			},
+			ok: true, total: 400, free: 160, imbalance: 0.2,
+		},
+		{
+			name:   "distributed replica 2x2",
+			volume: Volume{Name: "distrep", ReplicaCount: 2, Bricks: bricks("s1:/b", "s2:/b", "s3:/b", "s4:/b")},
+			status: []BrickStatus{status("s1:/b", 100, 50), status("s2:/b", 100, 50), status("s3:/b", 200, 100), status("s4:/b", 200, 150)},
+			ok:     true, total: 300, free: 150, imbalance: 0.25,
+		},
+		{
+			// a replica of the brick missing from the status still gives the size of the subvolume
+			name:   "brick missing from status",
+			volume: Volume{Name: "distrep", ReplicaCount: 2, Bricks: bricks("s1:/b", "s2:/b", "s3:/b", "s4:/b")},
+			status: []BrickStatus{status("s1:/b", 100, 50), status("s3:/b", 200, 100), status("s4:/b", 0, 0)},
+			ok:     true, total: 300, free: 150, imbalance: 0,
+		},
+		{
+			name:   "subvolume missing from status",
+			volume: Volume{Name: "distrep", ReplicaCount: 2, Bricks: bricks("s1:/b", "s2:/b", "s3:/b", "s4:/b")},
+			status: []BrickStatus{status("s1:/b", 100, 50), status("s2:/b", 100, 50)},
+			ok:     false,
+		},
+		{
+			name:   "without bricks",
+			volume: Volume{Name: "empty"},
+			ok:     false,
+		},
+	} {
+		capacity, ok := VolumeCapacity(test.volume, test.status)
+		if ok != test.ok {
+			t.Errorf("%v: capacity known %v, expected %v", test.name, ok, test.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if capacity.Volume != test.volume.Name || capacity.SizeTotal != test.total*gb || capacity.SizeFree != test.free*gb {
+			t.Errorf("%v: capacity %v of %vGB total and %vGB free, expected %vGB and %vGB", test.name,
+				capacity.Volume, capacity.SizeTotal/gb, capacity.SizeFree/gb, test.total, test.free)
+		}
+		if math.Abs(capacity.Imbalance-test.imbalance) > 1e-9 {
+			t.Errorf("%v: imbalance %v, expected %v", test.name, capacity.Imbalance, test.imbalance)
+		}
+	}
+}
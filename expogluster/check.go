@@ -0,0 +1,267 @@
+package expogluster
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// states and exit codes of the Nagios plugin API
+const (
+	CheckOK       = 0
+	CheckWarning  = 1
+	CheckCritical = 2
+	CheckUnknown  = 3
+)
+
+var checkStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// Threshold raises a warning or critical state when a value is above it, a negative threshold is disabled
+type Threshold struct {
+	Warning  float64
+	Critical float64
+}
+
+func (t Threshold) state(value float64) int {
+	switch {
+	case t.Critical >= 0 && value > t.Critical:
+		return CheckCritical
+	case t.Warning >= 0 && value > t.Warning:
+		return CheckWarning
+	}
+	return CheckOK
+}
+
+// perfdata formats the thresholds of the performance data, disabled thresholds are empty
+func (t Threshold) perfdata() string {
+	format := func(value float64) string {
+		if value < 0 {
+			return ""
+		}
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return format(t.Warning) + ";" + format(t.Critical)
+}
+
+// Thresholds of the check of the cluster
+type Thresholds struct {
+	BricksDown        Threshold
+	HealPending       Threshold
+	SplitBrain        Threshold
+	QuotaUsage        Threshold
+	BrickFill         Threshold
+	PeersDisconnected Threshold
+}
+
+// CheckResult is the result of the check of the cluster, as a Nagios plugin
+type CheckResult struct {
+	State int
+	// Details are the long output lines, one per failing element
+	Details  []string
+	Perfdata []string
+
+	problems []checkProblem
+}
+
+// checkProblem is a reason of the state of the check
+type checkProblem struct {
+	state int
+	text  string
+}
+
+func (r *CheckResult) measure(label string, value float64, threshold Threshold, unit, max string, problem string) {
+	state := threshold.state(value)
+	if state != CheckOK {
+		r.raise(state, problem)
+	}
+	r.Perfdata = append(r.Perfdata, fmt.Sprintf("%v=%v%v;%v;0;%v",
+		label, strconv.FormatFloat(value, 'f', -1, 64), unit, threshold.perfdata(), max))
+}
+
+// raise adds a problem, an unknown state doesn't hide a critical one
+func (r *CheckResult) raise(state int, problem string) {
+	if rank(state) > rank(r.State) {
+		r.State = state
+	}
+	r.problems = append(r.problems, checkProblem{state, problem})
+}
+
+// rank orders the states by severity, critical is worse than unknown which is worse than warning
+func rank(state int) int {
+	return []int{0, 1, 3, 2}[state]
+}
+
+// Write prints the result in the plugin output format: the status line with the performance data,
+// then the details
+func (r CheckResult) Write(w io.Writer) error {
+	// the most severe problems are listed first
+	sort.SliceStable(r.problems, func(i, j int) bool {
+		return rank(r.problems[i].state) > rank(r.problems[j].state)
+	})
+	problems := make([]string, 0, len(r.problems))
+	for _, problem := range r.problems {
+		problems = append(problems, problem.text)
+	}
+	summary := "cluster is healthy"
+	if len(problems) > 0 {
+		summary = strings.Join(problems, ", ")
+	}
+	line := "GLUSTER " + checkStates[r.State] + " - " + summary
+	if len(r.Perfdata) > 0 {
+		line += " | " + strings.Join(r.Perfdata, " ")
+	}
+	lines := append([]string{line}, r.Details...)
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
+
+// Check reads the state of gluster with the collectors and evaluates the thresholds
+func (e *Exporter) Check(thresholds Thresholds) CheckResult {
+	state := e.State()
+	result := CheckResult{}
+	for _, collector := range FailedCollectors(state.Errors) {
+		result.raise(CheckUnknown, fmt.Sprintf("collector %v failed: %v", collector, state.Errors[collector]))
+	}
+	if _, failed := state.Errors["volume"]; failed || state.VolumeInfo == nil {
+		// nothing can be checked without the volumes
+		if len(result.problems) == 0 {
+			result.raise(CheckUnknown, "volume collector is disabled")
+		}
+		return result
+	}
+
+	volumes := []Volume{}
+	for _, volume := range state.VolumeInfo.Volumes() {
+		if e.monitored(volume.Name) {
+			volumes = append(volumes, volume)
+		}
+	}
+
+	if state.VolumeStatus != nil && state.Errors["status"] == "" {
+		e.checkBricks(&result, thresholds, volumes, *state.VolumeStatus)
+	}
+	if state.PeerStatus != nil && state.Errors["peer"] == "" {
+		disconnected := 0
+		peers := state.PeerStatus.Peers()
+		for _, peer := range peers {
+			if !peer.Connected {
+				disconnected++
+				result.Details = append(result.Details, fmt.Sprintf("peer %v (%v) is disconnected", peer.Hostname, peer.UUID))
+			}
+		}
+		result.measure("peers_disconnected", float64(disconnected), thresholds.PeersDisconnected, "", strconv.Itoa(len(peers)),
+			fmt.Sprintf("%v peers disconnected", disconnected))
+	}
+	if e.enabled("heal") && state.Leader {
+		e.checkHeal(&result, thresholds, volumes, state.HealInfo)
+	}
+	if state.Quota != nil {
+		checkQuota(&result, thresholds, state.Quota)
+	}
+	return result
+}
+
+// checkBricks evaluates the bricks down, listed by volume info but not online in volume status, and the brick fill
+func (e *Exporter) checkBricks(result *CheckResult, thresholds Thresholds, volumes []Volume, volumeStatus VolumeStatusJSON) {
+	down, total, fill := 0, 0, 0.0
+	for _, volume := range volumes {
+		online := make(map[string]bool)
+		for _, brick := range volumeStatus.Bricks(volume.Name) {
+			if brick.Status == 1 {
+				online[brick.Hostname+":"+brick.Path] = true
+			}
+			if brick.SizeTotal > 0 {
+				used := float64(brick.SizeTotal-brick.SizeFree) / float64(brick.SizeTotal) * 100
+				if thresholds.BrickFill.state(used) != CheckOK {
+					result.Details = append(result.Details, fmt.Sprintf("brick %v:%v of volume %v is %.1f%% full", brick.Hostname, brick.Path, volume.Name, used))
+				}
+				if used > fill {
+					fill = used
+				}
+			}
+		}
+		for _, brick := range volume.Bricks {
+			total++
+			if !online[brick.Name] {
+				down++
+				result.Details = append(result.Details, fmt.Sprintf("brick %v of volume %v is down", brick.Name, volume.Name))
+			}
+		}
+	}
+	result.measure("bricks_down", float64(down), thresholds.BricksDown, "", strconv.Itoa(total),
+		fmt.Sprintf("%v bricks down", down))
+	result.measure("brick_fill", fill, thresholds.BrickFill, "%", "100",
+		fmt.Sprintf("brick %.1f%% full", fill))
+}
+
+// checkHeal evaluates the entries pending heal and in split-brain of the volumes
+func (e *Exporter) checkHeal(result *CheckResult, thresholds Thresholds, volumes []Volume, healInfo map[string]VolumeHealInfoJSON) {
+	pending, splitBrain := 0, 0
+	splitBrainKnown := true
+	for _, volume := range volumes {
+		info, ok := healInfo[volume.Name]
+		if !ok {
+			continue
+		}
+		// disconnected bricks have "-" entries, they are already reported as down
+		for _, brick := range info.HealInfo.Bricks.Brick {
+			if entries, err := strconv.Atoi(brick.NumberOfEntries); err == nil && entries > 0 {
+				pending += entries
+				result.Details = append(result.Details, fmt.Sprintf("brick %v of volume %v has %v entries pending heal", brick.Name, volume.Name, entries))
+			}
+		}
+
+		split, err := e.backend().VolumeHealSplitBrain(volume.Name)
+		if errors.Is(err, ErrUnsupported) {
+			// the backend can't read the split-brain entries, they aren't checked
+			splitBrainKnown = false
+			continue
+		}
+		if err == nil && split.OpRet != 0 {
+			err = fmt.Errorf("%v (%v)", split.OpErrstr, split.OpErrno)
+		}
+		if err != nil {
+			splitBrainKnown = false
+			result.raise(CheckUnknown, fmt.Sprintf("cannot read split-brain entries of volume %v: %v", volume.Name, err))
+			continue
+		}
+		for _, brick := range split.HealInfo.Bricks.Brick {
+			if entries, err := strconv.Atoi(brick.NumberOfEntries); err == nil && entries > 0 {
+				splitBrain += entries
+				result.Details = append(result.Details, fmt.Sprintf("brick %v of volume %v has %v entries in split-brain", brick.Name, volume.Name, entries))
+			}
+		}
+	}
+	result.measure("heal_pending", float64(pending), thresholds.HealPending, "", "",
+		fmt.Sprintf("%v entries pending heal", pending))
+	if splitBrainKnown {
+		result.measure("split_brain", float64(splitBrain), thresholds.SplitBrain, "", "",
+			fmt.Sprintf("%v entries in split-brain", splitBrain))
+	}
+}
+
+// checkQuota evaluates the usage of the quota limits
+func checkQuota(result *CheckResult, thresholds Thresholds, quotas map[string]VolumeQuotaJSON) {
+	usage := 0.0
+	for volume, quota := range quotas {
+		for _, limit := range quota.CliOutput.VolQuota.Limit {
+			hardLimit, _ := strconv.ParseFloat(limit.HardLimit, 64)
+			used, _ := strconv.ParseFloat(limit.UsedSpace, 64)
+			if hardLimit <= 0 {
+				continue
+			}
+			percent := used / hardLimit * 100
+			if thresholds.QuotaUsage.state(percent) != CheckOK {
+				result.Details = append(result.Details, fmt.Sprintf("quota of %v in volume %v is %.1f%% used", limit.Path, volume, percent))
+			}
+			if percent > usage {
+				usage = percent
+			}
+		}
+	}
+	result.measure("quota_usage", usage, thresholds.QuotaUsage, "%", "100",
+		fmt.Sprintf("quota %.1f%% used", usage))
+}
@@ -0,0 +1,129 @@
+package expogluster
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestThresholdState(t *testing.T) {
+	for _, test := range []struct {
+		threshold Threshold
+		value     float64
+		state     int
+	}{
+		{Threshold{80, 90}, 50, CheckOK},
+		// the thresholds are reached above their value
+		{Threshold{80, 90}, 80, CheckOK},
+		{Threshold{80, 90}, 80.5, CheckWarning},
+		{Threshold{80, 90}, 90, CheckWarning},
+		{Threshold{80, 90}, 95, CheckCritical},
+		{Threshold{-1, 0}, 0, CheckOK},
+		{Threshold{-1, 0}, 1, CheckCritical},
+		{Threshold{0, -1}, 1, CheckWarning},
+		{Threshold{-1, -1}, 1000, CheckOK},
+	} {
+		if state := test.threshold.state(test.value); state != test.state {
+			t.Errorf("state of %v with %+v is %v, expected %v", test.value, test.threshold, checkStates[state], checkStates[test.state])
+		}
+	}
+}
+
+func TestThresholdPerfdata(t *testing.T) {
+	for threshold, expected := range map[Threshold]string{
+		{80, 90}:   "80;90",
+		{0, 1000}:  "0;1000",
+		{-1, 0}:    ";0",
+		{0.5, -1}:  "0.5;",
+		{-1, -0.5}: ";",
+	} {
+		if perfdata := threshold.perfdata(); perfdata != expected {
+			t.Errorf("perfdata of %+v is %q, expected %q", threshold, perfdata, expected)
+		}
+	}
+}
+
+func TestRank(t *testing.T) {
+	// critical is worse than unknown, which is worse than warning
+	order := []int{CheckOK, CheckWarning, CheckUnknown, CheckCritical}
+	for i := 1; i < len(order); i++ {
+		if rank(order[i]) <= rank(order[i-1]) {
+			t.Errorf("%v isn't worse than %v", checkStates[order[i]], checkStates[order[i-1]])
+		}
+	}
+
+	result := CheckResult{}
+	for _, state := range []int{CheckWarning, CheckCritical, CheckUnknown, CheckOK} {
+		result.raise(state, checkStates[state])
+	}
+	if result.State != CheckCritical {
+		t.Errorf("state %v, an unknown problem hid a critical one", checkStates[result.State])
+	}
+}
+
+func TestCheckResultWrite(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		result   func() CheckResult
+		state    int
+		expected string
+	}{
+		{
+			"healthy cluster",
+			func() CheckResult {
+				result := CheckResult{}
+				result.measure("bricks_down", 0, Threshold{-1, 0}, "", "4", "0 bricks down")
+				result.measure("brick_fill", 42.5, Threshold{80, 90}, "%", "100", "brick 42.5% full")
+				return result
+			},
+			CheckOK,
+			"GLUSTER OK - cluster is healthy | bricks_down=0;;0;0;4 brick_fill=42.5%;80;90;0;100\n",
+		},
+		{
+			"problems by severity",
+			func() CheckResult {
+				result := CheckResult{}
+				result.measure("heal_pending", 12, Threshold{0, 1000}, "", "", "12 entries pending heal")
+				result.measure("bricks_down", 1, Threshold{-1, 0}, "", "4", "1 bricks down")
+				result.raise(CheckUnknown, "collector quota failed: timeout")
+				result.Details = append(result.Details, "brick server2:/data/gfs of volume gfs is down")
+				return result
+			},
+			CheckCritical,
+			"GLUSTER CRITICAL - 1 bricks down, collector quota failed: timeout, 12 entries pending heal" +
+				" | heal_pending=12;0;1000;0; bricks_down=1;;0;0;4\n" +
+				"brick server2:/data/gfs of volume gfs is down\n",
+		},
+		{
+			"unknown without performance data",
+			func() CheckResult {
+				result := CheckResult{}
+				result.raise(CheckUnknown, "collector volume failed: Connection failed")
+				return result
+			},
+			CheckUnknown,
+			"GLUSTER UNKNOWN - collector volume failed: Connection failed\n",
+		},
+		{
+			"warning",
+			func() CheckResult {
+				result := CheckResult{}
+				result.measure("quota_usage", 85, Threshold{80, 90}, "%", "100", "quota 85.0% used")
+				return result
+			},
+			CheckWarning,
+			"GLUSTER WARNING - quota 85.0% used | quota_usage=85%;80;90;0;100\n",
+		},
+	} {
+		result := test.result()
+		if result.State != test.state {
+			t.Errorf("%v: state %v, expected %v", test.name, checkStates[result.State], checkStates[test.state])
+		}
+		output := &bytes.Buffer{}
+		if err := result.Write(output); err != nil {
+			t.Fatal(err)
+		}
+		if output.String() != test.expected {
+			t.Errorf("%v: output\n%q\nexpected\n%q", test.name, output.String(), test.expected)
+		}
+	}
+}
@@ -3,17 +3,101 @@ package expogluster
 import (
 	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/common/log"
 )
 
 // Exporter holds name, path and volumes to be monitored
 type Exporter struct {
-	Router   *mux.Router
+	Router *mux.Router
+	// Hostname is the listen address of the exporter, the node is identified by the UUID of its glusterd
 	Hostname string
 	Volumes  []string
 	Profile  bool
 	Quota    bool
+	// SplitBrain counts the entries in split-brain, with an extra heal info command per volume
+	SplitBrain bool
+
+	// Backend reads the state of gluster, gluster command line is executed locally when nil
+	Backend Backend
+	// Collectors chosen to run, all collectors run when empty
+	Collectors []string
+
+	// ClusterMode chooses the node running the cluster scoped collectors: "all", "peer" or "lock"
+	ClusterMode string
+	// LeaderLockFile is the lock file on shared storage of the "lock" cluster mode
+	LeaderLockFile string
+	// GlusterdInfoFile holds the UUID of the local glusterd
+	GlusterdInfoFile string
+	// LocalOnly restricts the brick metrics to the bricks of the local node
+	LocalOnly bool
+
+	// WebConfig is the path of the web configuration file with TLS and basic auth settings
+	WebConfig string
+
+	CORS CORSConfig
+
+	// ReadyMaxAge is the maximum age of the last successful "gluster volume info" to be ready
+	ReadyMaxAge     time.Duration
+	GlusterdPidFile string
+
+	// Probe holds the modules of /probe endpoint, the endpoint is disabled when nil
+	Probe *ProbeConfig
+
+	// Forecast estimates when bricks and volumes are full, the forecast is disabled when nil
+	Forecast *Forecast
+
+	// SysPath is the mount point of sysfs, read for the device statistics of the local bricks
+	SysPath string
+	// ProcPath is the mount point of procfs, read for the resources used by the local gluster processes
+	ProcPath string
+
+	// MountInfoPath is the mountinfo file listing the glusterfs FUSE mounts, /proc/self/mountinfo when empty
+	MountInfoPath string
+	// Mounts are the expected mount points, reported as failed when not mounted
+	Mounts []string
+	// MountTimeout is the deadline of the write probe of each mount
+	MountTimeout time.Duration
+	// MountReadBack reads back and compares the content written by the mount probes
+	MountReadBack bool
+	// Benchmark runs the synthetic I/O probe on the mounts, the probe is disabled when nil
+	Benchmark *Benchmark
+
+	// Logs follows the gluster log files, the log collector is disabled when nil
+	Logs *LogTailer
+
+	// Events receives glustereventsd webhooks, the receiver is disabled when nil
+	Events *Events
+
+	// OTLP pushes the metrics to an OpenTelemetry collector, the output is disabled when nil
+	OTLP *OTLP
+	// Pusher pushes the metrics to a Pushgateway or a remote-write receiver, the output is disabled when nil
+	Pusher *Pusher
+	// Sinks write the metrics to InfluxDB and statsd, the sinks are disabled when nil
+	Sinks *Sinks
+
+	mu        sync.RWMutex
+	refreshMu sync.Mutex
+	snapshot  *Snapshot
+	lastUp    time.Time
+	pending   map[string]bool
+
+	leaderLock *os.File
+	created    *createdTimes
+
+	uuidMu   sync.Mutex
+	uuid     string
+	uuidErr  error
+	uuidRead time.Time
+
+	mountProber *mountProber
+
+	// noAuthRoutes are the routes served without basic auth, by path and methods
+	noAuthRoutes map[string][]string
 }
 
 //NewPromExporter creates a new exporter for prometheus
@@ -23,7 +107,65 @@ func NewPromExporter() *Exporter {
 		Volumes:  []string{getEnv("PROM_VOLUMES", "_all")},
 		Profile:  parseBool(getEnv("PROM_PROFILE", "false")),
 		Quota:    parseBool(getEnv("PROM_QUOTA", "false")),
+		Backend:  newBackend(getEnv("PROM_BACKEND", "cli")),
+
+		SplitBrain: parseBool(getEnv("PROM_SPLIT_BRAIN", "false")),
+
+		ClusterMode:      clusterMode(getEnv("PROM_CLUSTER_MODE", clusterModeAll)),
+		LeaderLockFile:   getEnv("PROM_LEADER_LOCK", ""),
+		GlusterdInfoFile: getEnv("PROM_GLUSTERD_INFO", "/var/lib/glusterd/glusterd.info"),
+		LocalOnly:        parseBool(getEnv("PROM_LOCAL_ONLY", "false")),
+
+		WebConfig: getEnv("PROM_WEB_CONFIG", ""),
+		CORS:      NewCORSConfig(),
+
+		ReadyMaxAge:     time.Duration(parseInt(getEnv("PROM_READY_MAX_AGE", "60"))) * time.Second,
+		GlusterdPidFile: getEnv("PROM_GLUSTERD_PIDFILE", "/var/run/glusterd.pid"),
+
+		Forecast: NewForecast(),
+		SysPath:  getEnv("PROM_SYSFS", "/sys"),
+		ProcPath: getEnv("PROM_PROCFS", "/proc"),
+
+		MountInfoPath: getEnv("PROM_MOUNTINFO", "/proc/self/mountinfo"),
+		Mounts:        splitList(getEnv("PROM_MOUNTS", "")),
+		MountTimeout:  time.Duration(parseInt(getEnv("PROM_MOUNT_TIMEOUT", "5"))) * time.Second,
+		MountReadBack: parseBool(getEnv("PROM_MOUNT_READBACK", "false")),
+		Benchmark:     NewBenchmark(),
+
+		Logs:   NewLogTailer(),
+		Events: NewEvents(),
+
+		OTLP:   NewOTLP(),
+		Pusher: NewPusher(),
+		Sinks:  NewSinks(),
+	}
+}
+
+// newBackend creates the backend chosen by name, "cli" or "rest"
+func newBackend(name string) Backend {
+	switch name {
+	case "cli":
+		return &CLI{Runner: LocalRunner{}}
+	case "rest":
+		return NewREST()
 	}
+	log.Fatalf("Unknown backend: %v", name)
+	return nil
+}
+
+// clusterMode validates the cluster mode
+func clusterMode(mode string) string {
+	switch mode {
+	case clusterModeAll, clusterModePeer:
+		return mode
+	case clusterModeLock:
+		if getEnv("PROM_LEADER_LOCK", "") == "" {
+			log.Fatalf("PROM_LEADER_LOCK is required by cluster mode %v", mode)
+		}
+		return mode
+	}
+	log.Fatalf("Unknown cluster mode: %v", mode)
+	return ""
 }
 
 func getEnv(key string, defaultVal string) string {
@@ -38,3 +180,19 @@ func parseBool(env string) bool {
 	sslbool, _ := strconv.ParseBool(env)
 	return sslbool
 }
+
+func parseInt(env string) int {
+	i, _ := strconv.Atoi(env)
+	return i
+}
+
+// splitList splits a comma separated list, ignoring empty elements
+func splitList(env string) []string {
+	list := []string{}
+	for _, item := range strings.Split(env, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,166 @@
+package expogluster
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/log"
+)
+
+// CORSConfig holds the cross-origin policy of the API, it is disabled when no origins are allowed
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	AllowCredentials bool
+	MaxAge           int
+}
+
+// NewCORSConfig creates the cross-origin policy from environment variables
+func NewCORSConfig() CORSConfig {
+	config := CORSConfig{
+		AllowedOrigins:   splitList(getEnv("PROM_CORS_ORIGINS", "")),
+		AllowedMethods:   splitList(strings.ToUpper(getEnv("PROM_CORS_METHODS", "GET,HEAD"))),
+		AllowedHeaders:   splitList(getEnv("PROM_CORS_HEADERS", "Accept,Authorization,Content-Type")),
+		AllowCredentials: parseBool(getEnv("PROM_CORS_CREDENTIALS", "false")),
+		MaxAge:           parseInt(getEnv("PROM_CORS_MAX_AGE", "600")),
+	}
+	if err := config.validate(); err != nil {
+		log.Fatalf("Invalid CORS configuration: %v", err)
+	}
+	return config
+}
+
+// validate rejects a wildcard origin with credentials, it would expose the authenticated API to any site
+func (c CORSConfig) validate() error {
+	if !c.AllowCredentials {
+		return nil
+	}
+	for _, o := range c.AllowedOrigins {
+		if o == "*" {
+			return errors.New("PROM_CORS_ORIGINS=* can't be used with PROM_CORS_CREDENTIALS=true")
+		}
+	}
+	return nil
+}
+
+// Enabled reports if any origin is allowed
+func (c CORSConfig) Enabled() bool {
+	return len(c.AllowedOrigins) > 0
+}
+
+func (c CORSConfig) allowOrigin(origin string) bool {
+	for _, o := range c.AllowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPreflight checks if the request is a CORS preflight request
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// allowPreflight checks if the request is a preflight request of an allowed origin. Browsers send
+// preflight requests without credentials, they are answered by the middleware without reaching the routes
+func (c CORSConfig) allowPreflight(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return c.Enabled() && origin != "" && isPreflight(r) && c.allowOrigin(origin)
+}
+
+func (c CORSConfig) allowMethod(method string) bool {
+	// preflight requests are handled by the middleware itself
+	if method == http.MethodOptions {
+		return true
+	}
+	for _, m := range c.AllowedMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (c CORSConfig) allowHeaders(requested string) bool {
+	for _, header := range splitList(requested) {
+		allowed := false
+		for _, h := range c.AllowedHeaders {
+			if h == "*" || strings.EqualFold(h, header) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+func (c CORSConfig) setOriginHeaders(w http.ResponseWriter, origin string) {
+	w.Header().Add("Vary", "Origin")
+	// the wildcard is sent when it is the only allowed origin, the matching origin is echoed otherwise
+	if len(c.AllowedOrigins) == 1 && c.AllowedOrigins[0] == "*" {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// corsMiddleware applies the cross-origin policy to API routes
+func corsMiddleware(config CORSConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if !config.Enabled() || origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !isPreflight(r) {
+				if config.allowOrigin(origin) && config.allowMethod(r.Method) {
+					config.setOriginHeaders(w, origin)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			reject := func(msg string) {
+				w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+				httpError(errors.New(msg), http.StatusForbidden, w)
+			}
+			if !config.allowOrigin(origin) {
+				reject("Origin not allowed")
+				return
+			}
+			if !config.allowMethod(r.Header.Get("Access-Control-Request-Method")) {
+				reject("Method not allowed")
+				return
+			}
+			requestedHeaders := r.Header.Get("Access-Control-Request-Headers")
+			if !config.allowHeaders(requestedHeaders) {
+				reject("Headers not allowed")
+				return
+			}
+
+			config.setOriginHeaders(w, origin)
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(config.AllowedMethods, ", "))
+			if requestedHeaders != "" {
+				w.Header().Set("Access-Control-Allow-Headers", requestedHeaders)
+			}
+			if config.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(config.MaxAge))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
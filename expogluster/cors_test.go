@@ -0,0 +1,115 @@
+package expogluster
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSAllowOrigin(t *testing.T) {
+	config := CORSConfig{AllowedOrigins: []string{"https://grafana.example.com"}}
+	for origin, expected := range map[string]bool{
+		"https://grafana.example.com":      true,
+		"HTTPS://Grafana.Example.com":      true,
+		"https://grafana.example.com.evil": false,
+		"http://grafana.example.com":       false,
+		"":                                 false,
+	} {
+		if got := config.allowOrigin(origin); got != expected {
+			t.Errorf("allowOrigin(%q) = %v, expected %v", origin, got, expected)
+		}
+	}
+
+	wildcard := CORSConfig{AllowedOrigins: []string{"*"}}
+	if !wildcard.allowOrigin("https://any.example.com") {
+		t.Error("the wildcard doesn't allow any origin")
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	config := CORSConfig{
+		AllowedOrigins: []string{"https://grafana.example.com"},
+		AllowedMethods: []string{"GET", "HEAD"},
+		AllowedHeaders: []string{"Accept", "Authorization"},
+		MaxAge:         600,
+	}
+	handler := corsMiddleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, test := range []struct {
+		name, method, origin, requestMethod, requestHeaders string
+		status                                              int
+		allowOrigin                                         string
+	}{
+		{"same origin", "GET", "", "", "", http.StatusOK, ""},
+		{"allowed origin", "GET", "https://grafana.example.com", "", "", http.StatusOK, "https://grafana.example.com"},
+		{"disallowed origin", "GET", "https://evil.example.com", "", "", http.StatusOK, ""},
+		{"disallowed method", "POST", "https://grafana.example.com", "", "", http.StatusOK, ""},
+		{"preflight", "OPTIONS", "https://grafana.example.com", "GET", "authorization", http.StatusNoContent, "https://grafana.example.com"},
+		{"preflight of disallowed origin", "OPTIONS", "https://evil.example.com", "GET", "", http.StatusForbidden, ""},
+		{"preflight of disallowed method", "OPTIONS", "https://grafana.example.com", "DELETE", "", http.StatusForbidden, ""},
+		{"preflight of disallowed headers", "OPTIONS", "https://grafana.example.com", "GET", "X-Token", http.StatusForbidden, ""},
+		{"options without preflight", "OPTIONS", "https://grafana.example.com", "", "", http.StatusOK, "https://grafana.example.com"},
+	} {
+		r := httptest.NewRequest(test.method, "/api/v1/metrics", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if test.requestMethod != "" {
+			r.Header.Set("Access-Control-Request-Method", test.requestMethod)
+		}
+		if test.requestHeaders != "" {
+			r.Header.Set("Access-Control-Request-Headers", test.requestHeaders)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%v: status %v, expected %v", test.name, w.Code, test.status)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != test.allowOrigin {
+			t.Errorf("%v: allowed origin %q, expected %q", test.name, got, test.allowOrigin)
+		}
+	}
+}
+
+func TestCORSAllowPreflight(t *testing.T) {
+	config := CORSConfig{AllowedOrigins: []string{"https://grafana.example.com"}}
+	preflight := func(origin string) *http.Request {
+		r := httptest.NewRequest("OPTIONS", "/api/v1/metrics", nil)
+		r.Header.Set("Origin", origin)
+		r.Header.Set("Access-Control-Request-Method", "GET")
+		return r
+	}
+
+	if !config.allowPreflight(preflight("https://grafana.example.com")) {
+		t.Error("the preflight of an allowed origin isn't allowed")
+	}
+	if config.allowPreflight(preflight("https://evil.example.com")) {
+		t.Error("the preflight of a disallowed origin is allowed")
+	}
+	if (CORSConfig{}).allowPreflight(preflight("https://grafana.example.com")) {
+		t.Error("a preflight is allowed with CORS disabled")
+	}
+	r := httptest.NewRequest("OPTIONS", "/api/v1/metrics", nil)
+	r.Header.Set("Origin", "https://grafana.example.com")
+	if config.allowPreflight(r) {
+		t.Error("an options request without preflight headers is allowed")
+	}
+}
+
+func TestCORSValidate(t *testing.T) {
+	for _, test := range []struct {
+		config CORSConfig
+		valid  bool
+	}{
+		{CORSConfig{AllowedOrigins: []string{"*"}}, true},
+		{CORSConfig{AllowedOrigins: []string{"https://grafana.example.com"}, AllowCredentials: true}, true},
+		{CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}, false},
+		{CORSConfig{AllowedOrigins: []string{"https://grafana.example.com", "*"}, AllowCredentials: true}, false},
+	} {
+		if err := test.config.validate(); (err == nil) != test.valid {
+			t.Errorf("validate(%+v) = %v, expected valid %v", test.config, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package expogluster
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// maxEventSize limits the body of webhook requests
+const maxEventSize = 1 << 20
+
+// knownEvents are the events sent by glustereventsd, other names are rejected to bound the series of the counters
+var knownEvents = eventSet(`
+	PEER_ATTACH PEER_DETACH PEER_CONNECT PEER_DISCONNECT PEER_REJECT PEER_NOT_FOUND PEER_STORE_FAILURE
+	PEER_RPC_CREATE_FAILED
+	UNKNOWN_PEER
+	VOLUME_CREATE VOLUME_START VOLUME_STOP VOLUME_DELETE VOLUME_SET VOLUME_RESET VOLUME_ADD_BRICK
+	VOLUME_ADD_BRICK_FAILED VOLUME_REMOVE_BRICK_START VOLUME_REMOVE_BRICK_START_FAILED
+	VOLUME_REMOVE_BRICK_COMMIT VOLUME_REMOVE_BRICK_COMMIT_FAILED VOLUME_REMOVE_BRICK_STOP
+	VOLUME_REMOVE_BRICK_STOP_FAILED VOLUME_REMOVE_BRICK_FORCE VOLUME_REMOVE_BRICK_FORCE_FAILED
+	VOLUME_REMOVE_BRICK_FAILED VOLUME_REBALANCE_START VOLUME_REBALANCE_STOP VOLUME_REBALANCE_FAILED
+	VOLUME_REBALANCE_COMPLETE
+	BRICK_CONNECTED BRICK_DISCONNECTED BRICK_START_FAILED BRICK_STOP_FAILED
+	BRICKPATH_RESOLVE_FAILED
+	BRICK_RESET_START BRICK_RESET_COMMIT BRICK_REPLACE
+	SVC_CONNECTED SVC_DISCONNECTED SVC_MANAGER_FAILED
+	AFR_QUORUM_MET AFR_QUORUM_FAIL AFR_SUBVOL_UP AFR_SUBVOLS_DOWN AFR_SPLIT_BRAIN
+	EC_MIN_BRICKS_NOT_UP EC_MIN_BRICKS_UP
+	QUORUM_LOST QUORUM_REGAINED
+	QUOTA_ENABLE QUOTA_DISABLE QUOTA_SET_USAGE_LIMIT QUOTA_SET_OBJECTS_LIMIT QUOTA_REMOVE_USAGE_LIMIT
+	QUOTA_REMOVE_OBJECTS_LIMIT QUOTA_ALERT_TIME QUOTA_SOFT_TIMEOUT QUOTA_HARD_TIMEOUT
+	QUOTA_DEFAULT_SOFT_LIMIT QUOTA_CROSSED_SOFT_LIMIT
+	BITROT_ENABLE BITROT_DISABLE BITROT_SCRUB_THROTTLE BITROT_SCRUB_FREQ BITROT_SCRUB_OPTION BITROT_SCRUB_ONDEMAND
+	BITROT_BAD_FILE
+	GEOREP_CREATE GEOREP_START GEOREP_STOP GEOREP_PAUSE GEOREP_RESUME GEOREP_DELETE GEOREP_CONFIG_SET
+	GEOREP_CONFIG_RESET GEOREP_FAULTY GEOREP_CHECKPOINT_COMPLETED
+	SNAPSHOT_CREATED SNAPSHOT_CREATE_FAILED SNAPSHOT_ACTIVATED SNAPSHOT_ACTIVATE_FAILED
+	SNAPSHOT_DEACTIVATED SNAPSHOT_DEACTIVATE_FAILED SNAPSHOT_SOFT_LIMIT_REACHED
+	SNAPSHOT_HARD_LIMIT_REACHED SNAPSHOT_RESTORED SNAPSHOT_RESTORE_FAILED SNAPSHOT_DELETED
+	SNAPSHOT_DELETE_FAILED SNAPSHOT_CLONED SNAPSHOT_CLONE_FAILED SNAPSHOT_CONFIG_UPDATED
+	SNAPSHOT_CONFIG_UPDATE_FAILED
+	CLIENT_CONNECT CLIENT_DISCONNECT CLIENT_AUTH_REJECT
+	POSIX_SAME_GFID POSIX_ALREADY_PART_OF_VOLUME POSIX_BRICK_NOT_IN_VOLFILE
+	POSIX_BRICK_VERIFICATION_FAILED POSIX_ACL_NOT_SUPPORTED POSIX_HEALTH_CHECK_FAILED
+	REBALANCE_START_FAILED REBALANCE_STATUS_UPDATE_FAILED
+	IMPORT_QUOTA_CONF_FAILED IMPORT_VOLUME_FAILED IMPORT_BRICK_FAILED
+	COMPARE_FRIEND_VOLUME_FAILED
+	NFS_GANESHA_EXPORT_FAILED
+	NOTIFY_UNKNOWN_OP
+`)
+
+// eventSet builds the set of the event names separated by spaces
+func eventSet(names string) map[string]bool {
+	set := make(map[string]bool)
+	for _, name := range strings.Fields(names) {
+		set[name] = true
+	}
+	return set
+}
+
+// eventCollectors maps event prefixes to the collector refreshed when the event is received
+var eventCollectors = []struct {
+	prefix    string
+	collector string
+}{
+	{"PEER_", "peer"},
+	{"BRICK_", "status"},
+	{"SVC_", "status"},
+	{"AFR_", "heal"},
+	{"EC_", "heal"},
+	{"QUOTA_", "quota"},
+	{"VOLUME_", "volume"},
+}
+
+// Event is the json body posted by glustereventsd to webhooks
+type Event struct {
+	NodeID  string                 `json:"nodeid"`
+	Ts      int64                  `json:"ts"`
+	Event   string                 `json:"event"`
+	Message map[string]interface{} `json:"message"`
+}
+
+// Volume returns the volume of the event, VOLUME_* events name it "name"
+func (ev Event) Volume() string {
+	if volume, ok := ev.Message["volume"].(string); ok {
+		return volume
+	}
+	if strings.HasPrefix(ev.Event, "VOLUME_") {
+		if volume, ok := ev.Message["name"].(string); ok {
+			return volume
+		}
+	}
+	return ""
+}
+
+func (ev Event) validate() error {
+	if !knownEvents[ev.Event] {
+		return fmt.Errorf("unknown event: %q", ev.Event)
+	}
+	if ev.NodeID == "" {
+		return errors.New("missing nodeid")
+	}
+	if ev.Ts <= 0 {
+		return errors.New("missing ts")
+	}
+	return nil
+}
+
+type eventKey struct {
+	event  string
+	volume string
+}
+
+// Events counts the events received from glustereventsd and keeps the last ones
+type Events struct {
+	// Secret validates the JWT token sent by glustereventsd, events aren't authenticated when empty
+	Secret string
+	// History is the number of events kept
+	History int
+
+	mu     sync.Mutex
+	counts map[eventKey]float64
+	last   []Event
+}
+
+// NewEvents creates the events receiver from environment variables, it returns nil unless the
+// receiver is enabled. Events are posted without basic auth, they are only authenticated by the secret
+func NewEvents() *Events {
+	if !parseBool(getEnv("PROM_EVENTS", "false")) {
+		return nil
+	}
+	secret := getEnv("PROM_EVENTS_SECRET", "")
+	if secret == "" {
+		log.Warn("PROM_EVENTS_SECRET is empty, events are accepted from anyone reaching the exporter")
+	}
+	history := parseInt(getEnv("PROM_EVENTS_HISTORY", "100"))
+	if history < 0 {
+		log.Fatalf("PROM_EVENTS_HISTORY must not be negative: %v", history)
+	}
+	return &Events{
+		Secret:  secret,
+		History: history,
+	}
+}
+
+// Add counts the event and keeps it in the history
+func (es *Events) Add(event Event) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if es.counts == nil {
+		es.counts = make(map[eventKey]float64)
+	}
+	es.counts[eventKey{event.Event, event.Volume()}]++
+
+	es.last = append(es.last, event)
+	if len(es.last) > es.History {
+		es.last = es.last[len(es.last)-es.History:]
+	}
+}
+
+// Last returns the last events, the newest first
+func (es *Events) Last() []Event {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	events := make([]Event, 0, len(es.last))
+	for i := len(es.last) - 1; i >= 0; i-- {
+		events = append(events, es.last[i])
+	}
+	return events
+}
+
+// Collect sends the events counters
+func (es *Events) Collect(ch chan<- prometheus.Metric) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	for key, count := range es.counts {
+		ch <- prometheus.MustNewConstMetric(
+			eventsTotal, prometheus.CounterValue, count, key.event, key.volume,
+		)
+	}
+}
+
+// authorize validates the HS256 JWT token of the request with the secret, glustereventsd
+// doesn't sign the requests when the webhook has no secret
+func (es *Events) authorize(r *http.Request) error {
+	if es.Secret == "" {
+		return nil
+	}
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+		return errors.New("missing bearer token")
+	}
+	parts := strings.Split(auth[7:], ".")
+	if len(parts) != 3 {
+		return errors.New("malformed token")
+	}
+
+	encoding := base64.RawURLEncoding
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	headerJSON, err := encoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(headerJSON, &header) != nil || header.Alg != "HS256" {
+		return errors.New("unsupported token algorithm")
+	}
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return errors.New("malformed token signature")
+	}
+	mac := hmac.New(sha256.New, []byte(es.Secret))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return errors.New("invalid token signature")
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	claimsJSON, err := encoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(claimsJSON, &claims) != nil {
+		return errors.New("malformed token claims")
+	}
+	if claims.Exp != 0 && time.Now().Unix() > claims.Exp {
+		return errors.New("token expired")
+	}
+	return nil
+}
+
+func (e *Exporter) receiveEventHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := e.Events.authorize(r); err != nil {
+		httpError(err, http.StatusUnauthorized, w)
+		return
+	}
+
+	var event Event
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEventSize))
+	if err := decoder.Decode(&event); err != nil {
+		httpError(fmt.Errorf("invalid event: %v", err), http.StatusBadRequest, w)
+		return
+	}
+	if err := event.validate(); err != nil {
+		httpError(err, http.StatusBadRequest, w)
+		return
+	}
+
+	e.Events.Add(event)
+	for _, c := range eventCollectors {
+		if strings.HasPrefix(event.Event, c.prefix) {
+			e.triggerRefresh(c.collector)
+			break
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (e *Exporter) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, e.Events.Last())
+}
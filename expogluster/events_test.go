@@ -0,0 +1,168 @@
+package expogluster
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// eventsToken signs a token as glustereventsd does for webhooks with a secret
+func eventsToken(alg, secret string, exp time.Time) string {
+	encoding := base64.RawURLEncoding
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{"iss": "eventsapi", "iat": time.Now().Unix(), "exp": exp.Unix()})
+	unsigned := encoding.EncodeToString(header) + "." + encoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + encoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestEventsAuthorize(t *testing.T) {
+	events := &Events{Secret: "secret"}
+	valid := time.Now().Add(time.Minute)
+	for _, test := range []struct {
+		name, authorization string
+		ok                  bool
+	}{
+		{"valid token", "Bearer " + eventsToken("HS256", "secret", valid), true},
+		{"lower case scheme", "bearer " + eventsToken("HS256", "secret", valid), true},
+		{"missing token", "", false},
+		{"basic auth", "Basic YWRtaW46c2VjcmV0", false},
+		{"malformed token", "Bearer abc.def", false},
+		{"wrong secret", "Bearer " + eventsToken("HS256", "wrong", valid), false},
+		{"unsupported algorithm", "Bearer " + eventsToken("none", "secret", valid), false},
+		{"expired token", "Bearer " + eventsToken("HS256", "secret", time.Now().Add(-time.Minute)), false},
+	} {
+		r := httptest.NewRequest("POST", "/api/v1/events", nil)
+		if test.authorization != "" {
+			r.Header.Set("Authorization", test.authorization)
+		}
+		if err := events.authorize(r); (err == nil) != test.ok {
+			t.Errorf("%v: authorize = %v", test.name, err)
+		}
+	}
+
+	// events aren't authenticated without secret
+	if err := (&Events{}).authorize(httptest.NewRequest("POST", "/api/v1/events", nil)); err != nil {
+		t.Errorf("authorize without secret = %v", err)
+	}
+}
+
+func TestEventValidate(t *testing.T) {
+	for _, test := range []struct {
+		event Event
+		ok    bool
+	}{
+		{Event{NodeID: "u1", Ts: 1596000000, Event: "BRICK_DISCONNECTED"}, true},
+		{Event{NodeID: "u1", Ts: 1596000000, Event: "BRICK_EXPLODED"}, false},
+		{Event{NodeID: "u1", Ts: 1596000000, Event: "brick_disconnected"}, false},
+		{Event{Ts: 1596000000, Event: "BRICK_DISCONNECTED"}, false},
+		{Event{NodeID: "u1", Event: "BRICK_DISCONNECTED"}, false},
+	} {
+		if err := test.event.validate(); (err == nil) != test.ok {
+			t.Errorf("validate(%+v) = %v", test.event, err)
+		}
+	}
+
+	for event, volume := range map[string]string{
+		`{"event":"VOLUME_START","message":{"name":"gfs"}}`:                     "gfs",
+		`{"event":"BRICK_DISCONNECTED","message":{"volume":"gfs","peer":"p1"}}`: "gfs",
+		`{"event":"PEER_CONNECT","message":{"name":"server1"}}`:                 "",
+	} {
+		var ev Event
+		if err := json.Unmarshal([]byte(event), &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.Volume() != volume {
+			t.Errorf("volume of %s is %q, expected %q", event, ev.Volume(), volume)
+		}
+	}
+}
+
+func TestEventsHistory(t *testing.T) {
+	events := &Events{History: 3}
+	for ts := int64(1); ts <= 5; ts++ {
+		events.Add(Event{NodeID: "u1", Ts: ts, Event: "VOLUME_SET", Message: map[string]interface{}{"name": "gfs"}})
+	}
+	last := events.Last()
+	if len(last) != 3 || last[0].Ts != 5 || last[2].Ts != 3 {
+		t.Errorf("last events %+v, expected the 3 newest first", last)
+	}
+	if events.counts[eventKey{"VOLUME_SET", "gfs"}] != 5 {
+		t.Errorf("counts %v, expected 5 events", events.counts)
+	}
+
+	// the events are counted without history
+	events = &Events{}
+	events.Add(Event{NodeID: "u1", Ts: 1, Event: "PEER_CONNECT"})
+	if last := events.Last(); len(last) != 0 || events.counts[eventKey{"PEER_CONNECT", ""}] != 1 {
+		t.Errorf("last events %+v and counts %v without history", last, events.counts)
+	}
+}
+
+func TestReceiveEventHandler(t *testing.T) {
+	runner := &fixtureRunner{fixtures: map[string]string{"volume info": "volume_info_single.xml"}}
+	e := &Exporter{
+		Backend:    &CLI{Runner: runner},
+		Volumes:    []string{allVolumes},
+		Collectors: []string{"volume", "peer"},
+		Quota:      true,
+		Events:     &Events{Secret: "secret", History: 10},
+	}
+	e.Refresh()
+	if calls := runner.count("volume quota gfs list"); calls != 1 {
+		t.Fatalf("quota read %d times by the refresh", calls)
+	}
+
+	post := func(body, token string) int {
+		r := httptest.NewRequest("POST", "/api/v1/events", bytes.NewBufferString(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		e.receiveEventHandler(w, r)
+		return w.Code
+	}
+	token := eventsToken("HS256", "secret", time.Now().Add(time.Minute))
+
+	if code := post(`{"nodeid":"u1","ts":1596000000,"event":"PEER_CONNECT"}`, ""); code != http.StatusUnauthorized {
+		t.Errorf("event without token: status %d", code)
+	}
+	if code := post(`{"nodeid":"u1","ts":1596000000,"event":"PEER_EXPLODED"}`, token); code != http.StatusBadRequest {
+		t.Errorf("unknown event: status %d", code)
+	}
+	if code := post(`{"nodeid":"u1",`, token); code != http.StatusBadRequest {
+		t.Errorf("malformed event: status %d", code)
+	}
+	if len(e.Events.Last()) != 0 {
+		t.Errorf("rejected events are kept: %+v", e.Events.Last())
+	}
+
+	// the collector of the event is refreshed in background
+	if code := post(`{"nodeid":"u1","ts":1596000000,"event":"QUOTA_CROSSED_SOFT_LIMIT","message":{"volume":"gfs"}}`, token); code != http.StatusAccepted {
+		t.Errorf("quota event: status %d", code)
+	}
+	waitFor(t, "the refresh of the quotas", func() bool { return runner.count("volume quota gfs list") == 2 })
+	if code := post(`{"nodeid":"u1","ts":1596000001,"event":"PEER_DISCONNECT","message":{"peer":"server2"}}`, token); code != http.StatusAccepted {
+		t.Errorf("peer event: status %d", code)
+	}
+	waitFor(t, "the refresh of the peers", func() bool { return runner.count("peer status") == 2 })
+	if calls := runner.count("volume info"); calls != 1 {
+		t.Errorf("volume info read %d times, only the collector of the event is refreshed", calls)
+	}
+	if last := e.Events.Last(); len(last) != 2 || last[0].Event != "PEER_DISCONNECT" {
+		t.Errorf("last events %+v", last)
+	}
+
+	// disabled collectors aren't refreshed
+	e.RefreshCollector("status")
+	if calls := runner.count("volume status all detail"); calls != 0 {
+		t.Errorf("disabled status collector refreshed %d times", calls)
+	}
+}
@@ -0,0 +1,230 @@
+package expogluster
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	brickGrowthRate = newDesc(
+		prometheus.BuildFQName(namespace, "", "brick_usage_growth_bytes_per_second"),
+		"Growth rate of the used size of the brick, estimated by linear regression over the forecast window",
+		[]string{"volume", "brick"}, nil)
+
+	brickSecondsUntilFull = newDesc(
+		prometheus.BuildFQName(namespace, "", "brick_seconds_until_full"),
+		"Estimated seconds until the brick is full, only reported while its usage grows",
+		[]string{"volume", "brick"}, nil)
+
+	volumeGrowthRate = newDesc(
+		prometheus.BuildFQName(namespace, "", "volume_usage_growth_bytes_per_second"),
+		"Growth rate of the usable used size of the volume, estimated by linear regression over the forecast window",
+		[]string{"volume"}, nil)
+
+	volumeSecondsUntilFull = newDesc(
+		prometheus.BuildFQName(namespace, "", "volume_seconds_until_full"),
+		"Estimated seconds until the volume is full, only reported while its usage grows",
+		[]string{"volume"}, nil)
+)
+
+// Forecast keeps a rolling window of free size samples of bricks and volumes
+// to estimate when they will be full
+type Forecast struct {
+	// Window is the period of the samples used by the regression
+	Window time.Duration
+	// Interval is the minimum time between two samples of a series
+	Interval time.Duration
+	// StateFile keeps the samples across restarts, samples are only kept in memory when it is
+	// set to an empty string
+	StateFile string
+
+	mu     sync.Mutex
+	loaded bool
+	series map[string]*forecastSeries
+}
+
+type forecastSample struct {
+	Time int64   `json:"t"`
+	Free float64 `json:"free"`
+}
+
+type forecastSeries struct {
+	Volume  string           `json:"volume"`
+	Brick   string           `json:"brick,omitempty"`
+	Samples []forecastSample `json:"samples"`
+}
+
+// NewForecast creates the forecast from environment variables
+func NewForecast() *Forecast {
+	return &Forecast{
+		Window:    time.Duration(parseInt(getEnv("PROM_FORECAST_WINDOW", "604800"))) * time.Second,
+		Interval:  time.Duration(parseInt(getEnv("PROM_FORECAST_INTERVAL", "300"))) * time.Second,
+		StateFile: getEnv("PROM_FORECAST_STATE_FILE", "/var/lib/gluster_exporter/forecast.json"),
+	}
+}
+
+// load reads the samples of the state file, the caller must hold the lock
+func (f *Forecast) load() {
+	if f.loaded {
+		return
+	}
+	f.loaded = true
+	f.series = make(map[string]*forecastSeries)
+	if f.StateFile == "" {
+		return
+	}
+	content, err := ioutil.ReadFile(f.StateFile)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err == nil {
+		err = json.Unmarshal(content, &f.series)
+	}
+	if err != nil {
+		log.Warnf("Cannot read forecast state file %v: %v", f.StateFile, err)
+		f.series = make(map[string]*forecastSeries)
+	}
+}
+
+// save writes the samples to the state file, the caller must hold the lock
+func (f *Forecast) save() error {
+	if f.StateFile == "" {
+		return nil
+	}
+	content, err := json.Marshal(f.series)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.StateFile), 0755); err != nil {
+		return err
+	}
+	// the state is replaced atomically so a crash doesn't leave a truncated file
+	tmp := f.StateFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.StateFile)
+}
+
+// Add records the free size of the volume, and of the brick when brick isn't empty.
+// A sample is ignored when the last one of the series is newer than the interval
+func (f *Forecast) Add(now time.Time, volume, brick string, free uint64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.load()
+
+	key := forecastKey(volume, brick)
+	series, ok := f.series[key]
+	if !ok {
+		series = &forecastSeries{Volume: volume, Brick: brick}
+		f.series[key] = series
+	}
+	if n := len(series.Samples); n > 0 && now.Sub(time.Unix(series.Samples[n-1].Time, 0)) < f.Interval {
+		return false
+	}
+	series.Samples = append(series.Samples, forecastSample{Time: now.Unix(), Free: float64(free)})
+	return true
+}
+
+// forecastKey identifies the series of the volume, or of the brick when brick isn't empty
+func forecastKey(volume, brick string) string {
+	return volume + "\x00" + brick
+}
+
+// Retain drops the series which aren't in keys, their volume or brick was removed or isn't
+// reported by this node anymore. It returns true when a series was dropped
+func (f *Forecast) Retain(keys map[string]bool) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.load()
+
+	dropped := false
+	for key := range f.series {
+		if !keys[key] {
+			delete(f.series, key)
+			dropped = true
+		}
+	}
+	return dropped
+}
+
+// Save drops the samples older than the window and writes the state file
+func (f *Forecast) Save(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.load()
+
+	oldest := now.Add(-f.Window).Unix()
+	for key, series := range f.series {
+		i := 0
+		for i < len(series.Samples) && series.Samples[i].Time < oldest {
+			i++
+		}
+		series.Samples = series.Samples[i:]
+		if len(series.Samples) == 0 {
+			delete(f.series, key)
+		}
+	}
+	if err := f.save(); err != nil {
+		log.Warnf("Cannot write forecast state file %v: %v", f.StateFile, err)
+	}
+}
+
+// growthRate returns the growth rate of the used size in bytes per second,
+// the opposite of the slope of the least squares regression of the free size
+func (s *forecastSeries) growthRate() (float64, bool) {
+	n := float64(len(s.Samples))
+	if n < 2 {
+		return 0, false
+	}
+	t0 := s.Samples[0].Time
+	var sumT, sumF, sumTT, sumTF float64
+	for _, sample := range s.Samples {
+		t := float64(sample.Time - t0)
+		sumT += t
+		sumF += sample.Free
+		sumTT += t * t
+		sumTF += t * sample.Free
+	}
+	denominator := n*sumTT - sumT*sumT
+	if denominator == 0 {
+		return 0, false
+	}
+	return -(n*sumTF - sumT*sumF) / denominator, true
+}
+
+// Describe sends the descriptors of the forecast metrics
+func (f *Forecast) Describe(ch chan<- *prometheus.Desc) {
+	ch <- brickGrowthRate
+	ch <- brickSecondsUntilFull
+	ch <- volumeGrowthRate
+	ch <- volumeSecondsUntilFull
+}
+
+// Collect sends the growth rates and the estimated time until full of the series
+func (f *Forecast) Collect(ch chan<- prometheus.Metric) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, series := range f.series {
+		rate, ok := series.growthRate()
+		if !ok {
+			continue
+		}
+		growthDesc, untilFullDesc, labels := volumeGrowthRate, volumeSecondsUntilFull, []string{series.Volume}
+		if series.Brick != "" {
+			growthDesc, untilFullDesc, labels = brickGrowthRate, brickSecondsUntilFull, []string{series.Volume, series.Brick}
+		}
+		ch <- prometheus.MustNewConstMetric(growthDesc, prometheus.GaugeValue, rate, labels...)
+		if rate > 0 {
+			free := series.Samples[len(series.Samples)-1].Free
+			ch <- prometheus.MustNewConstMetric(untilFullDesc, prometheus.GaugeValue, free/rate, labels...)
+		}
+	}
+}
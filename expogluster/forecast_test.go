@@ -0,0 +1,118 @@
+package expogluster
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestForecastGrowthRate(t *testing.T) {
+	samples := func(values ...float64) *forecastSeries {
+		series := &forecastSeries{}
+		for i, free := range values {
+			series.Samples = append(series.Samples, forecastSample{Time: 1596000000 + int64(i)*60, Free: free})
+		}
+		return series
+	}
+
+	for _, test := range []struct {
+		name   string
+		series *forecastSeries
+		ok     bool
+		rate   float64
+	}{
+		{"filling", samples(6000, 5400, 4800, 4200), true, 10},
+		{"freeing", samples(1000, 1600), true, -10},
+		{"stable", samples(1000, 1000, 1000), true, 0},
+		// least squares of (0, 1000), (60, 700), (120, 800), (180, 400): slope -51000/18000
+		{"noisy", samples(1000, 700, 800, 400), true, 51000.0 / 18000},
+		{"single sample", samples(1000), false, 0},
+		{"same time", &forecastSeries{Samples: []forecastSample{{Time: 1, Free: 2}, {Time: 1, Free: 1}}}, false, 0},
+	} {
+		rate, ok := test.series.growthRate()
+		if ok != test.ok || math.Abs(rate-test.rate) > 1e-9 {
+			t.Errorf("%v: growth rate %v (%v), expected %v (%v)", test.name, rate, ok, test.rate, test.ok)
+		}
+	}
+}
+
+func TestForecastAddAndRetain(t *testing.T) {
+	f := &Forecast{Window: time.Hour, Interval: 5 * time.Minute, StateFile: ""}
+	now := time.Unix(1596000000, 0)
+
+	if !f.Add(now, "gfs", "", 1000) || !f.Add(now, "gfs", "server1:/data/brick", 500) {
+		t.Fatal("first samples ignored")
+	}
+	// samples newer than the interval are ignored
+	if f.Add(now.Add(time.Minute), "gfs", "", 900) {
+		t.Error("sample within the interval added")
+	}
+	if !f.Add(now.Add(5*time.Minute), "gfs", "", 900) {
+		t.Error("sample after the interval ignored")
+	}
+	if samples := f.series[forecastKey("gfs", "")].Samples; len(samples) != 2 {
+		t.Errorf("samples %+v", samples)
+	}
+
+	// series of removed volumes and bricks are dropped
+	if f.Retain(map[string]bool{forecastKey("gfs", ""): true, forecastKey("gfs", "server1:/data/brick"): true}) {
+		t.Error("series dropped while all are kept")
+	}
+	if !f.Retain(map[string]bool{forecastKey("gfs", ""): true}) {
+		t.Error("no series dropped")
+	}
+	if _, ok := f.series[forecastKey("gfs", "server1:/data/brick")]; ok || len(f.series) != 1 {
+		t.Errorf("series %v", f.series)
+	}
+}
+
+func TestForecastSaveAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forecast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state", "forecast.json")
+
+	f := &Forecast{Window: time.Hour, Interval: time.Minute, StateFile: stateFile}
+	now := time.Unix(1596000000, 0)
+	f.Add(now.Add(-2*time.Hour), "backup", "", 300)
+	for i := 0; i < 3; i++ {
+		f.Add(now.Add(time.Duration(i-3)*time.Minute), "gfs", "", uint64(1000-100*i))
+		f.Add(now.Add(time.Duration(i-3)*time.Minute), "gfs", "server1:/data/brick", uint64(500-50*i))
+	}
+	f.Save(now)
+
+	// the samples older than the window are dropped before writing the state
+	if _, err := os.Stat(stateFile + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary state file left: %v", err)
+	}
+	loaded := &Forecast{Window: time.Hour, Interval: time.Minute, StateFile: stateFile}
+	loaded.Retain(map[string]bool{
+		forecastKey("backup", ""):                 true,
+		forecastKey("gfs", ""):                    true,
+		forecastKey("gfs", "server1:/data/brick"): true,
+	})
+	if len(loaded.series) != 2 {
+		t.Fatalf("loaded series %v, expected the series of gfs", loaded.series)
+	}
+	brick := loaded.series[forecastKey("gfs", "server1:/data/brick")]
+	if brick == nil || brick.Volume != "gfs" || brick.Brick != "server1:/data/brick" || len(brick.Samples) != 3 {
+		t.Fatalf("loaded brick series %+v", brick)
+	}
+	if rate, ok := brick.growthRate(); !ok || math.Abs(rate-50.0/60) > 1e-9 {
+		t.Errorf("growth rate of the loaded series %v", rate)
+	}
+
+	// a corrupted state file is ignored
+	if err := ioutil.WriteFile(stateFile, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	corrupted := &Forecast{Window: time.Hour, Interval: time.Minute, StateFile: stateFile}
+	if !corrupted.Add(now, "gfs", "", 1000) || len(corrupted.series) != 1 {
+		t.Errorf("series of a corrupted state %v", corrupted.series)
+	}
+}
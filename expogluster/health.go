@@ -0,0 +1,97 @@
+package expogluster
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReadinessCheck is a single check of the readiness endpoint
+type ReadinessCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Readiness is the body returned by the readiness endpoint
+type Readiness struct {
+	Ready       bool             `json:"ready"`
+	LastSuccess *time.Time       `json:"lastSuccess,omitempty"`
+	Checks      []ReadinessCheck `json:"checks"`
+}
+
+func healthyHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{"status": "healthy"})
+}
+
+func (e *Exporter) readyHandler(w http.ResponseWriter, r *http.Request) {
+	readiness := e.Readiness()
+	if !readiness.Ready {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	writeJSON(w, readiness)
+}
+
+// Readiness checks if glusterd is running and the last "gluster volume info" succeeded within ReadyMaxAge
+func (e *Exporter) Readiness() Readiness {
+	readiness := Readiness{Ready: true}
+	check := func(name string, err error) {
+		c := ReadinessCheck{Name: name, OK: err == nil}
+		if err != nil {
+			c.Error = err.Error()
+			readiness.Ready = false
+		}
+		readiness.Checks = append(readiness.Checks, c)
+	}
+
+	check("glusterd_pidfile", checkPidFile(e.GlusterdPidFile))
+
+	e.mu.RLock()
+	snapshot := e.snapshot
+	lastUp := e.lastUp
+	e.mu.RUnlock()
+	// the volume info is refreshed in background when it is too old, so readiness doesn't depend
+	// on scrapes and the probes of the orchestrator don't wait for gluster
+	if snapshot == nil || time.Since(snapshot.Time) > e.ReadyMaxAge {
+		e.triggerRefresh("volume")
+	}
+
+	var volumeInfoErr error
+	if lastUp.IsZero() {
+		volumeInfoErr = fmt.Errorf("gluster volume info never succeeded")
+	} else {
+		readiness.LastSuccess = &lastUp
+		if age := time.Since(lastUp); age > e.ReadyMaxAge {
+			volumeInfoErr = fmt.Errorf("last successful gluster volume info was %v ago", age.Round(time.Second))
+		}
+	}
+	check("volume_info", volumeInfoErr)
+
+	return readiness
+}
+
+// checkPidFile checks if the pid file exists and holds a pid
+func checkPidFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	_, err := readPidFile(path)
+	return err
+}
+
+// readPidFile reads the pid held by the pid file
+func readPidFile(path string) (int, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid pid in %v", path)
+	}
+	return pid, nil
+}
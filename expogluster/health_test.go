@@ -0,0 +1,115 @@
+package expogluster
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckPidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"valid.pid":   "1234\n",
+		"invalid.pid": "glusterd\n",
+		"empty.pid":   "",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if pid, err := readPidFile(filepath.Join(dir, "valid.pid")); err != nil || pid != 1234 {
+		t.Errorf("readPidFile = %v, %v", pid, err)
+	}
+	for _, test := range []struct {
+		path string
+		ok   bool
+	}{
+		{"", true},
+		{filepath.Join(dir, "valid.pid"), true},
+		{filepath.Join(dir, "invalid.pid"), false},
+		{filepath.Join(dir, "empty.pid"), false},
+		{filepath.Join(dir, "missing.pid"), false},
+	} {
+		if err := checkPidFile(test.path); (err == nil) != test.ok {
+			t.Errorf("checkPidFile(%q) = %v", test.path, err)
+		}
+	}
+}
+
+// waitFor waits until the condition is true, the refreshes of the tests run in background
+func waitFor(t *testing.T, what string, condition func() bool) {
+	for deadline := time.Now().Add(5 * time.Second); !condition(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %v", what)
+		}
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	runner := &fixtureRunner{fixtures: map[string]string{"volume info": "volume_info_single.xml"}}
+	e := &Exporter{
+		Backend:     &CLI{Runner: runner},
+		Collectors:  []string{"volume"},
+		ReadyMaxAge: time.Minute,
+	}
+	ready := func() (int, Readiness) {
+		w := httptest.NewRecorder()
+		e.readyHandler(w, httptest.NewRequest("GET", "/-/ready", nil))
+		var readiness Readiness
+		if err := json.Unmarshal(w.Body.Bytes(), &readiness); err != nil {
+			t.Fatalf("%v: %s", err, w.Body)
+		}
+		return w.Code, readiness
+	}
+
+	// without snapshot, the probe doesn't wait for gluster and the volume info is read in background
+	code, readiness := ready()
+	if code != http.StatusServiceUnavailable || readiness.Ready || readiness.LastSuccess != nil {
+		t.Errorf("ready before the first refresh: %d %+v", code, readiness)
+	}
+	if len(readiness.Checks) != 2 || readiness.Checks[1].Name != "volume_info" || readiness.Checks[1].OK {
+		t.Errorf("checks %+v", readiness.Checks)
+	}
+	waitFor(t, "the first refresh", func() bool {
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+		return !e.lastUp.IsZero()
+	})
+
+	code, readiness = ready()
+	if code != http.StatusOK || !readiness.Ready || readiness.LastSuccess == nil {
+		t.Errorf("not ready after a successful refresh: %d %+v", code, readiness)
+	}
+	if calls := runner.count("volume info"); calls != 1 {
+		t.Errorf("volume info ran %d times with a fresh snapshot", calls)
+	}
+
+	// a stale snapshot is refreshed in background, readiness reports the last success meanwhile
+	e.mu.Lock()
+	e.snapshot.Time = time.Now().Add(-2 * time.Minute)
+	e.lastUp = e.snapshot.Time
+	e.mu.Unlock()
+	delete(runner.fixtures, "volume info")
+	code, readiness = ready()
+	if code != http.StatusServiceUnavailable || readiness.Checks[1].Error == "" {
+		t.Errorf("ready with a stale volume info: %d %+v", code, readiness)
+	}
+	waitFor(t, "the refresh of the stale snapshot", func() bool { return runner.count("volume info") == 2 })
+
+	// a missing pidfile fails the readiness
+	e.GlusterdPidFile = filepath.Join("testdata", "missing.pid")
+	if _, readiness = ready(); readiness.Ready || readiness.Checks[0].Name != "glusterd_pidfile" || readiness.Checks[0].OK {
+		t.Errorf("ready without pidfile: %+v", readiness)
+	}
+}
@@ -0,0 +1,88 @@
+package expogluster
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// uuidRetryInterval is the delay before reading the local UUID again after a failure
+const uuidRetryInterval = time.Minute
+
+// localUUID returns the peer UUID of the local glusterd, read from glusterd.info or
+// with "gluster system:: uuid get". It identifies the node, unlike Hostname which is the listen address
+func (e *Exporter) localUUID() (string, error) {
+	e.uuidMu.Lock()
+	defer e.uuidMu.Unlock()
+	if e.uuid != "" {
+		return e.uuid, nil
+	}
+	// the failure is kept for a while, so the UUID isn't read again for each brick of the collection
+	if e.uuidErr != nil && time.Since(e.uuidRead) < uuidRetryInterval {
+		return "", e.uuidErr
+	}
+
+	uuid, err := ReadGlusterdUUID(e.GlusterdInfoFile)
+	if err != nil {
+		if cli, ok := e.backend().(*CLI); ok {
+			uuid, err = systemUUID(cli.Runner)
+		}
+	}
+	if err != nil {
+		e.uuidErr, e.uuidRead = err, time.Now()
+		return "", err
+	}
+	e.uuid = uuid
+	return uuid, nil
+}
+
+// instance identifies the node in the pushed metrics by its UUID, or its hostname when the UUID is unknown,
+// the listen address can be the same on all nodes
+func (e *Exporter) instance() string {
+	if uuid, err := e.localUUID(); err == nil {
+		return uuid
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// systemUUID executes "gluster system:: uuid get", its output is "UUID: <uuid>"
+func systemUUID(runner Runner) (string, error) {
+	output, err := runner.Run("gluster", "system::", "uuid", "get")
+	if err != nil {
+		return "", fmt.Errorf("gluster system:: uuid get failed: %v: %s", err, output)
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if value := strings.TrimPrefix(line, "UUID:"); value != line {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", fmt.Errorf("UUID not found in output of gluster system:: uuid get")
+}
+
+// isLocalBrick checks if the brick runs on the local node, comparing its peer UUID with the local one.
+// The hostname of the brick is compared with the local host when the local UUID is unknown
+func (e *Exporter) isLocalBrick(hostname, peerID string) bool {
+	uuid, err := e.localUUID()
+	if err != nil || peerID == "" {
+		return isLocalHost(hostname)
+	}
+	return peerID == uuid
+}
+
+// reportBrick checks if the metrics of the brick are reported, only local bricks are reported in local only mode
+func (e *Exporter) reportBrick(hostname, peerID string) bool {
+	return !e.LocalOnly || e.isLocalBrick(hostname, peerID)
+}
+
+// hostUUIDs maps the name of the bricks, "host:/path", to the UUID of their peer
+func hostUUIDs(volumeInfo VolumeInfoJSON) map[string]string {
+	uuids := make(map[string]string)
+	for _, volume := range volumeInfo.Volumes() {
+		for _, brick := range volume.Bricks {
+			uuids[brick.Name] = brick.HostUUID
+		}
+	}
+	return uuids
+}
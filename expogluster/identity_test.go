@@ -0,0 +1,116 @@
+package expogluster
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLocalUUID(t *testing.T) {
+	calls := 0
+	output, failure := []byte(""), errors.New("exit status 1")
+	e := &Exporter{
+		GlusterdInfoFile: filepath.Join(os.TempDir(), "missing", "glusterd.info"),
+		Backend: &CLI{Runner: runnerFunc(func(name string, args ...string) ([]byte, error) {
+			calls++
+			return output, failure
+		})},
+	}
+
+	// the failure is kept until the retry interval
+	for i := 0; i < 3; i++ {
+		if uuid, err := e.localUUID(); err == nil {
+			t.Fatalf("UUID %v without glusterd", uuid)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("gluster system:: uuid get ran %d times, expected once", calls)
+	}
+
+	output, failure = []byte("UUID: 5b0e2c1a-0000-4000-8000-000000000001\n"), nil
+	e.uuidRead = e.uuidRead.Add(-uuidRetryInterval - time.Second)
+	for i := 0; i < 3; i++ {
+		if uuid, err := e.localUUID(); uuid != "5b0e2c1a-0000-4000-8000-000000000001" || err != nil {
+			t.Fatalf("UUID %v (%v) after the retry interval", uuid, err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("gluster system:: uuid get ran %d times, the UUID isn't kept", calls)
+	}
+
+	// the UUID is read from glusterd.info without running gluster
+	dir, err := ioutil.TempDir("", "glusterd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	e = &Exporter{GlusterdInfoFile: filepath.Join(dir, "glusterd.info"), Backend: &REST{}}
+	if err := ioutil.WriteFile(e.GlusterdInfoFile, []byte("UUID=5b0e2c1a-0000-4000-8000-000000000002\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if uuid, err := e.localUUID(); uuid != "5b0e2c1a-0000-4000-8000-000000000002" || err != nil {
+		t.Errorf("UUID %v (%v) from glusterd.info", uuid, err)
+	}
+}
+
+func TestIsLocalBrick(t *testing.T) {
+	known := &Exporter{uuid: "5b0e2c1a-0000-4000-8000-000000000001"}
+	unknown := &Exporter{GlusterdInfoFile: filepath.Join(os.TempDir(), "missing", "glusterd.info"), Backend: &REST{}}
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name     string
+		e        *Exporter
+		hostname string
+		peerID   string
+		local    bool
+	}{
+		{"local UUID", known, "server1", "5b0e2c1a-0000-4000-8000-000000000001", true},
+		{"remote UUID", known, "localhost", "5b0e2c1a-0000-4000-8000-000000000002", false},
+		{"brick without UUID", known, "localhost", "", true},
+		{"unknown local UUID", unknown, hostname, "5b0e2c1a-0000-4000-8000-000000000002", true},
+		{"loopback address", unknown, "127.0.0.1", "", true},
+		{"remote host", unknown, "server2.invalid", "", false},
+	} {
+		if local := test.e.isLocalBrick(test.hostname, test.peerID); local != test.local {
+			t.Errorf("%v: local is %v, expected %v", test.name, local, test.local)
+		}
+	}
+}
+
+func TestLocalOnly(t *testing.T) {
+	snapshot := &Snapshot{}
+	volume := VolumeStatusVolume{VolName: "gfs"}
+	for _, node := range []struct{ hostname, peerID string }{
+		{"server1", "5b0e2c1a-0000-4000-8000-000000000001"},
+		{"server2", "5b0e2c1a-0000-4000-8000-000000000002"},
+	} {
+		volume.Node = append(volume.Node, VolumeStatusNode{
+			Hostname: node.hostname, Path: "/data/gfs", Peerid: node.peerID, Status: "1",
+			SizeTotal: "1000", SizeFree: "500", InodesTotal: "100", InodesFree: "50",
+		})
+	}
+	snapshot.VolumeStatus.CliOutput.VolStatus.Volumes.Volume = []VolumeStatusVolume{volume}
+
+	for _, localOnly := range []bool{false, true} {
+		e := &Exporter{
+			Volumes:    []string{allVolumes},
+			Collectors: []string{"status"},
+			LocalOnly:  localOnly,
+			uuid:       "5b0e2c1a-0000-4000-8000-000000000001",
+		}
+		metrics := e.snapshotMetrics(snapshot)
+		if _, ok := metricValue(t, metrics, nodeSizeFreeBytes, map[string]string{"hostname": "server1"}); !ok {
+			t.Errorf("local only %v: local brick not reported", localOnly)
+		}
+		if _, ok := metricValue(t, metrics, nodeSizeFreeBytes, map[string]string{"hostname": "server2"}); ok == localOnly {
+			t.Errorf("local only %v: remote brick reported %v", localOnly, ok)
+		}
+	}
+}
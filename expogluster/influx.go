@@ -0,0 +1,157 @@
+package expogluster
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// maxUDPPayload keeps the datagrams under the usual MTU
+const maxUDPPayload = 1400
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// InfluxSink writes the metrics in InfluxDB line protocol, with the HTTP write API or over UDP.
+// Each sample is a measurement named after the metric, with its labels as tags and a "value" field
+type InfluxSink struct {
+	// URL is the write endpoint, "http://host:8086/write?db=gluster" for InfluxDB 1.x,
+	// "http://host:8086/api/v2/write?org=org&bucket=gluster" for InfluxDB 2.x, or "udp://host:8089"
+	URL string
+	// Token authenticates the writes to InfluxDB 2.x
+	Token string
+	// Username and Password authenticate the writes to InfluxDB 1.x, disabled when Username is empty
+	Username string
+	Password string
+	// Timeout is the deadline of each write
+	Timeout time.Duration
+}
+
+// NewInfluxSink creates the InfluxDB sink from environment variables, it returns nil when no URL is configured
+func NewInfluxSink() *InfluxSink {
+	address := getEnv("PROM_INFLUX_URL", "")
+	if address == "" {
+		return nil
+	}
+	if u, err := url.Parse(address); err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "udp") {
+		log.Fatalf("Invalid InfluxDB URL, expected http, https or udp: %v", address)
+	}
+	sink := &InfluxSink{
+		URL:      address,
+		Token:    getEnv("PROM_INFLUX_TOKEN", ""),
+		Username: getEnv("PROM_INFLUX_USERNAME", ""),
+		Password: getEnv("PROM_INFLUX_PASSWORD", ""),
+		Timeout:  time.Duration(parseInt(getEnv("PROM_INFLUX_TIMEOUT", "10"))) * time.Second,
+	}
+	// a zero timeout would disable the deadline of the writes
+	if sink.Timeout <= 0 {
+		log.Fatalf("PROM_INFLUX_TIMEOUT must be a positive number of seconds: %v", getEnv("PROM_INFLUX_TIMEOUT", ""))
+	}
+	return sink
+}
+
+// Name identifies the sink in the logs
+func (s *InfluxSink) Name() string {
+	return "InfluxDB " + s.URL
+}
+
+// Write sends the samples, in one request over HTTP or in datagrams holding whole lines over UDP
+func (s *InfluxSink) Write(samples []sample, now time.Time) error {
+	lines := make([]string, 0, len(samples))
+	for _, sample := range samples {
+		if line, ok := influxLine(sample, now); ok {
+			lines = append(lines, line)
+		}
+	}
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "udp" {
+		conn, err := net.DialTimeout("udp", u.Host, s.Timeout)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return writeDatagrams(conn, lines)
+	}
+
+	query := u.Query()
+	query.Set("precision", "ns")
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodPost, u.String(), strings.NewReader(strings.Join(lines, "")))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.Token)
+	} else if s.Username != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+	resp, err := (&http.Client{Timeout: s.Timeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status %v: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// influxLine formats the sample as a line, ending with a newline.
+// Tags with an empty value and samples which aren't finite can't be written
+func influxLine(sample sample, now time.Time) (string, bool) {
+	if math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+		return "", false
+	}
+	keys := make([]string, 0, len(sample.labels))
+	for key, value := range sample.labels {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	// InfluxDB performs best with the tags sorted by key
+	sort.Strings(keys)
+
+	line := influxMeasurementEscaper.Replace(sample.name)
+	for _, key := range keys {
+		line += "," + influxTagEscaper.Replace(key) + "=" + influxTagEscaper.Replace(sample.labels[key])
+	}
+	line += " value=" + strconv.FormatFloat(sample.value, 'g', -1, 64) + " " + strconv.FormatInt(now.UnixNano(), 10) + "\n"
+	return line, true
+}
+
+// writeDatagrams sends the lines, ending with a newline, batched in datagrams of at most maxUDPPayload bytes
+func writeDatagrams(conn net.Conn, lines []string) error {
+	datagram := ""
+	for _, line := range lines {
+		if datagram != "" && len(datagram)+len(line) > maxUDPPayload {
+			if _, err := conn.Write([]byte(datagram)); err != nil {
+				return err
+			}
+			datagram = ""
+		}
+		datagram += line
+	}
+	if datagram != "" {
+		_, err := conn.Write([]byte(datagram))
+		return err
+	}
+	return nil
+}
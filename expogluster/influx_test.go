@@ -0,0 +1,162 @@
+package expogluster
+
+import (
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// udpListener receives the datagrams sent to a local UDP port
+func udpListener(t *testing.T) (*net.UDPConn, func() []string) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive := func() []string {
+		datagrams := []string{}
+		buffer := make([]byte, 65536)
+		for {
+			conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			n, err := conn.Read(buffer)
+			if err != nil {
+				return datagrams
+			}
+			datagrams = append(datagrams, string(buffer[:n]))
+		}
+	}
+	return conn, receive
+}
+
+func TestInfluxLine(t *testing.T) {
+	now := time.Unix(1600000000, 123)
+	for _, test := range []struct {
+		sample   sample
+		expected string
+	}{
+		{sample{"gluster_up", nil, 1}, "gluster_up value=1 1600000000000000123\n"},
+		{
+			sample{"gluster_brick_up", map[string]string{"volume": "gfs", "hostname": "server1", "path": "/data/gfs"}, 0},
+			"gluster_brick_up,hostname=server1,path=/data/gfs,volume=gfs value=0 1600000000000000123\n",
+		},
+		// the separators of the measurement and of the tags are escaped
+		{
+			sample{"gluster volume,size", map[string]string{"path": "/my dir,a=b", "tag key": "v"}, 1.5},
+			`gluster\ volume\,size,path=/my\ dir\,a\=b,tag\ key=v value=1.5 1600000000000000123` + "\n",
+		},
+		// tags with an empty value are dropped
+		{sample{"gluster_up", map[string]string{"cluster": "", "volume": "gfs"}, 1}, "gluster_up,volume=gfs value=1 1600000000000000123\n"},
+		{sample{"gluster_size", nil, 1e21}, "gluster_size value=1e+21 1600000000000000123\n"},
+	} {
+		line, ok := influxLine(test.sample, now)
+		if !ok || line != test.expected {
+			t.Errorf("influxLine(%+v) = %q, expected %q", test.sample, line, test.expected)
+		}
+	}
+
+	for _, value := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if line, ok := influxLine(sample{"gluster_up", nil, value}, now); ok {
+			t.Errorf("line %q written for %v", line, value)
+		}
+	}
+}
+
+func TestWriteDatagrams(t *testing.T) {
+	listener, receive := udpListener(t)
+	defer listener.Close()
+	conn, err := net.Dial("udp", listener.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// 30 lines of 100 bytes fit in 3 datagrams of 14 lines at most
+	line := strings.Repeat("x", 99) + "\n"
+	lines := []string{}
+	for i := 0; i < 30; i++ {
+		lines = append(lines, line)
+	}
+	// a line longer than a datagram is sent alone
+	long := strings.Repeat("y", 1500) + "\n"
+	lines = append(lines, long, line)
+
+	if err := writeDatagrams(conn, lines); err != nil {
+		t.Fatal(err)
+	}
+	datagrams := receive()
+	expected := []string{
+		strings.Repeat(line, 14),
+		strings.Repeat(line, 14),
+		strings.Repeat(line, 2),
+		long,
+		line,
+	}
+	if len(datagrams) != len(expected) {
+		t.Fatalf("%d datagrams, expected %d", len(datagrams), len(expected))
+	}
+	for i := range expected {
+		if datagrams[i] != expected[i] {
+			t.Errorf("datagram %d of %d bytes, expected %d bytes", i, len(datagrams[i]), len(expected[i]))
+		}
+		if i < 3 && len(datagrams[i]) > maxUDPPayload {
+			t.Errorf("datagram %d of %d bytes exceeds %d bytes", i, len(datagrams[i]), maxUDPPayload)
+		}
+	}
+}
+
+func TestInfluxSinkWrite(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	samples := []sample{
+		{"gluster_up", map[string]string{"instance": "node1"}, 1},
+		{"gluster_heal_info_files_count", map[string]string{"instance": "node1"}, math.NaN()},
+		{"gluster_volumes_available", map[string]string{"instance": "node1"}, 2},
+	}
+	expected := "gluster_up,instance=node1 value=1 1600000000000000000\ngluster_volumes_available,instance=node1 value=2 1600000000000000000\n"
+
+	var body, authorization, precision string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, _ := ioutil.ReadAll(r.Body)
+		body, authorization, precision = string(content), r.Header.Get("Authorization"), r.URL.Query().Get("precision")
+		if r.URL.Query().Get("bucket") == "full" {
+			http.Error(w, `{"code":"forbidden"}`, http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := &InfluxSink{URL: server.URL + "/api/v2/write?org=org&bucket=gluster", Token: "token", Timeout: time.Second}
+	if err := sink.Write(samples, now); err != nil {
+		t.Fatal(err)
+	}
+	if body != expected || authorization != "Token token" || precision != "ns" {
+		t.Errorf("body %q, authorization %q, precision %q", body, authorization, precision)
+	}
+
+	sink = &InfluxSink{URL: server.URL + "/write?db=gluster", Username: "admin", Password: "secret", Timeout: time.Second}
+	if err := sink.Write(samples, now); err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "Basic YWRtaW46c2VjcmV0" {
+		t.Errorf("authorization %q, expected basic auth", authorization)
+	}
+
+	sink.URL = server.URL + "/api/v2/write?org=org&bucket=full"
+	if err := sink.Write(samples, now); err == nil || !strings.Contains(err.Error(), "forbidden") {
+		t.Errorf("rejected write returned %v", err)
+	}
+
+	listener, receive := udpListener(t)
+	defer listener.Close()
+	sink = &InfluxSink{URL: "udp://" + listener.LocalAddr().String(), Timeout: time.Second}
+	if err := sink.Write(samples, now); err != nil {
+		t.Fatal(err)
+	}
+	if datagrams := receive(); len(datagrams) != 1 || datagrams[0] != expected {
+		t.Errorf("datagrams %q, expected %q", datagrams, expected)
+	}
+}
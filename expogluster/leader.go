@@ -0,0 +1,111 @@
+package expogluster
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// cluster modes choosing the node running the cluster scoped collectors
+const (
+	// clusterModeAll runs the cluster scoped collectors on every node
+	clusterModeAll = "all"
+	// clusterModePeer elects the node with the lowest UUID among the connected peers
+	clusterModePeer = "peer"
+	// clusterModeLock elects the node holding the lock file on shared storage
+	clusterModeLock = "lock"
+)
+
+var isLeader = newDesc(
+	prometheus.BuildFQName(namespace, "exporter", "is_leader"),
+	"Displays whether or not the exporter runs the cluster scoped collectors",
+	nil, nil)
+
+// ReadGlusterdUUID reads the UUID of the local glusterd from its glusterd.info file
+func ReadGlusterdUUID(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if value := strings.TrimPrefix(scanner.Text(), "UUID="); value != scanner.Text() {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("UUID not found in %v", path)
+}
+
+// elect chooses if the node runs the cluster scoped collectors,
+// the node stays leader when the election can't be made so metrics are never lost
+func (e *Exporter) elect(snapshot *Snapshot) {
+	switch e.ClusterMode {
+	case clusterModePeer:
+		snapshot.Leader = e.lowestPeer(snapshot)
+	case clusterModeLock:
+		snapshot.Leader = e.lockLeader()
+	default:
+		snapshot.Leader = true
+	}
+}
+
+// lowestPeer checks if the local UUID is the lowest among the connected peers
+func (e *Exporter) lowestPeer(snapshot *Snapshot) bool {
+	uuid, err := e.localUUID()
+	if err != nil {
+		log.Errorf("Cannot read local peer UUID, acting as leader: %v", err)
+		return true
+	}
+	if snapshot.PeerStatusErr != nil {
+		log.Errorf("Cannot read peer status, acting as leader: %v", snapshot.PeerStatusErr)
+		return true
+	}
+	for _, peer := range snapshot.PeerStatus.Peers() {
+		if peer.Connected && peer.UUID < uuid {
+			return false
+		}
+	}
+	return true
+}
+
+// lockLeader takes the lock file, the lock is kept until the file becomes unreadable
+func (e *Exporter) lockLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.leaderLock != nil {
+		if _, err := e.leaderLock.Stat(); err == nil {
+			return true
+		}
+		// the shared storage went away, the lock is released so another node can take it
+		log.Errorf("Lost leader lock %v", e.LeaderLockFile)
+		e.leaderLock.Close()
+		e.leaderLock = nil
+	}
+
+	file, err := os.OpenFile(e.LeaderLockFile, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		log.Errorf("Cannot open leader lock %v: %v", e.LeaderLockFile, err)
+		return false
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		if err != syscall.EWOULDBLOCK {
+			log.Errorf("Cannot take leader lock %v: %v", e.LeaderLockFile, err)
+		}
+		file.Close()
+		return false
+	}
+	log.Infof("Took leader lock %v", e.LeaderLockFile)
+	e.leaderLock = file
+	return true
+}
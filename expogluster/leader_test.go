@@ -0,0 +1,143 @@
+package expogluster
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLowestPeer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "leader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	infoFile := filepath.Join(dir, "glusterd.info")
+	if err := ioutil.WriteFile(infoFile, []byte("UUID=5b0e2c1a-0000-4000-8000-000000000002\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := func(peers ...PeerStatusPeer) *Snapshot {
+		snapshot := &Snapshot{}
+		snapshot.PeerStatus.CliOutput.PeerStatus.Peer = peers
+		return snapshot
+	}
+	lower := PeerStatusPeer{UUID: "5b0e2c1a-0000-4000-8000-000000000001", Hostname: "server1", Connected: "1"}
+	higher := PeerStatusPeer{UUID: "5b0e2c1a-0000-4000-8000-000000000003", Hostname: "server3", Connected: "1"}
+	disconnected := lower
+	disconnected.Connected = "0"
+	failed := snapshot(lower)
+	failed.PeerStatusErr = errors.New("Connection failed. Please check if gluster daemon is operational.")
+
+	for _, test := range []struct {
+		name     string
+		snapshot *Snapshot
+		leader   bool
+	}{
+		{"lowest UUID", snapshot(higher), true},
+		{"lower connected peer", snapshot(higher, lower), false},
+		{"lower disconnected peer", snapshot(disconnected, higher), true},
+		{"single node", snapshot(), true},
+		{"peer status failure", failed, true},
+	} {
+		e := &Exporter{ClusterMode: clusterModePeer, GlusterdInfoFile: infoFile}
+		e.elect(test.snapshot)
+		if test.snapshot.Leader != test.leader {
+			t.Errorf("%v: leader is %v, expected %v", test.name, test.snapshot.Leader, test.leader)
+		}
+	}
+
+	// the node stays leader when its UUID is unknown
+	e := &Exporter{
+		ClusterMode:      clusterModePeer,
+		GlusterdInfoFile: filepath.Join(dir, "missing.info"),
+		Backend: &CLI{Runner: runnerFunc(func(name string, args ...string) ([]byte, error) {
+			return nil, errors.New("exit status 1")
+		})},
+	}
+	unknown := snapshot(lower)
+	if e.elect(unknown); !unknown.Leader {
+		t.Error("not leader with an unknown UUID")
+	}
+}
+
+func TestLockLeader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "leader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	lockFile := filepath.Join(dir, "leader.lock")
+
+	first := &Exporter{ClusterMode: clusterModeLock, LeaderLockFile: lockFile}
+	second := &Exporter{ClusterMode: clusterModeLock, LeaderLockFile: lockFile}
+	defer func() {
+		for _, e := range []*Exporter{first, second} {
+			if e.leaderLock != nil {
+				e.leaderLock.Close()
+			}
+		}
+	}()
+
+	if !first.lockLeader() {
+		t.Fatal("first node didn't take the free lock")
+	}
+	if second.lockLeader() {
+		t.Fatal("second node took the lock held by the first node")
+	}
+	if !first.lockLeader() {
+		t.Error("first node lost the lock it holds")
+	}
+
+	// the lock file becomes unreadable when the shared storage goes away, its lock is released
+	first.leaderLock.Close()
+	if !second.lockLeader() {
+		t.Fatal("second node didn't take the released lock")
+	}
+	if first.lockLeader() {
+		t.Error("first node is still leader after losing its lock")
+	}
+	if first.leaderLock != nil {
+		t.Error("lost lock is kept")
+	}
+
+	// the node isn't leader when the lock file can't be opened
+	missing := &Exporter{ClusterMode: clusterModeLock, LeaderLockFile: filepath.Join(dir, "missing", "leader.lock")}
+	snapshot := &Snapshot{}
+	if missing.elect(snapshot); snapshot.Leader {
+		t.Error("leader without lock file")
+	}
+}
+
+func TestReadGlusterdUUID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glusterd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, test := range []struct {
+		name, content, uuid string
+		ok                  bool
+	}{
+		{"glusterd.info", "UUID=5b0e2c1a-0000-4000-8000-000000000001\noperating-version=70200\n", "5b0e2c1a-0000-4000-8000-000000000001", true},
+		{"trailing spaces", "operating-version=70200\nUUID=5b0e2c1a-0000-4000-8000-000000000001  \n", "5b0e2c1a-0000-4000-8000-000000000001", true},
+		{"without UUID", "operating-version=70200\n", "", false},
+		{"empty file", "", "", false},
+	} {
+		path := filepath.Join(dir, "glusterd.info")
+		if err := ioutil.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		uuid, err := ReadGlusterdUUID(path)
+		if uuid != test.uuid || (err == nil) != test.ok {
+			t.Errorf("%v: UUID %q (%v), expected %q", test.name, uuid, err, test.uuid)
+		}
+	}
+
+	if _, err := ReadGlusterdUUID(filepath.Join(dir, "missing.info")); err == nil {
+		t.Error("UUID read from a missing file")
+	}
+}
@@ -0,0 +1,243 @@
+package expogluster
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// logLine matches the gluster log format:
+//
+//	[2020-06-22 10:15:30.123456] E [MSGID: 106005] [glusterd-utils.c:6154:glusterd_brick_start] 0-management: Unable to start brick
+//
+// newer releases add the timezone to the timestamp, and some messages don't have a MSGID
+var logLine = regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?)(?: ([+-]\d{4}))?\] ([TDINWECAM]) (?:\[MSGID: (\d+)\] )?\[[^\]]*\] ([^:\s]+):`)
+
+// logSeverities are the counted severities, messages below warning are ignored
+var logSeverities = map[string]string{
+	"W": "warning",
+	"E": "error",
+	"C": "critical",
+	"A": "alert",
+	"M": "emergency",
+}
+
+var (
+	logMessagesTotal = newDesc(
+		prometheus.BuildFQName(namespace, "", "log_messages_total"),
+		"Number of messages of warning severity and above logged in the gluster log file",
+		[]string{"file", "severity", "msgid"}, nil)
+
+	logLastCritical = newDesc(
+		prometheus.BuildFQName(namespace, "", "log_last_critical_timestamp_seconds"),
+		"Time of the last message of critical severity and above logged in the gluster log file",
+		[]string{"file"}, nil)
+)
+
+// LogMessage is a parsed line of a gluster log file
+type LogMessage struct {
+	Time       time.Time
+	Severity   string
+	MsgID      string
+	Translator string
+}
+
+// ParseLogLine parses a gluster log line, it returns false when the line isn't the start of a message
+func ParseLogLine(line string) (LogMessage, bool) {
+	match := logLine.FindStringSubmatch(line)
+	if match == nil {
+		return LogMessage{}, false
+	}
+	message := LogMessage{Severity: match[3], MsgID: match[4], Translator: match[5]}
+	layout, value := "2006-01-02 15:04:05.999999999", match[1]
+	if match[2] != "" {
+		layout, value = layout+" -0700", value+" "+match[2]
+	}
+	// gluster logs in UTC unless configured otherwise
+	message.Time, _ = time.ParseInLocation(layout, value, time.UTC)
+	return message, true
+}
+
+type logKey struct {
+	file     string
+	severity string
+	msgID    string
+}
+
+type tailedFile struct {
+	file    *os.File
+	info    os.FileInfo
+	partial []byte
+}
+
+// LogTailer follows gluster log files, surviving rotation and truncation, and counts their messages
+type LogTailer struct {
+	// Files are the glob patterns of the followed log files
+	Files []string
+	// Interval is the time between two reads of the log files
+	Interval time.Duration
+
+	mu           sync.Mutex
+	polled       bool
+	tailed       map[string]*tailedFile
+	counts       map[logKey]float64
+	lastCritical map[string]time.Time
+}
+
+// NewLogTailer creates the log tailer from environment variables, it returns nil when no log file is configured
+func NewLogTailer() *LogTailer {
+	files := splitList(getEnv("PROM_LOG_FILES", ""))
+	if len(files) == 0 {
+		return nil
+	}
+	tailer := &LogTailer{
+		Files:    files,
+		Interval: time.Duration(parseInt(getEnv("PROM_LOG_INTERVAL", "5"))) * time.Second,
+	}
+	// invalid numbers are parsed as 0, and time.Tick returns nil for 0
+	if tailer.Interval <= 0 {
+		log.Fatalf("PROM_LOG_INTERVAL must be a positive number of seconds: %v", getEnv("PROM_LOG_INTERVAL", ""))
+	}
+	return tailer
+}
+
+// Start follows the log files in background
+func (t *LogTailer) Start() {
+	t.Poll()
+	go func() {
+		for range time.Tick(t.Interval) {
+			t.Poll()
+		}
+	}()
+}
+
+// Poll reads the lines appended to the log files since the last poll.
+// Files existing on the first poll are read from their end, files appearing later from their start
+func (t *LogTailer) Poll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tailed == nil {
+		t.tailed = make(map[string]*tailedFile)
+		t.counts = make(map[logKey]float64)
+		t.lastCritical = make(map[string]time.Time)
+	}
+
+	found := make(map[string]bool)
+	for _, pattern := range t.Files {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			log.Errorf("Invalid log file pattern %v: %v", pattern, err)
+			continue
+		}
+		for _, path := range paths {
+			found[path] = true
+			t.poll(path)
+		}
+	}
+	for path, tf := range t.tailed {
+		if !found[path] {
+			tf.file.Close()
+			delete(t.tailed, path)
+		}
+	}
+	t.polled = true
+}
+
+func (t *LogTailer) poll(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	tf, ok := t.tailed[path]
+	if ok && !os.SameFile(tf.info, info) {
+		// the file was rotated, the end of the old file is read before following the new one
+		t.read(path, tf)
+		tf.file.Close()
+		delete(t.tailed, path)
+		ok = false
+	}
+	if !ok {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Errorf("Cannot open log file %v: %v", path, err)
+			return
+		}
+		if !t.polled {
+			if _, err := file.Seek(0, io.SeekEnd); err != nil {
+				file.Close()
+				log.Errorf("Cannot seek log file %v: %v", path, err)
+				return
+			}
+		}
+		tf = &tailedFile{file: file}
+		t.tailed[path] = tf
+	}
+	tf.info = info
+
+	if offset, err := tf.file.Seek(0, io.SeekCurrent); err == nil && info.Size() < offset {
+		// the file was truncated, copytruncate rotation
+		tf.file.Seek(0, io.SeekStart)
+		tf.partial = nil
+	}
+	t.read(path, tf)
+}
+
+// read counts the complete lines available in the file, an incomplete last line is kept for the next read
+func (t *LogTailer) read(path string, tf *tailedFile) {
+	reader := bufio.NewReader(tf.file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			tf.partial = append(tf.partial, line...)
+			if err != io.EOF {
+				log.Errorf("Cannot read log file %v: %v", path, err)
+			}
+			return
+		}
+		if len(tf.partial) > 0 {
+			line = append(tf.partial, line...)
+			tf.partial = nil
+		}
+		t.count(path, string(line))
+	}
+}
+
+func (t *LogTailer) count(path, line string) {
+	message, ok := ParseLogLine(line)
+	if !ok {
+		return
+	}
+	severity, ok := logSeverities[message.Severity]
+	if !ok {
+		return
+	}
+	t.counts[logKey{path, severity, message.MsgID}]++
+	if message.Severity == "C" || message.Severity == "A" || message.Severity == "M" {
+		if message.Time.After(t.lastCritical[path]) {
+			t.lastCritical[path] = message.Time
+		}
+	}
+}
+
+// Collect sends the messages counters
+func (t *LogTailer) Collect(ch chan<- prometheus.Metric) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, count := range t.counts {
+		ch <- prometheus.MustNewConstMetric(
+			logMessagesTotal, prometheus.CounterValue, count, key.file, key.severity, key.msgID,
+		)
+	}
+	for file, last := range t.lastCritical {
+		ch <- prometheus.MustNewConstMetric(
+			logLastCritical, prometheus.GaugeValue, float64(last.UnixNano())/1e9, file,
+		)
+	}
+}
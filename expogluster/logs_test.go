@@ -0,0 +1,136 @@
+package expogluster
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseLogLine(t *testing.T) {
+	for _, test := range []struct {
+		line    string
+		ok      bool
+		message LogMessage
+	}{
+		{
+			"[2020-06-22 10:15:30.123456] E [MSGID: 106005] [glusterd-utils.c:6154:glusterd_brick_start] 0-management: Unable to start brick",
+			true,
+			LogMessage{time.Date(2020, 6, 22, 10, 15, 30, 123456000, time.UTC), "E", "106005", "0-management"},
+		},
+		{
+			"[2021-03-01 08:00:00.5 +0200] W [rpc-clnt.c:1753:rpc_clnt_submit] 0-gfs-client-1: failed to submit rpc-request",
+			true,
+			LogMessage{time.Date(2021, 3, 1, 6, 0, 0, 500000000, time.UTC), "W", "", "0-gfs-client-1"},
+		},
+		{"The message \"...\" repeated 3 times between [2020-06-22 10:15:30] and [2020-06-22 10:16:30]", false, LogMessage{}},
+		{"", false, LogMessage{}},
+	} {
+		message, ok := ParseLogLine(test.line)
+		if ok != test.ok {
+			t.Errorf("%q: parsed %v, expected %v", test.line, ok, test.ok)
+			continue
+		}
+		if !message.Time.Equal(test.message.Time) || message.Severity != test.message.Severity ||
+			message.MsgID != test.message.MsgID || message.Translator != test.message.Translator {
+			t.Errorf("%q: %+v, expected %+v", test.line, message, test.message)
+		}
+	}
+}
+
+const (
+	logError    = "[2020-06-22 10:15:30.123456] E [MSGID: 106005] [glusterd-utils.c:6154:glusterd_brick_start] 0-management: Unable to start brick\n"
+	logWarning  = "[2020-06-22 10:15:31.000000] W [MSGID: 106006] [glusterd-utils.c:6154:glusterd_brick_start] 0-management: Brick is slow\n"
+	logInfo     = "[2020-06-22 10:15:32.000000] I [MSGID: 106007] [glusterd-utils.c:6154:glusterd_brick_start] 0-management: Brick started\n"
+	logCritical = "[2020-06-22 10:15:33.000000] C [MSGID: 106008] [glusterd-utils.c:6154:glusterd_brick_start] 0-management: Brick crashed\n"
+)
+
+func appendLog(t *testing.T, path, content string) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogTailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "glusterd.log")
+	errorKey := logKey{path, "error", "106005"}
+	warningKey := logKey{path, "warning", "106006"}
+
+	// the messages logged before the exporter started aren't counted
+	appendLog(t, path, logError)
+	tailer := &LogTailer{Files: []string{filepath.Join(dir, "*.log")}}
+	tailer.Poll()
+	if len(tailer.counts) != 0 {
+		t.Fatalf("counts %v, expected none", tailer.counts)
+	}
+
+	appendLog(t, path, logError+logWarning+logInfo)
+	tailer.Poll()
+	if tailer.counts[errorKey] != 1 || tailer.counts[warningKey] != 1 || len(tailer.counts) != 2 {
+		t.Fatalf("counts %v, expected an error and a warning", tailer.counts)
+	}
+
+	// an incomplete line is counted once it is complete
+	appendLog(t, path, logError[:40])
+	tailer.Poll()
+	appendLog(t, path, logError[40:])
+	tailer.Poll()
+	if tailer.counts[errorKey] != 2 {
+		t.Fatalf("%v errors after an incomplete line, expected 2", tailer.counts[errorKey])
+	}
+
+	// a file rotated by renaming is read to its end, the new file from its start
+	appendLog(t, path, logError)
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLog(t, path, logWarning)
+	tailer.Poll()
+	if tailer.counts[errorKey] != 3 || tailer.counts[warningKey] != 2 {
+		t.Fatalf("counts %v after rotation, expected 3 errors and 2 warnings", tailer.counts)
+	}
+
+	// a truncated file is read from its start, the truncation is only noticed while the file is
+	// smaller than the read offset
+	appendLog(t, path, logError+logWarning)
+	tailer.Poll()
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendLog(t, path, logError)
+	tailer.Poll()
+	if tailer.counts[errorKey] != 5 || tailer.counts[warningKey] != 3 {
+		t.Fatalf("counts %v after truncation, expected 5 errors and 3 warnings", tailer.counts)
+	}
+
+	// files appearing after the first poll are read from their start
+	other := filepath.Join(dir, "bricks.log")
+	appendLog(t, other, logCritical)
+	tailer.Poll()
+	if tailer.counts[logKey{other, "critical", "106008"}] != 1 {
+		t.Fatalf("counts %v, expected a critical message in %v", tailer.counts, other)
+	}
+	if last := tailer.lastCritical[other]; !last.Equal(time.Date(2020, 6, 22, 10, 15, 33, 0, time.UTC)) {
+		t.Errorf("last critical message at %v", last)
+	}
+
+	// removed files aren't followed anymore
+	if err := os.Remove(other); err != nil {
+		t.Fatal(err)
+	}
+	tailer.Poll()
+	if _, ok := tailer.tailed[other]; ok {
+		t.Errorf("%v is still followed after its removal", other)
+	}
+}
@@ -0,0 +1,324 @@
+package expogluster
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// glusterFSType is the filesystem type of glusterfs FUSE mounts
+const glusterFSType = "fuse.glusterfs"
+
+// Mount is a glusterfs FUSE mount read from mountinfo
+type Mount struct {
+	MountPoint string
+	Server     string
+	Volume     string
+	Options    []string
+}
+
+// ReadMountInfo reads the glusterfs FUSE mounts of a mountinfo file, usually /proc/self/mountinfo
+func ReadMountInfo(path string) ([]Mount, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseMountInfo(file)
+}
+
+// parseMountInfo parses the mountinfo format described in proc(5):
+//
+//	36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - fuse.glusterfs server:/volume rw,user_id=0
+//
+// optional fields are ended by a single hyphen. A mount stacked on a mount point hides
+// the previous ones, only the last mount of each mount point is returned
+func parseMountInfo(r io.Reader) ([]Mount, error) {
+	var mountPoints []string
+	last := make(map[string]*Mount)
+	collect := func() []Mount {
+		mounts := []Mount{}
+		for _, mountPoint := range mountPoints {
+			if mount := last[mountPoint]; mount != nil {
+				mounts = append(mounts, *mount)
+			}
+		}
+		return mounts
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		separator := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				separator = i
+				break
+			}
+		}
+		if len(fields) < 6 || separator == -1 || len(fields) < separator+3 {
+			return collect(), fmt.Errorf("malformed mountinfo line %v", line)
+		}
+		mountPoint := unescapeMountInfo(fields[4])
+		if _, seen := last[mountPoint]; !seen {
+			mountPoints = append(mountPoints, mountPoint)
+		}
+		if fields[separator+1] != glusterFSType {
+			last[mountPoint] = nil
+			continue
+		}
+
+		source := unescapeMountInfo(fields[separator+2])
+		server, volume := source, ""
+		if i := strings.Index(source, ":"); i >= 0 {
+			server = source[:i]
+			// subdirectory mounts look like server:/volume/subdir
+			volume = strings.SplitN(strings.TrimPrefix(source[i+1:], "/"), "/", 2)[0]
+		}
+		options := strings.Split(fields[5], ",")
+		if len(fields) > separator+3 {
+			for _, option := range strings.Split(fields[separator+3], ",") {
+				if !ContainsVolume(options, option) {
+					options = append(options, option)
+				}
+			}
+		}
+
+		last[mountPoint] = &Mount{
+			MountPoint: mountPoint,
+			Server:     server,
+			Volume:     volume,
+			Options:    options,
+		}
+	}
+	return collect(), scanner.Err()
+}
+
+// unescapeMountInfo decodes the octal escapes used by the kernel for space, tab, newline and backslash
+func unescapeMountInfo(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+4 <= len(field) {
+			if c, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(field[i])
+	}
+	return b.String()
+}
+
+func (e *Exporter) mountInfoPath() string {
+	if e.MountInfoPath == "" {
+		return "/proc/self/mountinfo"
+	}
+	return e.MountInfoPath
+}
+
+// reasons of failed mount probes
+const (
+	probeTimeout      = "timeout"
+	probeNotConnected = "not_connected"
+	probeStale        = "stale"
+	probeReadBack     = "read_back"
+	probeError        = "error"
+)
+
+var probeFailureReasons = []string{probeTimeout, probeNotConnected, probeStale, probeReadBack, probeError}
+
+// mountProber runs the write probes of the mounts, a single probe runs at a time for each mount point
+// so probes hung on a FUSE mount don't pile up between scrapes
+type mountProber struct {
+	mu       sync.Mutex
+	running  map[string]bool
+	duration *prometheus.HistogramVec
+
+	// touch writes a test file on the mount point, and reads it back when asked
+	touch func(mountPoint string, readBack bool) error
+	// stat reads the capacity of the filesystem of the path
+	stat func(path string, buf *syscall.Statfs_t) error
+}
+
+func newMountProber() *mountProber {
+	return &mountProber{
+		running: make(map[string]bool),
+		touch: func(mountPoint string, readBack bool) error {
+			_, err := ExecTouchOnVolumes(mountPoint, readBack)
+			return err
+		},
+		stat: syscall.Statfs,
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "mount_probe_duration_seconds",
+			Help:      "Duration of the write probes of the mounts, timed out probes are observed with the timeout",
+			Buckets:   []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30},
+		}, []string{"volume", "mountpoint"}),
+	}
+}
+
+// errProbeTimeout is returned when a probe misses its deadline or the previous one is still running
+var errProbeTimeout = errors.New("probe timed out")
+
+// run executes fn in a worker and waits for it until the timeout,
+// fn isn't run again while the previous run with the same key is hung
+func (p *mountProber) run(key string, timeout time.Duration, fn func() error) error {
+	p.mu.Lock()
+	if p.running[key] {
+		p.mu.Unlock()
+		return errProbeTimeout
+	}
+	p.running[key] = true
+	p.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		err := fn()
+		p.mu.Lock()
+		delete(p.running, key)
+		p.mu.Unlock()
+		done <- err
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return errProbeTimeout
+	}
+}
+
+// probe checks if the mount is writeable within the timeout and returns the reason of the failure,
+// or an empty string when it succeeds
+func (p *mountProber) probe(mount Mount, timeout time.Duration, readBack bool) string {
+	start := time.Now()
+	err := p.run(mount.MountPoint, timeout, func() error {
+		return p.touch(mount.MountPoint, readBack)
+	})
+	duration := time.Since(start)
+	if err == errProbeTimeout {
+		duration = timeout
+	}
+	// the probe id is logged and attached as exemplar, so a slow probe can be found in the logs
+	id := probeID()
+	p.duration.WithLabelValues(mount.Volume, mount.MountPoint).(prometheus.ExemplarObserver).ObserveWithExemplar(
+		duration.Seconds(), prometheus.Labels{"probe_id": id},
+	)
+	switch {
+	case err != nil:
+		log.Errorf("probe %v of %v failed after %v: %v", id, mount.MountPoint, duration, err)
+	case duration > timeout/2:
+		log.Warnf("probe %v of %v is slow, it took %v", id, mount.MountPoint, duration)
+	default:
+		log.Debugf("probe %v of %v took %v", id, mount.MountPoint, duration)
+	}
+	return probeFailureReason(err)
+}
+
+// probeID returns a random id identifying a probe
+func probeID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(id)
+}
+
+// statfs reads the capacity of the mount as seen by clients
+func (p *mountProber) statfs(mount Mount, timeout time.Duration) (*syscall.Statfs_t, error) {
+	stat := &syscall.Statfs_t{}
+	err := p.run("statfs:"+mount.MountPoint, timeout, func() error {
+		return p.stat(mount.MountPoint, stat)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stat, nil
+}
+
+// probeFailureReason classifies the errors of disconnected and stale FUSE mounts
+func probeFailureReason(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case err == errProbeTimeout:
+		return probeTimeout
+	case errors.Is(err, syscall.ENOTCONN):
+		return probeNotConnected
+	case errors.Is(err, syscall.ESTALE):
+		return probeStale
+	case errors.Is(err, errReadBack):
+		return probeReadBack
+	}
+	return probeError
+}
+
+// mountProbe is the result of the probes of a mount
+type mountProbe struct {
+	// reason of the failure of the write probe, empty when it succeeded
+	reason string
+	// stat is nil when statfs failed
+	stat *syscall.Statfs_t
+}
+
+// probeMounts probes the mounts concurrently and returns the results for each mount point
+func (e *Exporter) probeMounts(mounts []Mount) map[string]mountProbe {
+	prober := e.prober()
+	timeout := e.MountTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	results := make(map[string]mountProbe, len(mounts))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, mount := range mounts {
+		wg.Add(1)
+		go func(mount Mount) {
+			defer wg.Done()
+			result := mountProbe{reason: prober.probe(mount, timeout, e.MountReadBack)}
+			// statfs would hang as well on a hung mount
+			if result.reason != probeTimeout {
+				stat, err := prober.statfs(mount, timeout)
+				if err != nil {
+					log.Errorf("statfs of %v failed: %v", mount.MountPoint, err)
+				}
+				result.stat = stat
+			}
+			mu.Lock()
+			results[mount.MountPoint] = result
+			mu.Unlock()
+		}(mount)
+	}
+	wg.Wait()
+	return results
+}
+
+func (e *Exporter) prober() *mountProber {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.mountProber == nil {
+		e.mountProber = newMountProber()
+	}
+	return e.mountProber
+}
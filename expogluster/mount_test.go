@@ -0,0 +1,303 @@
+package expogluster
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestReadMountInfo(t *testing.T) {
+	mounts, err := ReadMountInfo(filepath.Join("testdata", "mountinfo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		mountPoint, server, volume string
+	}{
+		{"/mnt/gfs", "server1", "gfs"},
+		{"/mnt/backup copy", "server2", "backup"},
+		// subdirectory mount
+		{"/mnt/projects", "localhost", "gfs"},
+		// the last of the stacked mounts
+		{"/mnt/stacked", "server1", "gfs"},
+	}
+	if len(mounts) != len(expected) {
+		t.Fatalf("mounts %+v, expected %v glusterfs mounts", mounts, len(expected))
+	}
+	for i, mount := range mounts {
+		if mount.MountPoint != expected[i].mountPoint || mount.Server != expected[i].server || mount.Volume != expected[i].volume {
+			t.Errorf("mount %+v, expected %+v", mount, expected[i])
+		}
+	}
+
+	// the super block options are added to the mount options
+	if options := mounts[2].Options; !reflect.DeepEqual(options, []string{"ro", "relatime", "rw", "user_id=0", "group_id=0", "allow_other"}) {
+		t.Errorf("options %v", options)
+	}
+
+	if _, err := ReadMountInfo(filepath.Join("testdata", "missing")); err == nil {
+		t.Error("no error for a missing file")
+	}
+}
+
+func TestParseMountInfoMalformed(t *testing.T) {
+	mounts, err := parseMountInfo(strings.NewReader(
+		"112 22 0:48 / /mnt/gfs rw,relatime shared:60 - fuse.glusterfs server1:/gfs rw\n" +
+			"113 22 0:49 / /mnt/backup rw,relatime shared:61 fuse.glusterfs server2:/backup rw\n",
+	))
+	if err == nil || err.Error() != "malformed mountinfo line 2" {
+		t.Errorf("error %v, expected the malformed line", err)
+	}
+	if len(mounts) != 1 || mounts[0].MountPoint != "/mnt/gfs" {
+		t.Errorf("mounts before the malformed line %+v", mounts)
+	}
+}
+
+func TestUnescapeMountInfo(t *testing.T) {
+	for field, expected := range map[string]string{
+		`/mnt/gfs`:                "/mnt/gfs",
+		`/mnt/backup\040copy`:     "/mnt/backup copy",
+		`/mnt/tab\011newline\012`: "/mnt/tab\tnewline\n",
+		`/mnt/back\134slash`:      `/mnt/back\slash`,
+		`/mnt/not\999octal`:       `/mnt/not\999octal`,
+		`/mnt/short\04`:           `/mnt/short\04`,
+	} {
+		if got := unescapeMountInfo(field); got != expected {
+			t.Errorf("unescapeMountInfo(%q) = %q, expected %q", field, got, expected)
+		}
+	}
+}
+
+func TestProbeFailureReason(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		reason string
+	}{
+		{nil, ""},
+		{errProbeTimeout, probeTimeout},
+		{&os.PathError{Op: "open", Path: "/mnt/gfs/.test", Err: syscall.ENOTCONN}, probeNotConnected},
+		{&os.PathError{Op: "open", Path: "/mnt/gfs/.test", Err: syscall.ESTALE}, probeStale},
+		{errReadBack, probeReadBack},
+		{&os.PathError{Op: "open", Path: "/mnt/gfs/.test", Err: syscall.EROFS}, probeError},
+	} {
+		if reason := probeFailureReason(test.err); reason != test.reason {
+			t.Errorf("probeFailureReason(%v) = %q, expected %q", test.err, reason, test.reason)
+		}
+	}
+}
+
+func TestMountProbe(t *testing.T) {
+	prober := newMountProber()
+	mount := Mount{MountPoint: "/mnt/gfs", Volume: "gfs"}
+
+	var touchErr error
+	var readBack bool
+	prober.touch = func(mountPoint string, rb bool) error {
+		readBack = rb
+		return touchErr
+	}
+	for _, test := range []struct {
+		err    error
+		reason string
+	}{
+		{nil, ""},
+		{&os.PathError{Op: "open", Path: "/mnt/gfs/.test", Err: syscall.ENOTCONN}, probeNotConnected},
+		{&os.PathError{Op: "remove", Path: "/mnt/gfs/.test", Err: syscall.ESTALE}, probeStale},
+		{errReadBack, probeReadBack},
+		{errors.New("disk quota exceeded"), probeError},
+	} {
+		touchErr = test.err
+		if reason := prober.probe(mount, time.Second, true); reason != test.reason {
+			t.Errorf("probe failing with %v: reason %q, expected %q", test.err, reason, test.reason)
+		}
+	}
+	if !readBack {
+		t.Error("read back isn't passed to the probe")
+	}
+
+	// every probe is observed by the histogram
+	metric := &dto.Metric{}
+	if err := prober.duration.WithLabelValues("gfs", "/mnt/gfs").(prometheus.Metric).Write(metric); err != nil {
+		t.Fatal(err)
+	}
+	if count := metric.GetHistogram().GetSampleCount(); count != 5 {
+		t.Errorf("%d probes observed, expected 5", count)
+	}
+}
+
+func TestMountProbeSingleFlight(t *testing.T) {
+	prober := newMountProber()
+	mount := Mount{MountPoint: "/mnt/gfs", Volume: "gfs"}
+	other := Mount{MountPoint: "/mnt/backup", Volume: "backup"}
+
+	hung := make(chan struct{})
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	prober.touch = func(mountPoint string, readBack bool) error {
+		mu.Lock()
+		calls[mountPoint]++
+		mu.Unlock()
+		if mountPoint == mount.MountPoint {
+			<-hung
+		}
+		return nil
+	}
+	count := func(mountPoint string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls[mountPoint]
+	}
+
+	if reason := prober.probe(mount, 20*time.Millisecond, false); reason != probeTimeout {
+		t.Errorf("hung probe: reason %q, expected %q", reason, probeTimeout)
+	}
+	// the hung probe isn't run again, the mount times out at once
+	start := time.Now()
+	if reason := prober.probe(mount, time.Minute, false); reason != probeTimeout {
+		t.Errorf("probe while hung: reason %q, expected %q", reason, probeTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("probe while hung waited %v", elapsed)
+	}
+	if calls := count(mount.MountPoint); calls != 1 {
+		t.Errorf("hung mount probed %d times, expected 1", calls)
+	}
+	// other mounts are probed meanwhile
+	if reason := prober.probe(other, time.Second, false); reason != "" {
+		t.Errorf("probe of another mount: reason %q", reason)
+	}
+
+	// the mount is probed again once the hung probe returns
+	close(hung)
+	waitFor(t, "the end of the hung probe", func() bool {
+		prober.mu.Lock()
+		defer prober.mu.Unlock()
+		return !prober.running[mount.MountPoint]
+	})
+	if reason := prober.probe(mount, time.Second, false); reason != "" {
+		t.Errorf("probe after the hung one: reason %q", reason)
+	}
+	if calls := count(mount.MountPoint); calls != 2 {
+		t.Errorf("mount probed %d times, expected 2", calls)
+	}
+}
+
+func TestProbeMounts(t *testing.T) {
+	prober := newMountProber()
+	prober.touch = func(mountPoint string, readBack bool) error {
+		if mountPoint == "/mnt/hung" {
+			time.Sleep(time.Second)
+		}
+		return nil
+	}
+	statCalls := make(chan string, 3)
+	prober.stat = func(path string, buf *syscall.Statfs_t) error {
+		statCalls <- path
+		buf.Blocks = 1000
+		return nil
+	}
+	e := &Exporter{MountTimeout: 50 * time.Millisecond, mountProber: prober}
+
+	results := e.probeMounts([]Mount{{MountPoint: "/mnt/gfs"}, {MountPoint: "/mnt/hung"}})
+	if result := results["/mnt/gfs"]; result.reason != "" || result.stat == nil || result.stat.Blocks != 1000 {
+		t.Errorf("result of /mnt/gfs %+v", result)
+	}
+	// statfs would hang as well on a hung mount
+	if result := results["/mnt/hung"]; result.reason != probeTimeout || result.stat != nil {
+		t.Errorf("result of /mnt/hung %+v", result)
+	}
+	close(statCalls)
+	for path := range statCalls {
+		if path != "/mnt/gfs" {
+			t.Errorf("statfs of %v", path)
+		}
+	}
+}
+
+// metricValue returns the value of the metric of desc with the labels, other labels of the metric are ignored
+func metricValue(t *testing.T, metrics []prometheus.Metric, desc *prometheus.Desc, labels map[string]string) (float64, bool) {
+	for _, metric := range metrics {
+		if metric.Desc() != desc {
+			continue
+		}
+		m := &dto.Metric{}
+		if err := metric.Write(m); err != nil {
+			t.Fatal(err)
+		}
+		matched := 0
+		for _, pair := range m.GetLabel() {
+			if value, ok := labels[pair.GetName()]; ok && value == pair.GetValue() {
+				matched++
+			}
+		}
+		if matched != len(labels) {
+			continue
+		}
+		switch {
+		case m.Gauge != nil:
+			return m.GetGauge().GetValue(), true
+		case m.Counter != nil:
+			return m.GetCounter().GetValue(), true
+		}
+		return m.GetUntyped().GetValue(), true
+	}
+	return 0, false
+}
+
+func TestMountCapacityMetrics(t *testing.T) {
+	e := &Exporter{Volumes: []string{allVolumes}, Collectors: []string{"mount"}}
+	snapshot := &Snapshot{
+		mounts: []Mount{
+			{MountPoint: "/mnt/gfs", Volume: "gfs"},
+			{MountPoint: "/mnt/backup", Volume: "backup"},
+			{MountPoint: "/mnt/hung", Volume: "gfs"},
+		},
+		mountProbes: map[string]mountProbe{
+			// block counts are in fragment size units, not in the optimal transfer size
+			"/mnt/gfs": {stat: &syscall.Statfs_t{
+				Bsize: 131072, Frsize: 4096, Blocks: 1000, Bfree: 500, Bavail: 400, Files: 200, Ffree: 150,
+			}},
+			// the block size is used when the fragment size isn't set
+			"/mnt/backup": {stat: &syscall.Statfs_t{Bsize: 512, Blocks: 100, Bfree: 100, Bavail: 90}},
+			"/mnt/hung":   {reason: probeTimeout},
+		},
+	}
+	metrics := e.snapshotMetrics(snapshot)
+
+	for _, test := range []struct {
+		desc       *prometheus.Desc
+		mountPoint string
+		value      float64
+	}{
+		{mountSizeTotal, "/mnt/gfs", 1000 * 4096},
+		{mountSizeFree, "/mnt/gfs", 500 * 4096},
+		// blocks reserved to root are free but not available
+		{mountSizeAvailable, "/mnt/gfs", 400 * 4096},
+		{mountInodesTotal, "/mnt/gfs", 200},
+		{mountInodesFree, "/mnt/gfs", 150},
+		{mountSizeTotal, "/mnt/backup", 100 * 512},
+		{mountSizeAvailable, "/mnt/backup", 90 * 512},
+		{volumeWriteable, "/mnt/gfs", 1},
+		{volumeWriteable, "/mnt/hung", 0},
+	} {
+		value, ok := metricValue(t, metrics, test.desc, map[string]string{"mountpoint": test.mountPoint})
+		if !ok || value != test.value {
+			t.Errorf("%v of %v is %v (found %v), expected %v", test.desc, test.mountPoint, value, ok, test.value)
+		}
+	}
+
+	// the capacity of the mounts without statfs isn't reported
+	if _, ok := metricValue(t, metrics, mountSizeTotal, map[string]string{"mountpoint": "/mnt/hung"}); ok {
+		t.Error("capacity reported for a hung mount")
+	}
+}
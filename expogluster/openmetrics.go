@@ -0,0 +1,203 @@
+package expogluster
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/log"
+)
+
+// metricNames maps the descriptors of the exporter to their fully qualified name,
+// the name of a Desc isn't exported. It is filled when the descriptors are created
+var metricNames = make(map[*prometheus.Desc]string)
+
+// newDesc creates a descriptor with prometheus.NewDesc and records its name
+func newDesc(fqName, help string, variableLabels []string, constLabels prometheus.Labels) *prometheus.Desc {
+	desc := prometheus.NewDesc(fqName, help, variableLabels, constLabels)
+	metricNames[desc] = fqName
+	return desc
+}
+
+// metricName returns the fully qualified name of the metric described by desc
+func metricName(desc *prometheus.Desc) string {
+	return metricNames[desc]
+}
+
+// createdTimes records when the series of counters read from gluster were created, they are the
+// first time the exporter saw the series, or the last time its value went down because gluster reset it
+type createdTimes struct {
+	mu     sync.Mutex
+	series map[string]*createdSeries
+}
+
+type createdSeries struct {
+	created time.Time
+	value   float64
+	// seen is the last time the series was collected
+	seen time.Time
+}
+
+// seriesKey identifies a series by its metric name and label pairs, sorted by label name
+func seriesKey(name string, labels []*dto.LabelPair) string {
+	key := name
+	for _, label := range labels {
+		key += "\xff" + label.GetName() + "=" + label.GetValue()
+	}
+	return key
+}
+
+// counter sends a counter read from gluster and records when its series was created
+func (e *Exporter) counter(ch chan<- prometheus.Metric, desc *prometheus.Desc, value float64, labelValues ...string) {
+	metric := prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, labelValues...)
+	ch <- metric
+
+	created := e.createdTimes()
+	m := &dto.Metric{}
+	if err := metric.Write(m); err != nil {
+		return
+	}
+	created.mu.Lock()
+	defer created.mu.Unlock()
+	key := seriesKey(metricName(desc), m.Label)
+	now := time.Now()
+	if series, ok := created.series[key]; !ok || value < series.value {
+		created.series[key] = &createdSeries{created: now, value: value, seen: now}
+	} else {
+		series.value, series.seen = value, now
+	}
+}
+
+// expire forgets the series which weren't collected since the given time, they were removed from gluster
+func (c *createdTimes) expire(before time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, series := range c.series {
+		if series.seen.Before(before) {
+			delete(c.series, key)
+		}
+	}
+}
+
+func (e *Exporter) createdTimes() *createdTimes {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.created == nil {
+		e.created = &createdTimes{series: make(map[string]*createdSeries)}
+	}
+	return e.created
+}
+
+// metricsHandler serves the metrics of the gatherer, in OpenMetrics format when negotiated
+// with the _created samples of the counters read from gluster
+func (e *Exporter) metricsHandler(gatherer prometheus.Gatherer) http.Handler {
+	handler := promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if expfmt.NegotiateIncludingOpenMetrics(r.Header) != expfmt.FmtOpenMetrics {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		families, err := gatherer.Gather()
+		if err != nil {
+			log.Errorf("error gathering metrics: %v", err)
+			http.Error(w, "An error has occurred while serving metrics:\n\n"+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		buffer := &bytes.Buffer{}
+		created := e.createdTimes()
+		created.mu.Lock()
+		for _, family := range families {
+			if err = writeOpenMetricsFamily(buffer, family, created.series); err != nil {
+				break
+			}
+		}
+		created.mu.Unlock()
+		if err == nil {
+			_, err = expfmt.FinalizeOpenMetrics(buffer)
+		}
+		if err != nil {
+			log.Errorf("error encoding metrics: %v", err)
+			http.Error(w, "An error has occurred while serving metrics:\n\n"+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", string(expfmt.FmtOpenMetrics))
+		w.Write(buffer.Bytes())
+	})
+}
+
+// writeOpenMetricsFamily writes the family, counters read from gluster are written with a _created
+// sample after each sample whose creation is known, the encoder of prometheus doesn't support them
+func writeOpenMetricsFamily(w io.Writer, family *dto.MetricFamily, series map[string]*createdSeries) error {
+	name := family.GetName()
+	known := false
+	if family.GetType() == dto.MetricType_COUNTER && strings.HasSuffix(name, "_total") {
+		for _, metric := range family.Metric {
+			if _, ok := series[seriesKey(name, metric.Label)]; ok {
+				known = true
+				break
+			}
+		}
+	}
+	if !known {
+		_, err := expfmt.MetricFamilyToOpenMetrics(w, family)
+		return err
+	}
+
+	shortName := strings.TrimSuffix(name, "_total")
+	lines := []string{}
+	if family.Help != nil {
+		lines = append(lines, "# HELP "+shortName+" "+openMetricsEscaper.Replace(family.GetHelp()))
+	}
+	lines = append(lines, "# TYPE "+shortName+" counter")
+	for _, metric := range family.Metric {
+		labels := openMetricsLabels(metric.Label)
+		lines = append(lines, name+labels+" "+openMetricsFloat(metric.GetCounter().GetValue()))
+		if s, ok := series[seriesKey(name, metric.Label)]; ok {
+			lines = append(lines, shortName+"_created"+labels+" "+openMetricsFloat(float64(s.created.UnixNano())/1e9))
+		}
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// openMetricsEscaper escapes the label values and the help texts
+var openMetricsEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// openMetricsLabels formats the label pairs, "{name="value",...}", empty without labels
+func openMetricsLabels(labels []*dto.LabelPair) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels))
+	for _, label := range labels {
+		pairs = append(pairs, label.GetName()+`="`+openMetricsEscaper.Replace(label.GetValue())+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// openMetricsFloat formats a value, integers have a ".0" suffix as the encoder of prometheus writes them
+func openMetricsFloat(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	formatted := strconv.FormatFloat(value, 'g', -1, 64)
+	if !strings.ContainsAny(formatted, "e.") {
+		formatted += ".0"
+	}
+	return formatted
+}
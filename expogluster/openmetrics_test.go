@@ -0,0 +1,195 @@
+package expogluster
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// collectorFunc collects the metrics sent by a function
+type collectorFunc func(ch chan<- prometheus.Metric)
+
+func (f collectorFunc) Describe(ch chan<- *prometheus.Desc) {}
+
+func (f collectorFunc) Collect(ch chan<- prometheus.Metric) {
+	f(ch)
+}
+
+func TestOpenMetricsFloat(t *testing.T) {
+	for value, expected := range map[float64]string{
+		0:                           "0.0",
+		1:                           "1.0",
+		-2:                          "-2.0",
+		1.5:                         "1.5",
+		1596000000.25:               "1.59600000025e+09",
+		1e21:                        "1e+21",
+		math.Inf(1):                 "+Inf",
+		math.Inf(-1):                "-Inf",
+		math.MaxUint32:              "4.294967295e+09",
+		0.00001:                     "1e-05",
+		123456:                      "123456.0",
+		-0.5:                        "-0.5",
+		math.SmallestNonzeroFloat64: "5e-324",
+	} {
+		if formatted := openMetricsFloat(value); formatted != expected {
+			t.Errorf("openMetricsFloat(%v) = %v, expected %v", value, formatted, expected)
+		}
+	}
+	if formatted := openMetricsFloat(math.NaN()); formatted != "NaN" {
+		t.Errorf("openMetricsFloat(NaN) = %v", formatted)
+	}
+}
+
+func TestOpenMetricsLabels(t *testing.T) {
+	for _, test := range []struct {
+		labels   []*dto.LabelPair
+		expected string
+	}{
+		{nil, ""},
+		{labelPairs("volume", "gfs"), `{volume="gfs"}`},
+		{labelPairs("brick", "server1:/data/gfs", "volume", "gfs"), `{brick="server1:/data/gfs",volume="gfs"}`},
+		{labelPairs("path", "/dir \"quoted\"\\\nnext"), `{path="/dir \"quoted\"\\\nnext"}`},
+	} {
+		if labels := openMetricsLabels(test.labels); labels != test.expected {
+			t.Errorf("openMetricsLabels(%v) = %v, expected %v", test.labels, labels, test.expected)
+		}
+	}
+}
+
+func TestWriteOpenMetricsFamily(t *testing.T) {
+	created := time.Unix(1596000000, 500000000)
+	series := map[string]*createdSeries{
+		seriesKey("gluster_brick_data_read_bytes_total", labelPairs("brick", "server1:/data/gfs", "volume", "gfs")): {created: created, value: 2048},
+	}
+	counter := func(value float64, labels ...string) *dto.Metric {
+		return &dto.Metric{Label: labelPairs(labels...), Counter: &dto.Counter{Value: proto.Float64(value)}}
+	}
+
+	for _, test := range []struct {
+		name     string
+		family   *dto.MetricFamily
+		expected string
+	}{
+		{
+			"counter with _created",
+			&dto.MetricFamily{
+				Name: proto.String("gluster_brick_data_read_bytes_total"),
+				Help: proto.String("Total amount of data read by brick."),
+				Type: dto.MetricType_COUNTER.Enum(),
+				Metric: []*dto.Metric{
+					counter(2048, "brick", "server1:/data/gfs", "volume", "gfs"),
+					// the creation of a series isn't known before the exporter reads it
+					counter(512, "brick", "server2:/data/gfs", "volume", "gfs"),
+				},
+			},
+			`# HELP gluster_brick_data_read_bytes Total amount of data read by brick.
+# TYPE gluster_brick_data_read_bytes counter
+gluster_brick_data_read_bytes_total{brick="server1:/data/gfs",volume="gfs"} 2048.0
+gluster_brick_data_read_bytes_created{brick="server1:/data/gfs",volume="gfs"} 1.5960000005e+09
+gluster_brick_data_read_bytes_total{brick="server2:/data/gfs",volume="gfs"} 512.0
+`,
+		},
+		{
+			"counter without known series",
+			&dto.MetricFamily{
+				Name:   proto.String("gluster_brick_data_written_bytes_total"),
+				Help:   proto.String("Total amount of data written by brick."),
+				Type:   dto.MetricType_COUNTER.Enum(),
+				Metric: []*dto.Metric{counter(1024, "brick", "server1:/data/gfs", "volume", "gfs")},
+			},
+			`# HELP gluster_brick_data_written_bytes Total amount of data written by brick.
+# TYPE gluster_brick_data_written_bytes counter
+gluster_brick_data_written_bytes_total{brick="server1:/data/gfs",volume="gfs"} 1024.0
+`,
+		},
+		{
+			"gauge",
+			&dto.MetricFamily{
+				Name:   proto.String("gluster_up"),
+				Help:   proto.String("Was the last query of Gluster successful."),
+				Type:   dto.MetricType_GAUGE.Enum(),
+				Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(1)}}},
+			},
+			`# HELP gluster_up Was the last query of Gluster successful.
+# TYPE gluster_up gauge
+gluster_up 1.0
+`,
+		},
+	} {
+		buffer := &bytes.Buffer{}
+		if err := writeOpenMetricsFamily(buffer, test.family, series); err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		if buffer.String() != test.expected {
+			t.Errorf("%v: written\n%v\nexpected\n%v", test.name, buffer.String(), test.expected)
+		}
+	}
+}
+
+func TestCreatedTimes(t *testing.T) {
+	e := &Exporter{}
+	values := map[string]float64{"server1:/data/gfs": 2048, "server2:/data/gfs": 512}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectorFunc(func(ch chan<- prometheus.Metric) {
+		for brick, value := range values {
+			e.counter(ch, brickDataRead, value, "gfs", brick)
+		}
+	}))
+	key := func(brick string) string {
+		return seriesKey(metricName(brickDataRead), labelPairs("brick", brick, "volume", "gfs"))
+	}
+	scrape := func() string {
+		start := time.Now()
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		r.Header.Set("Accept", string(expfmt.FmtOpenMetrics))
+		w := httptest.NewRecorder()
+		e.metricsHandler(registry).ServeHTTP(w, r)
+		e.createdTimes().expire(start)
+		body, _ := ioutil.ReadAll(w.Body)
+		return string(body)
+	}
+
+	body := scrape()
+	first := e.createdTimes().series[key("server1:/data/gfs")]
+	if first == nil || !bytes.Contains([]byte(body), []byte(`gluster_brick_data_read_bytes_created{brick="server1:/data/gfs",volume="gfs"} `)) {
+		t.Fatalf("no _created sample in\n%v", body)
+	}
+	created := first.created
+
+	// the creation is kept while the counter grows, and reset when gluster resets the counter
+	values["server1:/data/gfs"] = 4096
+	scrape()
+	if s := e.createdTimes().series[key("server1:/data/gfs")]; s.created != created {
+		t.Errorf("creation of a growing counter changed from %v to %v", created, s.created)
+	}
+	values["server1:/data/gfs"] = 1024
+	scrape()
+	if s := e.createdTimes().series[key("server1:/data/gfs")]; !s.created.After(created) {
+		t.Errorf("creation of a reset counter is still %v", s.created)
+	}
+
+	// the series which aren't collected anymore expire
+	delete(values, "server2:/data/gfs")
+	body = scrape()
+	if _, ok := e.createdTimes().series[key("server2:/data/gfs")]; ok {
+		t.Error("removed series didn't expire")
+	}
+	if bytes.Contains([]byte(body), []byte("server2")) {
+		t.Errorf("removed series served in\n%v", body)
+	}
+
+	// the _created samples are only written in OpenMetrics
+	w := httptest.NewRecorder()
+	e.metricsHandler(registry).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if bytes.Contains(w.Body.Bytes(), []byte("_created")) {
+		t.Errorf("_created sample in text format\n%v", w.Body.String())
+	}
+}
@@ -0,0 +1,316 @@
+package expogluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+	"github.com/prometheus/common/version"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	common "go.opentelemetry.io/proto/otlp/common/v1"
+	metrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resource "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+// OTLP protocols
+const (
+	otlpProtocolHTTP = "http"
+	otlpProtocolGRPC = "grpc"
+)
+
+// OTLP pushes the metrics of the last snapshot to an OpenTelemetry collector on an interval
+type OTLP struct {
+	// Endpoint is the URL of the OTLP/HTTP receiver, /v1/metrics is added when it has no path,
+	// or the host:port of the OTLP/gRPC receiver
+	Endpoint string
+	// Protocol is "http" or "grpc"
+	Protocol string
+	// Interval is the time between two pushes
+	Interval time.Duration
+	// Timeout is the deadline of each push
+	Timeout time.Duration
+	// Headers are added to each push, for authentication
+	Headers map[string]string
+	// Insecure disables TLS for gRPC
+	Insecure bool
+	// Cluster is the name of the gluster cluster, added to the resource attributes
+	Cluster string
+
+	start time.Time
+	conn  *grpc.ClientConn
+}
+
+// NewOTLP creates the OTLP output from environment variables, it returns nil when no endpoint is configured
+func NewOTLP() *OTLP {
+	endpoint := getEnv("PROM_OTLP_ENDPOINT", "")
+	if endpoint == "" {
+		return nil
+	}
+	protocol := getEnv("PROM_OTLP_PROTOCOL", otlpProtocolHTTP)
+	if protocol != otlpProtocolHTTP && protocol != otlpProtocolGRPC {
+		log.Fatalf("Unknown OTLP protocol: %v", protocol)
+	}
+	o := &OTLP{
+		Endpoint: endpoint,
+		Protocol: protocol,
+		Interval: time.Duration(parseInt(getEnv("PROM_OTLP_INTERVAL", "60"))) * time.Second,
+		Timeout:  time.Duration(parseInt(getEnv("PROM_OTLP_TIMEOUT", "10"))) * time.Second,
+		Headers:  parseHeaders(getEnv("PROM_OTLP_HEADERS", "")),
+		Insecure: parseBool(getEnv("PROM_OTLP_INSECURE", "false")),
+		Cluster:  getEnv("PROM_OTLP_CLUSTER", ""),
+	}
+	// invalid numbers are parsed as 0, time.Tick returns nil for 0 and the pushes would never run
+	if o.Interval <= 0 {
+		log.Fatalf("PROM_OTLP_INTERVAL must be a positive number of seconds: %v", getEnv("PROM_OTLP_INTERVAL", ""))
+	}
+	if o.Timeout <= 0 {
+		log.Fatalf("PROM_OTLP_TIMEOUT must be a positive number of seconds: %v", getEnv("PROM_OTLP_TIMEOUT", ""))
+	}
+	return o
+}
+
+// parseHeaders parses a comma separated list of key=value pairs
+func parseHeaders(env string) map[string]string {
+	headers := make(map[string]string)
+	for _, item := range splitList(env) {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			log.Fatalf("Invalid header, expected key=value: %v", item)
+		}
+		headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return headers
+}
+
+// Start pushes the metrics of the exporter in background
+func (o *OTLP) Start(e *Exporter) {
+	o.start = time.Now()
+	if o.Protocol == otlpProtocolGRPC {
+		creds := grpc.WithInsecure()
+		if !o.Insecure {
+			creds = grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{}))
+		}
+		conn, err := grpc.Dial(o.Endpoint, creds)
+		if err != nil {
+			log.Fatalf("Cannot connect to OTLP endpoint %v: %v", o.Endpoint, err)
+		}
+		o.conn = conn
+	}
+	go func() {
+		for range time.Tick(o.Interval) {
+			if err := o.Push(e); err != nil {
+				log.Errorf("Cannot push metrics to OTLP endpoint %v: %v", o.Endpoint, err)
+			}
+		}
+	}()
+}
+
+// Push sends the metrics of the last snapshot of the exporter
+func (o *OTLP) Push(e *Exporter) error {
+	families, err := e.gatherSnapshot(o.Interval)
+	if err != nil {
+		return err
+	}
+	request := &collectormetrics.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metrics.ResourceMetrics{{
+			Resource: &resource.Resource{Attributes: o.resourceAttributes(e)},
+			InstrumentationLibraryMetrics: []*metrics.InstrumentationLibraryMetrics{{
+				InstrumentationLibrary: &common.InstrumentationLibrary{Name: "gluster_exporter", Version: version.Version},
+				Metrics:                o.otlpMetrics(e, families, time.Now()),
+			}},
+		}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.Timeout)
+	defer cancel()
+	if o.Protocol == otlpProtocolGRPC {
+		return o.pushGRPC(ctx, request)
+	}
+	return o.pushHTTP(ctx, request)
+}
+
+func (o *OTLP) pushGRPC(ctx context.Context, request *collectormetrics.ExportMetricsServiceRequest) error {
+	if o.conn == nil {
+		return fmt.Errorf("OTLP output isn't started")
+	}
+	ctx = metadata.NewOutgoingContext(ctx, metadata.New(o.Headers))
+	_, err := collectormetrics.NewMetricsServiceClient(o.conn).Export(ctx, request)
+	return err
+}
+
+func (o *OTLP) pushHTTP(ctx context.Context, request *collectormetrics.ExportMetricsServiceRequest) error {
+	body, err := proto.Marshal(request)
+	if err != nil {
+		return err
+	}
+	endpoint, err := url.Parse(o.Endpoint)
+	if err != nil {
+		return err
+	}
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = "/v1/metrics"
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for key, value := range o.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status %v: %s", resp.Status, message)
+	}
+	return nil
+}
+
+// resourceAttributes identify the cluster and the node pushing the metrics
+func (o *OTLP) resourceAttributes(e *Exporter) []*common.KeyValue {
+	attributes := []*common.KeyValue{stringAttribute("service.name", "gluster_exporter")}
+	if hostname, err := os.Hostname(); err == nil {
+		attributes = append(attributes, stringAttribute("host.name", hostname))
+	}
+	if uuid, err := e.localUUID(); err == nil {
+		attributes = append(attributes,
+			stringAttribute("service.instance.id", uuid),
+			stringAttribute("gluster.peer.uuid", uuid),
+		)
+	}
+	if o.Cluster != "" {
+		attributes = append(attributes, stringAttribute("gluster.cluster", o.Cluster))
+	}
+	return attributes
+}
+
+func stringAttribute(key, value string) *common.KeyValue {
+	return &common.KeyValue{Key: key, Value: &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: value}}}
+}
+
+// otlpMetrics converts the prometheus metric families, counters and histograms are cumulative
+// since their creation when known, or the start of the output
+func (o *OTLP) otlpMetrics(e *Exporter, families []*dto.MetricFamily, now time.Time) []*metrics.Metric {
+	created := e.createdTimes()
+	created.mu.Lock()
+	defer created.mu.Unlock()
+	startTime := func(name string, metric *dto.Metric) uint64 {
+		if series, ok := created.series[seriesKey(name, metric.Label)]; ok {
+			return uint64(series.created.UnixNano())
+		}
+		return uint64(o.start.UnixNano())
+	}
+	timestamp := uint64(now.UnixNano())
+
+	result := []*metrics.Metric{}
+	for _, family := range families {
+		name := family.GetName()
+		metric := &metrics.Metric{Name: name, Description: family.GetHelp()}
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			sum := &metrics.Sum{
+				AggregationTemporality: metrics.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				IsMonotonic:            true,
+			}
+			for _, m := range family.Metric {
+				sum.DataPoints = append(sum.DataPoints, &metrics.NumberDataPoint{
+					Attributes:        labelAttributes(m.Label),
+					StartTimeUnixNano: startTime(name, m),
+					TimeUnixNano:      timestamp,
+					Value:             &metrics.NumberDataPoint_AsDouble{AsDouble: m.GetCounter().GetValue()},
+				})
+			}
+			metric.Data = &metrics.Metric_Sum{Sum: sum}
+		case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+			gauge := &metrics.Gauge{}
+			for _, m := range family.Metric {
+				value := m.GetGauge().GetValue()
+				if family.GetType() == dto.MetricType_UNTYPED {
+					value = m.GetUntyped().GetValue()
+				}
+				gauge.DataPoints = append(gauge.DataPoints, &metrics.NumberDataPoint{
+					Attributes:   labelAttributes(m.Label),
+					TimeUnixNano: timestamp,
+					Value:        &metrics.NumberDataPoint_AsDouble{AsDouble: value},
+				})
+			}
+			metric.Data = &metrics.Metric_Gauge{Gauge: gauge}
+		case dto.MetricType_HISTOGRAM:
+			histogram := &metrics.Histogram{
+				AggregationTemporality: metrics.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			}
+			for _, m := range family.Metric {
+				point := &metrics.HistogramDataPoint{
+					Attributes:        labelAttributes(m.Label),
+					StartTimeUnixNano: startTime(name, m),
+					TimeUnixNano:      timestamp,
+					Count:             m.GetHistogram().GetSampleCount(),
+					Sum:               m.GetHistogram().GetSampleSum(),
+				}
+				// prometheus buckets are cumulative, OTLP buckets count the samples between two bounds
+				previous := uint64(0)
+				for _, bucket := range m.GetHistogram().GetBucket() {
+					if math.IsInf(bucket.GetUpperBound(), 1) {
+						continue
+					}
+					point.ExplicitBounds = append(point.ExplicitBounds, bucket.GetUpperBound())
+					point.BucketCounts = append(point.BucketCounts, bucket.GetCumulativeCount()-previous)
+					previous = bucket.GetCumulativeCount()
+				}
+				point.BucketCounts = append(point.BucketCounts, point.Count-previous)
+				histogram.DataPoints = append(histogram.DataPoints, point)
+			}
+			metric.Data = &metrics.Metric_Histogram{Histogram: histogram}
+		case dto.MetricType_SUMMARY:
+			summary := &metrics.Summary{}
+			for _, m := range family.Metric {
+				point := &metrics.SummaryDataPoint{
+					Attributes:        labelAttributes(m.Label),
+					StartTimeUnixNano: startTime(name, m),
+					TimeUnixNano:      timestamp,
+					Count:             m.GetSummary().GetSampleCount(),
+					Sum:               m.GetSummary().GetSampleSum(),
+				}
+				for _, quantile := range m.GetSummary().GetQuantile() {
+					point.QuantileValues = append(point.QuantileValues, &metrics.SummaryDataPoint_ValueAtQuantile{
+						Quantile: quantile.GetQuantile(),
+						Value:    quantile.GetValue(),
+					})
+				}
+				summary.DataPoints = append(summary.DataPoints, point)
+			}
+			metric.Data = &metrics.Metric_Summary{Summary: summary}
+		default:
+			continue
+		}
+		result = append(result, metric)
+	}
+	return result
+}
+
+func labelAttributes(labels []*dto.LabelPair) []*common.KeyValue {
+	attributes := make([]*common.KeyValue, 0, len(labels))
+	for _, label := range labels {
+		attributes = append(attributes, stringAttribute(label.GetName(), label.GetValue()))
+	}
+	return attributes
+}
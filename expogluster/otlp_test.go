@@ -0,0 +1,272 @@
+package expogluster
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func labelPairs(pairs ...string) []*dto.LabelPair {
+	labels := []*dto.LabelPair{}
+	for i := 0; i < len(pairs); i += 2 {
+		labels = append(labels, &dto.LabelPair{Name: proto.String(pairs[i]), Value: proto.String(pairs[i+1])})
+	}
+	return labels
+}
+
+func TestOTLPMetrics(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	now := start.Add(time.Hour)
+	o := &OTLP{start: start}
+	e := &Exporter{}
+
+	// the creation of the counters read from gluster is known
+	desc := newDesc("gluster_brick_data_read_bytes_total", "Read bytes", []string{"volume"}, nil)
+	ch := make(chan prometheus.Metric, 1)
+	e.counter(ch, desc, 2048, "gfs")
+	created := e.createdTimes().series[seriesKey("gluster_brick_data_read_bytes_total", labelPairs("volume", "gfs"))].created
+
+	families := []*dto.MetricFamily{
+		{
+			Name: proto.String("gluster_brick_data_read_bytes_total"),
+			Help: proto.String("Read bytes"),
+			Type: dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{
+				{Label: labelPairs("volume", "gfs"), Counter: &dto.Counter{Value: proto.Float64(2048)}},
+				{Label: labelPairs("volume", "other"), Counter: &dto.Counter{Value: proto.Float64(10)}},
+			},
+		},
+		{
+			Name:   proto.String("gluster_up"),
+			Type:   dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(1)}}},
+		},
+		{
+			Name:   proto.String("gluster_untyped"),
+			Type:   dto.MetricType_UNTYPED.Enum(),
+			Metric: []*dto.Metric{{Untyped: &dto.Untyped{Value: proto.Float64(3)}}},
+		},
+		{
+			Name: proto.String("gluster_duration_seconds"),
+			Type: dto.MetricType_HISTOGRAM.Enum(),
+			Metric: []*dto.Metric{{Histogram: &dto.Histogram{
+				SampleCount: proto.Uint64(10),
+				SampleSum:   proto.Float64(12.5),
+				Bucket: []*dto.Bucket{
+					{UpperBound: proto.Float64(1), CumulativeCount: proto.Uint64(4)},
+					{UpperBound: proto.Float64(5), CumulativeCount: proto.Uint64(9)},
+					{UpperBound: proto.Float64(math.Inf(1)), CumulativeCount: proto.Uint64(10)},
+				},
+			}}},
+		},
+		{
+			Name: proto.String("gluster_latency_seconds"),
+			Type: dto.MetricType_SUMMARY.Enum(),
+			Metric: []*dto.Metric{{Summary: &dto.Summary{
+				SampleCount: proto.Uint64(5),
+				SampleSum:   proto.Float64(2),
+				Quantile:    []*dto.Quantile{{Quantile: proto.Float64(0.5), Value: proto.Float64(0.3)}},
+			}}},
+		},
+	}
+
+	result := o.otlpMetrics(e, families, now)
+	if len(result) != 5 {
+		t.Fatalf("%v metrics, expected 5", len(result))
+	}
+
+	sum := result[0].GetSum()
+	if result[0].Name != "gluster_brick_data_read_bytes_total" || result[0].Description != "Read bytes" || sum == nil {
+		t.Fatalf("counter %v", result[0])
+	}
+	if !sum.IsMonotonic || sum.AggregationTemporality != metrics.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+		t.Errorf("counter isn't a cumulative monotonic sum: %v", sum)
+	}
+	points := sum.DataPoints
+	if points[0].GetAsDouble() != 2048 || points[0].TimeUnixNano != uint64(now.UnixNano()) {
+		t.Errorf("counter point %v", points[0])
+	}
+	if attributes := points[0].Attributes; len(attributes) != 1 || attributes[0].Key != "volume" ||
+		attributes[0].Value.GetStringValue() != "gfs" {
+		t.Errorf("counter attributes %v", attributes)
+	}
+	// the start is the creation of the series when known, the start of the output otherwise
+	if points[0].StartTimeUnixNano != uint64(created.UnixNano()) {
+		t.Errorf("start %v, expected the creation of the series %v", points[0].StartTimeUnixNano, created.UnixNano())
+	}
+	if points[1].StartTimeUnixNano != uint64(start.UnixNano()) {
+		t.Errorf("start %v, expected the start of the output %v", points[1].StartTimeUnixNano, start.UnixNano())
+	}
+
+	if gauge := result[1].GetGauge(); gauge == nil || gauge.DataPoints[0].GetAsDouble() != 1 {
+		t.Errorf("gauge %v", result[1])
+	}
+	if gauge := result[2].GetGauge(); gauge == nil || gauge.DataPoints[0].GetAsDouble() != 3 {
+		t.Errorf("untyped %v", result[2])
+	}
+
+	histogram := result[3].GetHistogram()
+	if histogram == nil {
+		t.Fatalf("histogram %v", result[3])
+	}
+	point := histogram.DataPoints[0]
+	if point.Count != 10 || point.Sum != 12.5 {
+		t.Errorf("histogram count %v, sum %v", point.Count, point.Sum)
+	}
+	if !reflect.DeepEqual(point.ExplicitBounds, []float64{1, 5}) || !reflect.DeepEqual(point.BucketCounts, []uint64{4, 5, 1}) {
+		t.Errorf("histogram bounds %v, counts %v, expected [1 5] and [4 5 1]", point.ExplicitBounds, point.BucketCounts)
+	}
+
+	summary := result[4].GetSummary()
+	if summary == nil || summary.DataPoints[0].Count != 5 || len(summary.DataPoints[0].QuantileValues) != 1 ||
+		summary.DataPoints[0].QuantileValues[0].Value != 0.3 {
+		t.Errorf("summary %v", result[4])
+	}
+}
+
+func TestOTLPPushHTTP(t *testing.T) {
+	var received collectormetrics.ExportMetricsServiceRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" {
+			t.Errorf("path %v, expected /v1/metrics", r.URL.Path)
+		}
+		if contentType := r.Header.Get("Content-Type"); contentType != "application/x-protobuf" {
+			t.Errorf("content type %v", contentType)
+		}
+		if token := r.Header.Get("Authorization"); token != "Bearer token" {
+			t.Errorf("authorization header %q", token)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := proto.Unmarshal(body, &received); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	o := &OTLP{Endpoint: server.URL, Headers: parseHeaders("Authorization = Bearer token")}
+	request := &collectormetrics.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metrics.ResourceMetrics{{SchemaUrl: "gluster"}},
+	}
+	if err := o.pushHTTP(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+	if len(received.ResourceMetrics) != 1 || received.ResourceMetrics[0].SchemaUrl != "gluster" {
+		t.Errorf("received %v", &received)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer failing.Close()
+	o.Endpoint = failing.URL + "/"
+	if err := o.pushHTTP(context.Background(), request); err == nil {
+		t.Error("a rejected push didn't fail")
+	}
+}
+
+// otlpServer is an OTLP/gRPC receiver keeping the requests and their metadata
+type otlpServer struct {
+	collectormetrics.UnimplementedMetricsServiceServer
+	mu       sync.Mutex
+	requests []*collectormetrics.ExportMetricsServiceRequest
+	metadata []metadata.MD
+	err      error
+}
+
+func (s *otlpServer) Export(ctx context.Context, request *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.requests = append(s.requests, request)
+	s.metadata = append(s.metadata, md)
+	return &collectormetrics.ExportMetricsServiceResponse{}, s.err
+}
+
+func TestOTLPPushGRPC(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver := &otlpServer{}
+	server := grpc.NewServer()
+	collectormetrics.RegisterMetricsServiceServer(server, receiver)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	e := &Exporter{
+		Backend:          &CLI{Runner: &fixtureRunner{fixtures: map[string]string{"volume info": "volume_info_single.xml"}}},
+		Volumes:          []string{allVolumes},
+		Collectors:       []string{"volume"},
+		GlusterdInfoFile: filepath.Join(os.TempDir(), "missing", "glusterd.info"),
+	}
+	o := &OTLP{
+		Endpoint: listener.Addr().String(),
+		Protocol: otlpProtocolGRPC,
+		Interval: time.Hour,
+		Timeout:  5 * time.Second,
+		Headers:  parseHeaders("authorization=Bearer token"),
+		Insecure: true,
+		Cluster:  "production",
+	}
+	if err := o.Push(e); err == nil {
+		t.Error("push before the connection didn't fail")
+	}
+	o.Start(e)
+	defer o.conn.Close()
+
+	if err := o.Push(e); err != nil {
+		t.Fatal(err)
+	}
+	receiver.mu.Lock()
+	if len(receiver.requests) != 1 {
+		t.Fatalf("%d requests received, expected 1", len(receiver.requests))
+	}
+	request, md := receiver.requests[0], receiver.metadata[0]
+	receiver.mu.Unlock()
+
+	if token := md.Get("authorization"); len(token) != 1 || token[0] != "Bearer token" {
+		t.Errorf("authorization metadata %v", token)
+	}
+	resourceMetrics := request.ResourceMetrics[0]
+	attributes := map[string]string{}
+	for _, attribute := range resourceMetrics.Resource.Attributes {
+		attributes[attribute.Key] = attribute.Value.GetStringValue()
+	}
+	if attributes["service.name"] != "gluster_exporter" || attributes["gluster.cluster"] != "production" {
+		t.Errorf("resource attributes %v", attributes)
+	}
+	names := map[string]bool{}
+	for _, metric := range resourceMetrics.InstrumentationLibraryMetrics[0].Metrics {
+		names[metric.Name] = true
+	}
+	if !names["gluster_up"] || !names["gluster_volumes_available"] {
+		t.Errorf("pushed metrics %v", names)
+	}
+
+	// the errors of the receiver are returned
+	receiver.mu.Lock()
+	receiver.err = status.Error(codes.Unavailable, "receiver overloaded")
+	receiver.mu.Unlock()
+	if err := o.Push(e); status.Code(err) != codes.Unavailable {
+		t.Errorf("push to an overloaded receiver returned %v", err)
+	}
+}
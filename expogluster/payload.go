@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"io"
 	"io/ioutil"
+	"strconv"
 
 	"github.com/prometheus/common/log"
 )
 
+// VolumeInfoJSON struct represents cliOutput element of "gluster volume info" command
 type VolumeInfoJSON struct {
 	CliOutput struct {
 		OpRet    string `json:"opRet"`
@@ -15,61 +17,135 @@ type VolumeInfoJSON struct {
 		OpErrstr string `json:"opErrstr"`
 		VolInfo  struct {
 			Volumes struct {
-				Volume []struct {
-					BrickCount      string `json:"brickCount"`
-					DistCount       string `json:"distCount"`
-					ArbiterCount    string `json:"arbiterCount"`
-					RedundancyCount string `json:"redundancyCount"`
-					Name            string `json:"name"`
-					StatusStr       string `json:"statusStr"`
-					StripeCount     string `json:"stripeCount"`
-					Transport       string `json:"transport"`
-					Options         struct {
-						Option []struct {
-							Name  string `json:"name"`
-							Value string `json:"value"`
-						} `json:"option"`
-					} `json:"options"`
-					SnapshotCount string `json:"snapshotCount"`
-					ReplicaCount  string `json:"replicaCount"`
-					DisperseCount string `json:"disperseCount"`
-					Bricks        struct {
-						Brick []struct {
-							UUID      string `json:"-uuid"`
-							Name      string `json:"name"`
-							HostUUID  string `json:"hostUuid"`
-							IsArbiter string `json:"isArbiter"`
-						} `json:"brick"`
-					} `json:"bricks"`
-					OptCount string `json:"optCount"`
-					ID       string `json:"id"`
-					Status   string `json:"status"`
-					Type     string `json:"type"`
-					TypeStr  string `json:"typeStr"`
-				} `json:"volume"`
-				Count string `json:"count"`
+				Volume []VolumeInfoVolume `json:"volume"`
+				Count  string             `json:"count"`
 			} `json:"volumes"`
 		} `json:"volInfo"`
 	} `json:"cliOutput"`
 }
 
+// VolumeInfoVolume is the volume element of "gluster volume info" command
+type VolumeInfoVolume struct {
+	BrickCount      string `json:"brickCount"`
+	DistCount       string `json:"distCount"`
+	ArbiterCount    string `json:"arbiterCount"`
+	RedundancyCount string `json:"redundancyCount"`
+	Name            string `json:"name"`
+	StatusStr       string `json:"statusStr"`
+	StripeCount     string `json:"stripeCount"`
+	Transport       string `json:"transport"`
+	Options         struct {
+		Option []VolumeInfoOption `json:"option"`
+	} `json:"options"`
+	SnapshotCount string `json:"snapshotCount"`
+	ReplicaCount  string `json:"replicaCount"`
+	DisperseCount string `json:"disperseCount"`
+	Bricks        struct {
+		Brick []VolumeInfoBrick `json:"brick"`
+	} `json:"bricks"`
+	OptCount string `json:"optCount"`
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Type     string `json:"type"`
+	TypeStr  string `json:"typeStr"`
+}
+
+// VolumeInfoOption is the option element of "gluster volume info" command
+type VolumeInfoOption struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// VolumeInfoBrick is the brick element of "gluster volume info" command
+type VolumeInfoBrick struct {
+	UUID      string `json:"-uuid"`
+	Name      string `json:"name"`
+	HostUUID  string `json:"hostUuid"`
+	IsArbiter string `json:"isArbiter"`
+}
+
 // Volume element of "gluster volume info" command
 type Volume struct {
-	Name       string  `json:"name"`
-	ID         string  `json:"id"`
-	Status     int     `json:"status"`
-	StatusStr  string  `json:"statusStr"`
-	BrickCount int     `json:"brickCount"`
-	Bricks     []Brick `json:"bricks"`
-	DistCount  int     `json:"distCount"`
+	Name            string            `json:"name"`
+	ID              string            `json:"id"`
+	Status          int               `json:"status"`
+	StatusStr       string            `json:"statusStr"`
+	Type            string            `json:"type"`
+	BrickCount      int               `json:"brickCount"`
+	Bricks          []Brick           `json:"bricks"`
+	DistCount       int               `json:"distCount"`
+	ReplicaCount    int               `json:"replicaCount"`
+	ArbiterCount    int               `json:"arbiterCount"`
+	DisperseCount   int               `json:"disperseCount"`
+	RedundancyCount int               `json:"redundancyCount"`
+	Options         map[string]string `json:"options"`
 }
 
 // Brick element of "gluster volume info" command
 type Brick struct {
-	UUID      string `json:"brick>uuid"`
-	Name      string `json:"brick>name"`
-	HostUUID  string `json:"brick>hostUuid"`
-	IsArbiter int    `json:"brick>isArbiter"`
+	UUID      string `json:"uuid"`
+	Name      string `json:"name"`
+	HostUUID  string `json:"hostUuid"`
+	IsArbiter int    `json:"isArbiter"`
+}
+
+// Volumes converts the volumes of "gluster volume info" command to Volume elements
+func (v VolumeInfoJSON) Volumes() []Volume {
+	volumes := make([]Volume, 0, len(v.CliOutput.VolInfo.Volumes.Volume))
+	for _, vol := range v.CliOutput.VolInfo.Volumes.Volume {
+		volume := Volume{
+			Name:            vol.Name,
+			ID:              vol.ID,
+			Status:          atoi(vol.Status),
+			StatusStr:       vol.StatusStr,
+			Type:            vol.TypeStr,
+			BrickCount:      atoi(vol.BrickCount),
+			Bricks:          make([]Brick, 0, len(vol.Bricks.Brick)),
+			DistCount:       atoi(vol.DistCount),
+			ReplicaCount:    atoi(vol.ReplicaCount),
+			ArbiterCount:    atoi(vol.ArbiterCount),
+			DisperseCount:   atoi(vol.DisperseCount),
+			RedundancyCount: atoi(vol.RedundancyCount),
+			Options:         make(map[string]string, len(vol.Options.Option)),
+		}
+		for _, brick := range vol.Bricks.Brick {
+			volume.Bricks = append(volume.Bricks, Brick{
+				UUID:      brick.UUID,
+				Name:      brick.Name,
+				HostUUID:  brick.HostUUID,
+				IsArbiter: atoi(brick.IsArbiter),
+			})
+		}
+		for _, option := range vol.Options.Option {
+			volume.Options[option.Name] = option.Value
+		}
+		volumes = append(volumes, volume)
+	}
+	return volumes
+}
+
+// Peer element of "gluster peer status" command
+type Peer struct {
+	UUID      string `json:"uuid"`
+	Hostname  string `json:"hostname"`
+	Connected bool   `json:"connected"`
+	State     int    `json:"state"`
+	StateStr  string `json:"stateStr"`
+}
+
+// Peers converts the peers of "gluster peer status" command to Peer elements
+func (p PeerStatusJSON) Peers() []Peer {
+	peers := make([]Peer, 0, len(p.CliOutput.PeerStatus.Peer))
+	for _, peer := range p.CliOutput.PeerStatus.Peer {
+		peers = append(peers, Peer{
+			UUID:      peer.UUID,
+			Hostname:  peer.Hostname,
+			Connected: peer.Connected == "1",
+			State:     atoi(peer.State),
+			StateStr:  peer.StateStr,
+		})
+	}
+	return peers
 }
 
 // VolumeListJSON struct represents cliOutput element of "gluster volume list" command
@@ -92,20 +168,23 @@ type PeerStatusJSON struct {
 		OpErrno    string `json:"opErrno"`
 		OpErrstr   string `json:"opErrstr"`
 		PeerStatus struct {
-			Peer []struct {
-				UUID      string `json:"uuid"`
-				Hostname  string `json:"hostname"`
-				Hostnames struct {
-					Hostname string `json:"hostname"`
-				} `json:"hostnames"`
-				Connected string `json:"connected"`
-				State     string `json:"state"`
-				StateStr  string `json:"stateStr"`
-			} `json:"peer"`
+			Peer []PeerStatusPeer `json:"peer"`
 		} `json:"peerStatus"`
 	} `json:"cliOutput"`
 }
 
+// PeerStatusPeer is the peer element of "gluster peer status" command
+type PeerStatusPeer struct {
+	UUID      string `json:"uuid"`
+	Hostname  string `json:"hostname"`
+	Hostnames struct {
+		Hostname string `json:"hostname"`
+	} `json:"hostnames"`
+	Connected string `json:"connected"`
+	State     string `json:"state"`
+	StateStr  string `json:"stateStr"`
+}
+
 // Hostnames element of "gluster peer status" command
 // type Hostnames struct {
 // 	Hostname string `json:"hostname"`
@@ -114,8 +193,8 @@ type PeerStatusJSON struct {
 // VolumeProfileJSON struct represents cliOutput element of "gluster volume {volume} profile" command
 type VolumeProfileJSON struct {
 	// JSONName   string     `json:"cliOutput"`
-	OpRet      int        `json:"opRet"`
-	OpErrno    int        `json:"opErrno"`
+	OpRet      int        `json:"opRet,string"`
+	OpErrno    int        `json:"opErrno,string"`
 	OpErrstr   string     `json:"opErrstr"`
 	VolProfile VolProfile `json:"volProfile"`
 }
@@ -123,7 +202,7 @@ type VolumeProfileJSON struct {
 // VolProfile element of "gluster volume {volume} profile" command
 type VolProfile struct {
 	Volname    string         `json:"volname"`
-	BrickCount int            `json:"brickCount"`
+	BrickCount int            `json:"brickCount,string"`
 	Brick      []BrickProfile `json:"brick"`
 }
 
@@ -137,9 +216,9 @@ type BrickProfile struct {
 // CumulativeStats element of "gluster volume {volume} profile" command
 type CumulativeStats struct {
 	FopStats   FopStats `json:"fopStats"`
-	Duration   int      `json:"duration"`
-	TotalRead  int      `json:"totalRead"`
-	TotalWrite int      `json:"totalWrite"`
+	Duration   int      `json:"duration,string"`
+	TotalRead  int      `json:"totalRead,string"`
+	TotalWrite int      `json:"totalWrite,string"`
 }
 
 // FopStats element of "gluster volume {volume} profile" command
@@ -150,15 +229,15 @@ type FopStats struct {
 // Fop is struct for FopStats
 type Fop struct {
 	Name       string  `json:"name"`
-	Hits       int     `json:"hits"`
-	AvgLatency float64 `json:"avgLatency"`
-	MinLatency float64 `json:"minLatency"`
-	MaxLatency float64 `json:"maxLatency"`
+	Hits       int     `json:"hits,string"`
+	AvgLatency float64 `json:"avgLatency,string"`
+	MinLatency float64 `json:"minLatency,string"`
+	MaxLatency float64 `json:"maxLatency,string"`
 }
 
 // HealInfoBrick is a struct of HealInfoBricks
 type HealInfoBrick struct {
-	JSONName        string `json:"brick"`
+	HostUUID        string `json:"-hostUuid"`
 	Name            string `json:"name"`
 	Status          string `json:"status"`
 	NumberOfEntries string `json:"numberOfEntries"`
@@ -179,12 +258,26 @@ type HealInfo struct {
 // VolumeHealInfoJSON struct represents cliOutput element of "gluster volume {volume} heal info" command
 type VolumeHealInfoJSON struct {
 	//JSONName string   `json:"cliOutput"`
-	OpRet    int      `json:"opRet"`
-	OpErrno  int      `json:"opErrno"`
+	OpRet    int      `json:"opRet,string"`
+	OpErrno  int      `json:"opErrno,string"`
 	OpErrstr string   `json:"opErrstr"`
 	HealInfo HealInfo `json:"healInfo"`
 }
 
+// EntriesOutOfSync sums the number of entries of each brick
+func (v VolumeHealInfoJSON) EntriesOutOfSync() (int, error) {
+	entriesOutOfSync := 0
+	for _, brick := range v.HealInfo.Bricks.Brick {
+		count, err := strconv.Atoi(brick.NumberOfEntries)
+		if err != nil {
+			log.Errorf("Something went wrong while parsing brick info: %v", err)
+			return -1, err
+		}
+		entriesOutOfSync += count
+	}
+	return entriesOutOfSync, nil
+}
+
 // VolumeHealInfoJSONUnmarshall unmarshalls heal info of gluster cluster
 func VolumeHealInfoJSONUnmarshall(cmdOutBuff io.Reader) (VolumeHealInfoJSON, error) {
 	var vol VolumeHealInfoJSON
@@ -193,7 +286,7 @@ func VolumeHealInfoJSONUnmarshall(cmdOutBuff io.Reader) (VolumeHealInfoJSON, err
 		log.Error(err)
 		return vol, err
 	}
-	err = json.Unmarshal(b, &vol)
+	err = json.Unmarshal(skipRoot(b), &vol)
 	if err != nil {
 		log.Error(err)
 	}
@@ -204,7 +297,8 @@ func skipRoot(jsonBlob []byte) json.RawMessage {
 	var root map[string]json.RawMessage
 
 	if err := json.Unmarshal(jsonBlob, &root); err != nil {
-		panic(err)
+		log.Error(err)
+		return nil
 	}
 	for _, v := range root {
 		return v
@@ -221,7 +315,7 @@ func VolumeListJSONUnmarshall(cmdOutBuff io.Reader) (VolumeListJSON, error) {
 		return vol, err
 	}
 
-	err = json.Unmarshal(skipRoot(b), &vol)
+	err = json.Unmarshal(b, &vol)
 	return vol, err
 }
 
@@ -258,7 +352,7 @@ func VolumeProfileGvInfoCumulativeJSONUnmarshall(cmdOutBuff io.Reader) (VolumePr
 		log.Error(err)
 		return vol, err
 	}
-	err = json.Unmarshal(b, &vol)
+	err = json.Unmarshal(skipRoot(b), &vol)
 	return vol, err
 }
 
@@ -270,35 +364,88 @@ type VolumeStatusJSON struct {
 		OpErrstr  string `json:"opErrstr"`
 		VolStatus struct {
 			Volumes struct {
-				Volume []struct {
-					VolName   string `json:"volName"`
-					NodeCount string `json:"nodeCount"`
-					Node      []struct {
-						Hostname    string `json:"hostname"`
-						Peerid      string `json:"peerid"`
-						SizeTotal   string `json:"sizeTotal"`
-						MntOptions  string `json:"mntOptions"`
-						Path        string `json:"path"`
-						Pid         string `json:"pid"`
-						FsName      string `json:"fsName"`
-						InodesFree  string `json:"inodesFree"`
-						Device      string `json:"device"`
-						BlockSize   string `json:"blockSize"`
-						InodesTotal string `json:"inodesTotal"`
-						Status      string `json:"status"`
-						Port        string `json:"port"`
-						Ports       struct {
-							Rdma string `json:"rdma"`
-							TCP  string `json:"tcp"`
-						} `json:"ports"`
-						SizeFree string `json:"sizeFree"`
-					} `json:"node"`
-				} `json:"volume"`
+				Volume []VolumeStatusVolume `json:"volume"`
 			} `json:"volumes"`
 		} `json:"volStatus"`
 	} `json:"cliOutput"`
 }
 
+// VolumeStatusVolume is the volume element of "gluster volume status all detail" command
+type VolumeStatusVolume struct {
+	VolName   string             `json:"volName"`
+	NodeCount string             `json:"nodeCount"`
+	Node      []VolumeStatusNode `json:"node"`
+}
+
+// VolumeStatusNode is the node element of "gluster volume status all detail" command
+type VolumeStatusNode struct {
+	Hostname    string `json:"hostname"`
+	Peerid      string `json:"peerid"`
+	SizeTotal   string `json:"sizeTotal"`
+	MntOptions  string `json:"mntOptions"`
+	Path        string `json:"path"`
+	Pid         string `json:"pid"`
+	FsName      string `json:"fsName"`
+	InodesFree  string `json:"inodesFree"`
+	Device      string `json:"device"`
+	BlockSize   string `json:"blockSize"`
+	InodesTotal string `json:"inodesTotal"`
+	Status      string `json:"status"`
+	Port        string `json:"port"`
+	Ports       struct {
+		Rdma string `json:"rdma"`
+		TCP  string `json:"tcp"`
+	} `json:"ports"`
+	SizeFree string `json:"sizeFree"`
+}
+
+// BrickStatus element of "gluster volume status all detail" command
+type BrickStatus struct {
+	Hostname    string `json:"hostname"`
+	Path        string `json:"path"`
+	PeerID      string `json:"peerid"`
+	Status      int    `json:"status"`
+	Port        string `json:"port"`
+	Pid         int    `json:"pid"`
+	SizeTotal   uint64 `json:"sizeTotal"`
+	SizeFree    uint64 `json:"sizeFree"`
+	InodesTotal uint64 `json:"inodesTotal"`
+	InodesFree  uint64 `json:"inodesFree"`
+	Device      string `json:"device"`
+	BlockSize   uint64 `json:"blockSize"`
+	MntOptions  string `json:"mntOptions"`
+	FsName      string `json:"fsName"`
+}
+
+// Bricks converts the nodes of a volume of "gluster volume status all detail" command to BrickStatus elements
+func (v VolumeStatusJSON) Bricks(volumeName string) []BrickStatus {
+	bricks := []BrickStatus{}
+	for _, vol := range v.CliOutput.VolStatus.Volumes.Volume {
+		if vol.VolName != volumeName {
+			continue
+		}
+		for _, node := range vol.Node {
+			bricks = append(bricks, BrickStatus{
+				Hostname:    node.Hostname,
+				Path:        node.Path,
+				PeerID:      node.Peerid,
+				Status:      atoi(node.Status),
+				Port:        node.Port,
+				Pid:         atoi(node.Pid),
+				SizeTotal:   parseUint(node.SizeTotal),
+				SizeFree:    parseUint(node.SizeFree),
+				InodesTotal: parseUint(node.InodesTotal),
+				InodesFree:  parseUint(node.InodesFree),
+				Device:      node.Device,
+				BlockSize:   parseUint(node.BlockSize),
+				MntOptions:  node.MntOptions,
+				FsName:      node.FsName,
+			})
+		}
+	}
+	return bricks
+}
+
 // VolumeStatusAllDetailJSONUnmarshall reads bytes.buffer and returns unmarshalled json
 func VolumeStatusAllDetailJSONUnmarshall(cmdOutBuff io.Reader) (VolumeStatusJSON, error) {
 	var vol VolumeStatusJSON
@@ -350,3 +497,13 @@ func VolumeQuotaListJSONUnmarshall(cmdOutBuff io.Reader) (VolumeQuotaJSON, error
 	err = json.Unmarshal(b, &volQuotaJSON)
 	return volQuotaJSON, err
 }
+
+func atoi(value string) int {
+	i, _ := strconv.Atoi(value)
+	return i
+}
+
+func parseUint(value string) uint64 {
+	i, _ := strconv.ParseUint(value, 10, 64)
+	return i
+}
@@ -0,0 +1,129 @@
+package expogluster
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// readFixture converts the recorded xml output of a gluster command as gluster() does
+func readFixture(t *testing.T, name string) *bytes.Buffer {
+	content, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer, err := convertXML(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("%v: %v", name, err)
+	}
+	return buffer
+}
+
+// fixtureRunner answers gluster commands with recorded outputs of testdata, by command line
+// without --xml. Commands without output fail like gluster does when glusterd is down
+type fixtureRunner struct {
+	mu       sync.Mutex
+	fixtures map[string]string
+	calls    map[string]int
+}
+
+func (r *fixtureRunner) Run(name string, args ...string) ([]byte, error) {
+	command := strings.Join(args[:len(args)-1], " ")
+	r.mu.Lock()
+	if r.calls == nil {
+		r.calls = make(map[string]int)
+	}
+	r.calls[command]++
+	fixture, ok := r.fixtures[command]
+	r.mu.Unlock()
+	if !ok {
+		return []byte("Connection failed. Please check if gluster daemon is operational."), fmt.Errorf("exit status 1")
+	}
+	return ioutil.ReadFile(filepath.Join("testdata", fixture))
+}
+
+func (r *fixtureRunner) count(command string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls[command]
+}
+
+func TestVolumeInfoJSONUnmarshall(t *testing.T) {
+	single, err := VolumeInfoJSONUnmarshall(readFixture(t, "volume_info_single.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	volumes := single.CliOutput.VolInfo.Volumes.Volume
+	if len(volumes) != 1 || volumes[0].Name != "gfs" || volumes[0].StatusStr != "Started" {
+		t.Fatalf("volumes %+v", volumes)
+	}
+	if bricks := volumes[0].Bricks.Brick; len(bricks) != 1 || bricks[0].Name != "server1:/data/brick" ||
+		bricks[0].UUID != "0b1c2d3e-0000-4000-8000-000000000001" {
+		t.Errorf("bricks of a single brick volume %+v", bricks)
+	}
+	if options := volumes[0].Options.Option; len(options) != 1 || options[0].Name != "nfs.disable" {
+		t.Errorf("options %+v", options)
+	}
+
+	multi, err := VolumeInfoJSONUnmarshall(readFixture(t, "volume_info_multi.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	volumes = multi.CliOutput.VolInfo.Volumes.Volume
+	if len(volumes) != 2 || volumes[0].Name != "gfs" || volumes[1].Name != "backup" {
+		t.Fatalf("volumes %+v", volumes)
+	}
+	if len(volumes[0].Bricks.Brick) != 2 || len(volumes[1].Bricks.Brick) != 1 {
+		t.Errorf("bricks %+v and %+v", volumes[0].Bricks.Brick, volumes[1].Bricks.Brick)
+	}
+	// a volume without options has an empty options element
+	if len(volumes[0].Options.Option) != 2 || len(volumes[1].Options.Option) != 0 {
+		t.Errorf("options %+v and %+v", volumes[0].Options.Option, volumes[1].Options.Option)
+	}
+}
+
+func TestVolumeListJSONUnmarshall(t *testing.T) {
+	list, err := VolumeListJSONUnmarshall(readFixture(t, "volume_list.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if volumes := list.CliOutput.VolList.Volume; len(volumes) != 1 || volumes[0] != "gfs" {
+		t.Errorf("volumes %v", volumes)
+	}
+}
+
+func TestVolumeHealInfoJSONUnmarshall(t *testing.T) {
+	healInfo, err := VolumeHealInfoJSONUnmarshall(readFixture(t, "heal_info.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bricks := healInfo.HealInfo.Bricks.Brick
+	if len(bricks) != 1 {
+		t.Fatalf("bricks %+v", bricks)
+	}
+	if bricks[0].HostUUID != "0b1c2d3e-0000-4000-8000-000000000001" || bricks[0].NumberOfEntries != "3" {
+		t.Errorf("brick %+v", bricks[0])
+	}
+}
+
+func TestVolumeProfileJSONUnmarshall(t *testing.T) {
+	profile, err := VolumeProfileGvInfoCumulativeJSONUnmarshall(readFixture(t, "profile.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bricks := profile.VolProfile.Brick
+	if len(bricks) != 1 || bricks[0].BrickName != "server1:/data/brick" {
+		t.Fatalf("bricks %+v", bricks)
+	}
+	stats := bricks[0].CumulativeStats
+	if stats.Duration != 100 || stats.TotalRead != 2048 || stats.TotalWrite != 4096 {
+		t.Errorf("stats %+v", stats)
+	}
+	if fops := stats.FopStats.Fop; len(fops) != 1 || fops[0].Hits != 12 || fops[0].AvgLatency != 10.5 {
+		t.Errorf("fops %+v", fops)
+	}
+}
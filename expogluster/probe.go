@@ -0,0 +1,230 @@
+package expogluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/log"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const defaultModule = "default"
+
+// remoteCollectors are the collectors available for remote targets, mount checks only work locally
+var remoteCollectors = []string{"volume", "peer", "status", "heal", "profile", "quota"}
+
+// ProbeConfig represents the probe configuration file with the modules available for /probe
+type ProbeConfig struct {
+	Modules map[string]ProbeModule `yaml:"modules"`
+}
+
+// ProbeModule defines how a target is reached and which collectors run on it
+type ProbeModule struct {
+	Volumes    []string      `yaml:"volumes"`
+	Collectors []string      `yaml:"collectors"`
+	Timeout    time.Duration `yaml:"timeout"`
+	SSH        SSHConfig     `yaml:"ssh"`
+}
+
+// SSHConfig holds the credentials used to execute gluster on the target
+type SSHConfig struct {
+	User           string `yaml:"user"`
+	Port           int    `yaml:"port"`
+	PrivateKeyFile string `yaml:"private_key_file"`
+	KnownHostsFile string `yaml:"known_hosts_file"`
+}
+
+// LoadProbeConfig reads and validates the probe configuration file
+func LoadProbeConfig(path string) (*ProbeConfig, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &ProbeConfig{}
+	if err := yaml.UnmarshalStrict(content, config); err != nil {
+		return nil, err
+	}
+
+	for name, module := range config.Modules {
+		if module.Timeout == 0 {
+			module.Timeout = 30 * time.Second
+		}
+		if len(module.Volumes) == 0 {
+			module.Volumes = []string{allVolumes}
+		}
+		if len(module.Collectors) == 0 {
+			module.Collectors = []string{"volume", "peer", "status", "heal"}
+		}
+		for _, collector := range module.Collectors {
+			if !ContainsVolume(remoteCollectors, collector) {
+				return nil, fmt.Errorf("module %v: unknown collector %v", name, collector)
+			}
+		}
+		if module.SSH.Port == 0 {
+			module.SSH.Port = 22
+		}
+		if module.SSH.User == "" {
+			return nil, fmt.Errorf("module %v: missing ssh user", name)
+		}
+		if module.SSH.PrivateKeyFile == "" || module.SSH.KnownHostsFile == "" {
+			return nil, fmt.Errorf("module %v: private_key_file and known_hosts_file are required", name)
+		}
+		if _, err := module.SSH.clientConfig(module.Timeout); err != nil {
+			return nil, fmt.Errorf("module %v: %v", name, err)
+		}
+		config.Modules[name] = module
+	}
+	return config, nil
+}
+
+func (c SSHConfig) clientConfig(timeout time.Duration) (*ssh.ClientConfig, error) {
+	key, err := ioutil.ReadFile(c.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback, err := knownhosts.New(c.KnownHostsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.ClientConfig{
+		User:            c.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	}, nil
+}
+
+// SSHRunner executes commands on a remote node through ssh
+type SSHRunner struct {
+	client *ssh.Client
+	ctx    context.Context
+}
+
+// DialSSH connects to the target with the ssh configuration of the module
+func DialSSH(ctx context.Context, target string, module ProbeModule) (*SSHRunner, error) {
+	config, err := module.SSH.clientConfig(module.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, fmt.Sprint(module.SSH.Port))
+	}
+	client, err := ssh.Dial("tcp", target, config)
+	if err != nil {
+		return nil, err
+	}
+	return &SSHRunner{client: client, ctx: ctx}, nil
+}
+
+// Run executes the command on the remote node, the session is closed when the probe times out
+func (r *SSHRunner) Run(name string, args ...string) ([]byte, error) {
+	session, err := r.client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	type result struct {
+		output []byte
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := session.CombinedOutput(shellQuote(append([]string{name}, args...)))
+		done <- result{output, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.output, res.err
+	case <-r.ctx.Done():
+		session.Close()
+		return nil, r.ctx.Err()
+	}
+}
+
+// Close closes the ssh connection
+func (r *SSHRunner) Close() error {
+	return r.client.Close()
+}
+
+// shellQuote quotes each argument, the command is interpreted by the remote shell
+func shellQuote(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, "'"+strings.Replace(arg, "'", `'\''`, -1)+"'")
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (e *Exporter) probeHandler(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		httpError(errors.New("Target parameter is missing"), http.StatusBadRequest, w)
+		return
+	}
+	moduleName := r.URL.Query().Get("module")
+	if moduleName == "" {
+		moduleName = defaultModule
+	}
+	module, ok := e.Probe.Modules[moduleName]
+	if !ok {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		httpError(fmt.Errorf("Unknown module %v", moduleName), http.StatusBadRequest, w)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), module.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_success",
+		Help: "Displays whether or not the ssh connection to the target was a success",
+	})
+	// evaluated after the target registry is gathered, so it includes the gluster commands
+	probeDuration := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "probe_duration_seconds",
+		Help: "Returns how long the probe took to complete in seconds",
+	}, func() float64 {
+		return time.Since(start).Seconds()
+	})
+	probeRegistry := prometheus.NewRegistry()
+	probeRegistry.MustRegister(probeSuccess, probeDuration)
+	targetRegistry := prometheus.NewRegistry()
+
+	runner, err := DialSSH(ctx, target, module)
+	if err != nil {
+		log.Errorf("couldn't connect to target %v: %v", target, err)
+	} else {
+		defer runner.Close()
+		probeSuccess.Set(1)
+		targetRegistry.MustRegister(&Exporter{
+			Hostname:   target,
+			Volumes:    module.Volumes,
+			Profile:    ContainsVolume(module.Collectors, "profile"),
+			Quota:      ContainsVolume(module.Collectors, "quota"),
+			Backend:    &CLI{Runner: runner},
+			Collectors: module.Collectors,
+		})
+	}
+
+	gatherers := prometheus.Gatherers{targetRegistry, probeRegistry}
+	promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{EnableOpenMetrics: true}).ServeHTTP(w, r)
+}
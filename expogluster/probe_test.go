@@ -0,0 +1,194 @@
+package expogluster
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestShellQuote(t *testing.T) {
+	for _, args := range [][]string{
+		{"gluster", "volume", "info", "--xml"},
+		{"echo", "it's"},
+		{"echo", "$(touch /tmp/injected)", "`id`", "a;b", "a b", ""},
+		{"echo", `\'"`, "'", "''"},
+	} {
+		// printf prints each argument on its own line, as the remote shell received them
+		output, err := exec.Command("sh", "-c", "printf '%s\\n' "+shellQuote(args[1:])).Output()
+		if err != nil {
+			t.Fatalf("%v: %v", shellQuote(args), err)
+		}
+		if got := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n"); !reflect.DeepEqual(got, args[1:]) {
+			t.Errorf("%v: the shell received %q, expected %q", shellQuote(args), got, args[1:])
+		}
+	}
+}
+
+// sshServer is an ssh server answering the commands with their output, a command "sleep" never returns
+type sshServer struct {
+	addr     string
+	commands chan string
+}
+
+func newSSHServer(t *testing.T, clientKey ssh.PublicKey, hostKey ssh.Signer, outputs map[string]string) *sshServer {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() != "gluster" || string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, errors.New("unauthorized")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	server := &sshServer{addr: listener.Addr().String(), commands: make(chan string, 10)}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, channels, requests, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(requests)
+				for newChannel := range channels {
+					channel, requests, err := newChannel.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						for request := range requests {
+							var exec struct{ Command string }
+							if request.Type != "exec" || ssh.Unmarshal(request.Payload, &exec) != nil {
+								request.Reply(false, nil)
+								continue
+							}
+							request.Reply(true, nil)
+							server.commands <- exec.Command
+							if exec.Command == "'sleep'" {
+								continue
+							}
+							channel.Write([]byte(outputs[exec.Command]))
+							channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+							channel.Close()
+						}
+					}()
+				}
+			}()
+		}
+	}()
+	return server
+}
+
+func TestSSHRunner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	clientKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "id_rsa")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(clientKey)})
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	clientSigner, err := ssh.NewSignerFromKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := newSSHServer(t, clientSigner.PublicKey(), hostSigner, map[string]string{
+		"'gluster' 'volume' 'info' '--xml'": "<cliOutput/>",
+	})
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	knownHosts := knownhosts.Line([]string{server.addr}, hostSigner.PublicKey()) + "\n"
+	if err := ioutil.WriteFile(knownHostsFile, []byte(knownHosts), 0600); err != nil {
+		t.Fatal(err)
+	}
+	module := ProbeModule{
+		Timeout: 5 * time.Second,
+		SSH:     SSHConfig{User: "gluster", Port: 22, PrivateKeyFile: keyFile, KnownHostsFile: knownHostsFile},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runner, err := DialSSH(ctx, server.addr, module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	output, err := runner.Run("gluster", "volume", "info", "--xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(output) != "<cliOutput/>" {
+		t.Errorf("output %q, expected %q", output, "<cliOutput/>")
+	}
+	if command := <-server.commands; command != "'gluster' 'volume' 'info' '--xml'" {
+		t.Errorf("the server received %q", command)
+	}
+
+	// a probe which times out closes the session instead of waiting for the command
+	go func() {
+		<-server.commands
+		cancel()
+	}()
+	if _, err := runner.Run("sleep"); err != context.Canceled {
+		t.Errorf("error %v, expected %v", err, context.Canceled)
+	}
+
+	// an unknown host key is refused
+	module.SSH.KnownHostsFile = filepath.Join(dir, "other_hosts")
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSigner, err := ssh.NewSignerFromKey(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherHosts := knownhosts.Line([]string{server.addr}, otherSigner.PublicKey()) + "\n"
+	if err := ioutil.WriteFile(module.SSH.KnownHostsFile, []byte(otherHosts), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if other, err := DialSSH(context.Background(), server.addr, module); err == nil {
+		other.Close()
+		t.Error("a host with an unknown key was accepted")
+	}
+}
@@ -0,0 +1,126 @@
+package expogluster
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/prometheus/procfs"
+)
+
+// daemons maps the hostname of the daemons in "gluster volume status" to their process name
+var daemons = map[string]string{
+	"Self-heal Daemon": "glustershd",
+	"Quota Daemon":     "quotad",
+}
+
+var (
+	processLabels = []string{"process", "volume", "path"}
+
+	processCPU = newDesc(
+		prometheus.BuildFQName(namespace, "", "process_cpu_seconds_total"),
+		"Total user and system CPU time spent by the gluster process",
+		processLabels, nil)
+
+	processResidentMemory = newDesc(
+		prometheus.BuildFQName(namespace, "", "process_resident_memory_bytes"),
+		"Resident memory size of the gluster process",
+		processLabels, nil)
+
+	processVirtualMemory = newDesc(
+		prometheus.BuildFQName(namespace, "", "process_virtual_memory_bytes"),
+		"Virtual memory size of the gluster process",
+		processLabels, nil)
+
+	processOpenFDs = newDesc(
+		prometheus.BuildFQName(namespace, "", "process_open_fds"),
+		"Number of open file descriptors of the gluster process",
+		processLabels, nil)
+
+	processThreads = newDesc(
+		prometheus.BuildFQName(namespace, "", "process_threads"),
+		"Number of threads of the gluster process",
+		processLabels, nil)
+
+	processStartTime = newDesc(
+		prometheus.BuildFQName(namespace, "", "process_start_time_seconds"),
+		"Start time of the gluster process since unix epoch",
+		processLabels, nil)
+)
+
+// glusterProcess is a local gluster process, the volume and path are empty for daemons
+type glusterProcess struct {
+	pid     int
+	process string
+	volume  string
+	path    string
+}
+
+// localProcesses returns glusterd, and the bricks and daemons running on the local host
+func (e *Exporter) localProcesses(volumeStatus VolumeStatusJSON) []glusterProcess {
+	processes := []glusterProcess{}
+	seen := make(map[int]bool)
+	add := func(process glusterProcess) {
+		if process.pid > 0 && !seen[process.pid] {
+			seen[process.pid] = true
+			processes = append(processes, process)
+		}
+	}
+
+	if pid, err := readPidFile(e.GlusterdPidFile); err == nil {
+		add(glusterProcess{pid: pid, process: "glusterd"})
+	}
+	for _, vol := range volumeStatus.CliOutput.VolStatus.Volumes.Volume {
+		for _, brick := range volumeStatus.Bricks(vol.VolName) {
+			// daemons are listed in each volume, with the path "localhost" on the local host
+			if daemon, ok := daemons[brick.Hostname]; ok {
+				if brick.Path == "localhost" {
+					add(glusterProcess{pid: brick.Pid, process: daemon})
+				}
+				continue
+			}
+			if e.monitored(vol.VolName) && e.isLocalBrick(brick.Hostname, brick.PeerID) {
+				add(glusterProcess{pid: brick.Pid, process: "glusterfsd", volume: vol.VolName, path: brick.Path})
+			}
+		}
+	}
+	return processes
+}
+
+// collectProcesses sends the resources used by the local gluster processes, read from procfs
+func (e *Exporter) collectProcesses(ch chan<- prometheus.Metric, volumeStatus VolumeStatusJSON) {
+	fs, err := procfs.NewFS(e.procPath())
+	if err != nil {
+		log.Errorf("Cannot read procfs: %v", err)
+		return
+	}
+	for _, process := range e.localProcesses(volumeStatus) {
+		proc, err := fs.Proc(process.pid)
+		if err != nil {
+			log.Errorf("Cannot read process %v of %v: %v", process.pid, process.process, err)
+			continue
+		}
+		labels := []string{process.process, process.volume, process.path}
+
+		stat, err := proc.Stat()
+		if err != nil {
+			log.Errorf("Cannot read stat of process %v: %v", process.pid, err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(processCPU, prometheus.CounterValue, stat.CPUTime(), labels...)
+		ch <- prometheus.MustNewConstMetric(processResidentMemory, prometheus.GaugeValue, float64(stat.ResidentMemory()), labels...)
+		ch <- prometheus.MustNewConstMetric(processVirtualMemory, prometheus.GaugeValue, float64(stat.VirtualMemory()), labels...)
+		ch <- prometheus.MustNewConstMetric(processThreads, prometheus.GaugeValue, float64(stat.NumThreads), labels...)
+		if startTime, err := stat.StartTime(); err == nil {
+			ch <- prometheus.MustNewConstMetric(processStartTime, prometheus.GaugeValue, startTime, labels...)
+		}
+		if fds, err := proc.FileDescriptorsLen(); err == nil {
+			ch <- prometheus.MustNewConstMetric(processOpenFDs, prometheus.GaugeValue, float64(fds), labels...)
+		}
+	}
+}
+
+func (e *Exporter) procPath() string {
+	if e.ProcPath == "" {
+		return procfs.DefaultMountPoint
+	}
+	return e.ProcPath
+}
@@ -0,0 +1,141 @@
+package expogluster
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const localPeer = "7f7d3c88-1f5b-4a0f-9a59-0c3e1d7b1a01"
+
+// procTree writes a procfs with the stat and the file descriptors of the processes in a temporary directory,
+// the processes use pid/100 seconds of CPU, pid pages, 1 MiB per pid of virtual memory and pid%10 threads
+func procTree(t *testing.T, pids ...int) string {
+	root, err := ioutil.TempDir("", "proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(path, content string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(root, "stat"), "cpu  100 0 100 1000 0 0 0 0 0 0\nbtime 1596000000\n")
+	for _, pid := range pids {
+		dir := filepath.Join(root, strconv.Itoa(pid))
+		write(filepath.Join(dir, "stat"), fmt.Sprintf(
+			"%d (gluster process) S 1 %d %d 0 -1 4194560 100 0 0 0 %d %d 0 0 20 0 %d 0 %d %d %d 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0\n",
+			pid, pid, pid, pid/2, pid-pid/2, pid%10, pid*100, pid*1024*1024, pid))
+		for fd := 0; fd < pid%7; fd++ {
+			write(filepath.Join(dir, "fd", strconv.Itoa(fd)), "")
+		}
+	}
+	return root
+}
+
+func TestLocalProcesses(t *testing.T) {
+	root := procTree(t, 1021, 2301, 2302, 3001, 3002)
+	defer os.RemoveAll(root)
+	pidFile := filepath.Join(root, "glusterd.pid")
+	if err := ioutil.WriteFile(pidFile, []byte("1021\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	infoFile := filepath.Join(root, "glusterd.info")
+	if err := ioutil.WriteFile(infoFile, []byte("UUID="+localPeer+"\noperating-version=70200\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &Exporter{
+		Volumes:          []string{allVolumes},
+		Collectors:       []string{"status", "process"},
+		GlusterdPidFile:  pidFile,
+		GlusterdInfoFile: infoFile,
+		ProcPath:         root,
+	}
+
+	// the daemons are listed in each volume, and the daemons of the other nodes have their hostname as path
+	status := VolumeStatusJSON{}
+	daemons := []VolumeStatusNode{
+		{Hostname: "Self-heal Daemon", Path: "localhost", Peerid: localPeer, Status: "1", Pid: "3001"},
+		{Hostname: "Self-heal Daemon", Path: "server2", Peerid: "remote", Status: "1", Pid: "4001"},
+		{Hostname: "Quota Daemon", Path: "localhost", Peerid: localPeer, Status: "1", Pid: "3002"},
+	}
+	for _, brick := range []struct{ volume, pid string }{{"gfs", "2301"}, {"backup", "2302"}} {
+		volume := VolumeStatusVolume{VolName: brick.volume}
+		volume.Node = append(volume.Node,
+			VolumeStatusNode{Hostname: "server1", Path: "/data/" + brick.volume, Peerid: localPeer, Status: "1", Pid: brick.pid},
+			VolumeStatusNode{Hostname: "server2", Path: "/data/" + brick.volume, Peerid: "remote", Status: "1", Pid: "4000"},
+		)
+		volume.Node = append(volume.Node, daemons...)
+		status.CliOutput.VolStatus.Volumes.Volume = append(status.CliOutput.VolStatus.Volumes.Volume, volume)
+	}
+
+	expected := []glusterProcess{
+		{pid: 1021, process: "glusterd"},
+		{pid: 2301, process: "glusterfsd", volume: "gfs", path: "/data/gfs"},
+		{pid: 3001, process: "glustershd"},
+		{pid: 3002, process: "quotad"},
+		{pid: 2302, process: "glusterfsd", volume: "backup", path: "/data/backup"},
+	}
+	processes := e.localProcesses(status)
+	if fmt.Sprint(processes) != fmt.Sprint(expected) {
+		t.Errorf("local processes %+v, expected %+v", processes, expected)
+	}
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		e.collectProcesses(ch, status)
+		close(ch)
+	}()
+	metrics := []prometheus.Metric{}
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+	if len(metrics) != 6*len(expected) {
+		t.Errorf("%d process metrics, expected %d", len(metrics), 6*len(expected))
+	}
+	for _, process := range expected {
+		labels := map[string]string{"process": process.process, "volume": process.volume, "path": process.path}
+		pid := process.pid
+		for _, test := range []struct {
+			desc  *prometheus.Desc
+			value float64
+		}{
+			{processCPU, float64(pid) / 100},
+			{processResidentMemory, float64(pid * os.Getpagesize())},
+			{processVirtualMemory, float64(pid * 1024 * 1024)},
+			{processThreads, float64(pid % 10)},
+			{processStartTime, 1596000000 + float64(pid)},
+			{processOpenFDs, float64(pid % 7)},
+		} {
+			value, ok := metricValue(t, metrics, test.desc, labels)
+			if !ok || value != test.value {
+				t.Errorf("%v of %v is %v (found %v), expected %v", test.desc, process.process, value, ok, test.value)
+			}
+		}
+	}
+
+	// missing processes are skipped
+	e.GlusterdPidFile = filepath.Join(root, "missing.pid")
+	os.RemoveAll(filepath.Join(root, "3001"))
+	ch = make(chan prometheus.Metric)
+	go func() {
+		e.collectProcesses(ch, status)
+		close(ch)
+	}()
+	metrics = metrics[:0]
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+	if len(metrics) != 6*(len(expected)-2) {
+		t.Errorf("%d process metrics without glusterd and glustershd, expected %d", len(metrics), 6*(len(expected)-2))
+	}
+}
@@ -15,158 +15,237 @@ const (
 )
 
 var (
-	up = prometheus.NewDesc(
+	up = newDesc(
 		prometheus.BuildFQName(namespace, "", "up"),
 		"Was the last query of Gluster successful.",
 		nil, nil,
 	)
 
-	volumesCount = prometheus.NewDesc(
+	volumesCount = newDesc(
 		prometheus.BuildFQName(namespace, "", "volumes_available"),
 		"How many volumes were up at the last query.",
 		nil, nil,
 	)
 
-	volumeStatus = prometheus.NewDesc(
+	volumeStatus = newDesc(
 		prometheus.BuildFQName(namespace, "", "volume_status"),
 		"Status code of requested volume.",
 		[]string{"volume"}, nil,
 	)
 
-	nodeSizeFreeBytes = prometheus.NewDesc(
+	nodeSizeFreeBytes = newDesc(
 		prometheus.BuildFQName(namespace, "", "node_size_bytes_bytes"),
 		"Free bytes reported for each node on each instance. Labels are to distinguish origins",
 		[]string{"hostname", "path", "volume"}, nil,
 	)
 
-	nodeSizeTotalBytes = prometheus.NewDesc(
+	nodeSizeTotalBytes = newDesc(
 		prometheus.BuildFQName(namespace, "", "node_size_bytes_total"),
 		"Total bytes reported for each node on each instance. Labels are to distinguish origins",
 		[]string{"hostname", "path", "volume"}, nil,
 	)
 
-	nodeInodesTotal = prometheus.NewDesc(
+	nodeInodesTotal = newDesc(
 		prometheus.BuildFQName(namespace, "", "node_inodes_total"),
 		"Total inodes reported for each node on each instance. Labels are to distinguish origins",
 		[]string{"hostname", "path", "volume"}, nil,
 	)
 
-	nodeInodesFree = prometheus.NewDesc(
+	nodeInodesFree = newDesc(
 		prometheus.BuildFQName(namespace, "", "node_inodes_free"),
 		"Free inodes reported for each node on each instance. Labels are to distinguish origins",
 		[]string{"hostname", "path", "volume"}, nil,
 	)
 
-	brickCount = prometheus.NewDesc(
+	volumeUsableSizeTotal = newDesc(
+		prometheus.BuildFQName(namespace, "", "volume_usable_size_bytes"),
+		"Usable size of the volume, accounting for replication and disperse redundancy",
+		[]string{"volume"}, nil,
+	)
+
+	volumeUsableSizeFree = newDesc(
+		prometheus.BuildFQName(namespace, "", "volume_usable_free_bytes"),
+		"Usable free size of the volume, accounting for replication and disperse redundancy",
+		[]string{"volume"}, nil,
+	)
+
+	volumeImbalance = newDesc(
+		prometheus.BuildFQName(namespace, "", "volume_imbalance_ratio"),
+		"Difference between the fill ratio of the most and the least filled data bricks of the volume",
+		[]string{"volume"}, nil,
+	)
+
+	brickCount = newDesc(
 		prometheus.BuildFQName(namespace, "", "brick_available"),
 		"Number of bricks available at last query.",
 		[]string{"volume"}, nil,
 	)
 
-	brickDuration = prometheus.NewDesc(
+	brickDuration = newDesc(
 		prometheus.BuildFQName(namespace, "", "brick_duration_seconds_total"),
 		"Time running volume brick in seconds.",
 		[]string{"volume", "brick"}, nil,
 	)
 
-	brickDataRead = prometheus.NewDesc(
+	brickDataRead = newDesc(
 		prometheus.BuildFQName(namespace, "", "brick_data_read_bytes_total"),
 		"Total amount of bytes of data read by brick.",
 		[]string{"volume", "brick"}, nil,
 	)
 
-	brickDataWritten = prometheus.NewDesc(
+	brickDataWritten = newDesc(
 		prometheus.BuildFQName(namespace, "", "brick_data_written_bytes_total"),
 		"Total amount of bytes of data written by brick.",
 		[]string{"volume", "brick"}, nil,
 	)
 
-	brickFopHits = prometheus.NewDesc(
+	brickFopHits = newDesc(
 		prometheus.BuildFQName(namespace, "", "brick_fop_hits_total"),
 		"Total amount of file operation hits.",
 		[]string{"volume", "brick", "fop_name"}, nil,
 	)
 
-	brickFopLatencyAvg = prometheus.NewDesc(
+	brickFopLatencyAvg = newDesc(
 		prometheus.BuildFQName(namespace, "", "brick_fop_latency_avg"),
 		"Average fileoperations latency over total uptime",
 		[]string{"volume", "brick", "fop_name"}, nil,
 	)
 
-	brickFopLatencyMin = prometheus.NewDesc(
+	brickFopLatencyMin = newDesc(
 		prometheus.BuildFQName(namespace, "", "brick_fop_latency_min"),
 		"Minimum fileoperations latency over total uptime",
 		[]string{"volume", "brick", "fop_name"}, nil,
 	)
 
-	brickFopLatencyMax = prometheus.NewDesc(
+	brickFopLatencyMax = newDesc(
 		prometheus.BuildFQName(namespace, "", "brick_fop_latency_max"),
 		"Maximum fileoperations latency over total uptime",
 		[]string{"volume", "brick", "fop_name"}, nil,
 	)
 
-	peersConnected = prometheus.NewDesc(
+	peersConnected = newDesc(
 		prometheus.BuildFQName(namespace, "", "peers_connected"),
 		"Is peer connected to gluster cluster.",
 		nil, nil,
 	)
 
-	healInfoFilesCount = prometheus.NewDesc(
+	peerConnected = newDesc(
+		prometheus.BuildFQName(namespace, "", "peer_connected"),
+		"Displays whether or not the peer is connected to the cluster",
+		[]string{"peer", "hostname"}, nil)
+
+	healInfoFilesCount = newDesc(
 		prometheus.BuildFQName(namespace, "", "heal_info_files_count"),
 		"File count of files out of sync, when calling 'gluster v heal VOLNAME info",
 		[]string{"volume"}, nil)
 
-	volumeWriteable = prometheus.NewDesc(
+	healInfoSplitBrainCount = newDesc(
+		prometheus.BuildFQName(namespace, "", "heal_info_split_brain_count"),
+		"File count of files in split-brain, when calling 'gluster v heal VOLNAME info split-brain'",
+		[]string{"volume"}, nil)
+
+	brickUp = newDesc(
+		prometheus.BuildFQName(namespace, "", "brick_up"),
+		"Displays whether or not the brick of the volume is online",
+		[]string{"volume", "hostname", "path"}, nil)
+
+	volumeWriteable = newDesc(
 		prometheus.BuildFQName(namespace, "", "volume_writeable"),
 		"Writes and deletes file in Volume and checks if it is writeable",
 		[]string{"volume", "mountpoint"}, nil)
 
-	mountSuccessful = prometheus.NewDesc(
+	mountSuccessful = newDesc(
 		prometheus.BuildFQName(namespace, "", "mount_successful"),
 		"Checks if mountpoint exists, returns a bool value 0 or 1",
 		[]string{"volume", "mountpoint"}, nil)
 
-	quotaHardLimit = prometheus.NewDesc(
+	mountInfo = newDesc(
+		prometheus.BuildFQName(namespace, "", "mount_info"),
+		"Information about glusterfs FUSE mounts, value is always 1",
+		[]string{"volume", "mountpoint", "server", "options"}, nil)
+
+	mountProbeFailure = newDesc(
+		prometheus.BuildFQName(namespace, "", "mount_probe_failure"),
+		"Reason of the failed write probe of the mount, 1 for the reason of the last failure",
+		[]string{"volume", "mountpoint", "reason"}, nil)
+
+	mountSizeTotal = newDesc(
+		prometheus.BuildFQName(namespace, "", "mount_size_bytes"),
+		"Total size of the mounted volume seen by the client",
+		[]string{"volume", "mountpoint"}, nil)
+
+	mountSizeFree = newDesc(
+		prometheus.BuildFQName(namespace, "", "mount_free_bytes"),
+		"Free size of the mounted volume seen by the client",
+		[]string{"volume", "mountpoint"}, nil)
+
+	mountSizeAvailable = newDesc(
+		prometheus.BuildFQName(namespace, "", "mount_avail_bytes"),
+		"Size of the mounted volume available to unprivileged users seen by the client",
+		[]string{"volume", "mountpoint"}, nil)
+
+	mountInodesTotal = newDesc(
+		prometheus.BuildFQName(namespace, "", "mount_inodes_total"),
+		"Total inodes of the mounted volume seen by the client",
+		[]string{"volume", "mountpoint"}, nil)
+
+	mountInodesFree = newDesc(
+		prometheus.BuildFQName(namespace, "", "mount_inodes_free"),
+		"Free inodes of the mounted volume seen by the client",
+		[]string{"volume", "mountpoint"}, nil)
+
+	quotaHardLimit = newDesc(
 		prometheus.BuildFQName(namespace, "", "volume_quota_hardlimit"),
 		"Quota hard limit (bytes) in a volume",
 		[]string{"path", "volume"}, nil)
 
-	quotaSoftLimit = prometheus.NewDesc(
+	quotaSoftLimit = newDesc(
 		prometheus.BuildFQName(namespace, "", "volume_quota_softlimit"),
 		"Quota soft limit (bytes) in a volume",
 		[]string{"path", "volume"}, nil)
 
-	quotaUsed = prometheus.NewDesc(
+	quotaUsed = newDesc(
 		prometheus.BuildFQName(namespace, "", "volume_quota_used"),
 		"Current data (bytes) used in a quota",
 		[]string{"path", "volume"}, nil)
 
-	quotaAvailable = prometheus.NewDesc(
+	quotaAvailable = newDesc(
 		prometheus.BuildFQName(namespace, "", "volume_quota_available"),
 		"Current data (bytes) available in a quota",
 		[]string{"path", "volume"}, nil)
 
-	quotaSoftLimitExceeded = prometheus.NewDesc(
+	quotaSoftLimitExceeded = newDesc(
 		prometheus.BuildFQName(namespace, "", "volume_quota_softlimit_exceeded"),
 		"Is the quota soft-limit exceeded",
 		[]string{"path", "volume"}, nil)
 
-	quotaHardLimitExceeded = prometheus.NewDesc(
+	quotaHardLimitExceeded = newDesc(
 		prometheus.BuildFQName(namespace, "", "volume_quota_hardlimit_exceeded"),
 		"Is the quota hard-limit exceeded",
 		[]string{"path", "volume"}, nil)
+
+	eventsTotal = newDesc(
+		prometheus.BuildFQName(namespace, "", "events_total"),
+		"Number of events received from glustereventsd webhook",
+		[]string{"event", "volume"}, nil)
 )
 
 // Describe all the metrics exported by Gluster exporter. It implements prometheus.Collector.
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- up
+	ch <- isLeader
 	ch <- volumeStatus
 	ch <- volumesCount
 	ch <- brickCount
+	ch <- volumeUsableSizeTotal
+	ch <- volumeUsableSizeFree
+	ch <- volumeImbalance
 	ch <- brickDuration
 	ch <- brickDataRead
 	ch <- brickDataWritten
 	ch <- peersConnected
+	ch <- peerConnected
+	ch <- brickUp
 	ch <- nodeSizeFreeBytes
 	ch <- nodeSizeTotalBytes
 	ch <- brickFopHits
@@ -174,40 +253,92 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- brickFopLatencyMin
 	ch <- brickFopLatencyMax
 	ch <- healInfoFilesCount
+	ch <- healInfoSplitBrainCount
 	ch <- volumeWriteable
 	ch <- mountSuccessful
+	ch <- mountInfo
+	ch <- mountProbeFailure
+	ch <- mountSizeTotal
+	ch <- mountSizeFree
+	ch <- mountSizeAvailable
+	ch <- mountInodesTotal
+	ch <- mountInodesFree
+	e.prober().duration.Describe(ch)
+	if e.Benchmark != nil {
+		e.Benchmark.Describe(ch)
+	}
+	if e.Forecast != nil {
+		e.Forecast.Describe(ch)
+	}
+	ch <- brickFilesystemInfo
+	ch <- brickDeviceReads
+	ch <- brickDeviceReadBytes
+	ch <- brickDeviceReadTime
+	ch <- brickDeviceWrites
+	ch <- brickDeviceWrittenBytes
+	ch <- brickDeviceWriteTime
+	ch <- brickDeviceIONow
+	ch <- brickDeviceIOTime
+	ch <- brickThinPoolData
+	ch <- brickThinPoolMetadata
+	ch <- processCPU
+	ch <- processResidentMemory
+	ch <- processVirtualMemory
+	ch <- processOpenFDs
+	ch <- processThreads
+	ch <- processStartTime
 	ch <- quotaHardLimit
 	ch <- quotaSoftLimit
 	ch <- quotaUsed
 	ch <- quotaAvailable
 	ch <- quotaSoftLimitExceeded
 	ch <- quotaHardLimitExceeded
+	ch <- eventsTotal
+	ch <- logMessagesTotal
+	ch <- logLastCritical
 }
 
 // Collect collects all the metrics
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.collect(ch, e.Refresh())
+}
 
-	volumeInfo, err := ExecVolumeInfo()
-	// Couldn't parse xml, so something is really wrong and up=0
-	if err != nil {
-		log.Errorf("couldn't parse json volume info: %v", err)
-		ch <- prometheus.MustNewConstMetric(
-			up, prometheus.GaugeValue, 0.0,
-		)
+// collect sends the metrics of the snapshot and the live metrics of the events and of the logs
+func (e *Exporter) collect(ch chan<- prometheus.Metric, snapshot *Snapshot) {
+	if e.Events != nil {
+		e.Events.Collect(ch)
+	}
+	if e.Logs != nil {
+		e.Logs.Collect(ch)
 	}
+	for _, metric := range e.snapshotMetrics(snapshot) {
+		ch <- metric
+	}
+}
 
-	// use OpErrno as indicator for up
-	if i, _ := strconv.Atoi(volumeInfo.CliOutput.OpErrno); i != 0 {
+// collectSnapshot sends the metrics read from the snapshot, it doesn't query gluster
+func (e *Exporter) collectSnapshot(ch chan<- prometheus.Metric, snapshot *Snapshot) {
+
+	volumeInfo := snapshot.VolumeInfo
+	// Couldn't parse xml or OpErrno isn't 0, so something is really wrong and up=0
+	if snapshot.Up() {
 		ch <- prometheus.MustNewConstMetric(
-			up, prometheus.GaugeValue, 0.0,
+			up, prometheus.GaugeValue, 1.0,
 		)
 	} else {
 		ch <- prometheus.MustNewConstMetric(
-			up, prometheus.GaugeValue, 1.0,
+			up, prometheus.GaugeValue, 0.0,
 		)
 	}
 
-	if len(volumeInfo.CliOutput.VolInfo.Volumes.Volume) != 0 {
+	leader := 0.0
+	if snapshot.Leader {
+		leader = 1
+	}
+	ch <- prometheus.MustNewConstMetric(isLeader, prometheus.GaugeValue, leader)
+
+	// volumes, peers, heal and quota are cluster scoped, only the leader reports them
+	if snapshot.Leader && len(volumeInfo.CliOutput.VolInfo.Volumes.Volume) != 0 {
 		if i, _ := strconv.Atoi(volumeInfo.CliOutput.VolInfo.Volumes.Count); i != 0 {
 			ch <- prometheus.MustNewConstMetric(
 				volumesCount, prometheus.GaugeValue, float64(i),
@@ -217,7 +348,7 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 	}
 
 	for _, volume := range volumeInfo.CliOutput.VolInfo.Volumes.Volume {
-		if e.Volumes[0] == allVolumes || ContainsVolume(e.Volumes, volume.Name) {
+		if snapshot.Leader && e.monitored(volume.Name) {
 
 			if i, _ := strconv.Atoi(volume.BrickCount); i != 0 {
 				ch <- prometheus.MustNewConstMetric(
@@ -235,42 +366,47 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 	}
 
 	// reads gluster peer status
-	peerStatus, peerStatusErr := ExecPeerStatus()
-	if peerStatusErr != nil {
-		log.Errorf("couldn't parse json of peer status: %v", peerStatusErr)
-	}
-	count := 0
-	for range peerStatus.CliOutput.PeerStatus.Peer {
-		count++
+	if e.enabled("peer") && snapshot.Leader {
+		peerStatus := snapshot.PeerStatus
+		count := 0
+		for range peerStatus.CliOutput.PeerStatus.Peer {
+			count++
+		}
+		ch <- prometheus.MustNewConstMetric(
+			peersConnected, prometheus.GaugeValue, float64(count),
+		)
+		if snapshot.PeerStatusErr == nil {
+			for _, peer := range peerStatus.Peers() {
+				connected := 0.0
+				if peer.Connected {
+					connected = 1
+				}
+				ch <- prometheus.MustNewConstMetric(peerConnected, prometheus.GaugeValue, connected, peer.UUID, peer.Hostname)
+			}
+		}
 	}
-	ch <- prometheus.MustNewConstMetric(
-		peersConnected, prometheus.GaugeValue, float64(count),
-	)
 
 	// reads profile info
 	if e.Profile {
+		brickUUIDs := hostUUIDs(volumeInfo)
 		for _, volume := range volumeInfo.CliOutput.VolInfo.Volumes.Volume {
-			if e.Volumes[0] == allVolumes || ContainsVolume(e.Volumes, volume.Name) {
-				volumeProfile, execVolProfileErr := ExecVolumeProfileGvInfoCumulative(volume.Name)
-				if execVolProfileErr != nil {
-					log.Errorf("Error while executing or marshalling gluster profile output: %v", execVolProfileErr)
-				}
+			if volumeProfile, ok := snapshot.Profile[volume.Name]; ok {
 				for _, brick := range volumeProfile.VolProfile.Brick {
-					if strings.HasPrefix(brick.BrickName, e.Hostname) {
-						ch <- prometheus.MustNewConstMetric(
-							brickDuration, prometheus.CounterValue, float64(brick.CumulativeStats.Duration), volume.Name, brick.BrickName,
+					if e.reportBrick(strings.SplitN(brick.BrickName, ":", 2)[0], brickUUIDs[brick.BrickName]) {
+						e.counter(
+							ch, brickDuration, float64(brick.CumulativeStats.Duration), volume.Name, brick.BrickName,
 						)
 
-						ch <- prometheus.MustNewConstMetric(
-							brickDataRead, prometheus.CounterValue, float64(brick.CumulativeStats.TotalRead), volume.Name, brick.BrickName,
+						e.counter(
+							ch, brickDataRead, float64(brick.CumulativeStats.TotalRead), volume.Name, brick.BrickName,
 						)
 
-						ch <- prometheus.MustNewConstMetric(
-							brickDataWritten, prometheus.CounterValue, float64(brick.CumulativeStats.TotalWrite), volume.Name, brick.BrickName,
+						e.counter(
+							ch, brickDataWritten, float64(brick.CumulativeStats.TotalWrite), volume.Name, brick.BrickName,
 						)
 						for _, fop := range brick.CumulativeStats.FopStats.Fop {
-							ch <- prometheus.MustNewConstMetric(
-								brickFopHits, prometheus.CounterValue, float64(fop.Hits), volume.Name, brick.BrickName, fop.Name,
+							e.counter(
+								ch, brickFopHits, float64(fop.Hits), volume.Name, brick.BrickName, fop.Name,
 							)
 
 							ch <- prometheus.MustNewConstMetric(
@@ -291,14 +427,13 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 		}
 	}
 
-	// executes gluster status all detail
-	volumeStatusAll, err := ExecVolumeStatusAllDetail()
-	if err != nil {
-		log.Errorf("couldn't parse json of peer status: %v", err)
-	}
-
+	// reads gluster status all detail
+	volumeStatusAll := snapshot.VolumeStatus
 	for _, vol := range volumeStatusAll.CliOutput.VolStatus.Volumes.Volume {
 		for _, node := range vol.Node {
+			if !e.reportBrick(node.Hostname, node.Peerid) {
+				continue
+			}
 			if i, _ := strconv.Atoi(node.SizeTotal); i != 0 {
 				ch <- prometheus.MustNewConstMetric(
 					nodeSizeTotalBytes, prometheus.CounterValue, float64(i), node.Hostname, node.Path, vol.VolName,
@@ -323,163 +458,210 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 
 		}
 	}
-	vols := e.Volumes
-	if vols[0] == allVolumes {
-		log.Warn("no Volumes were given.")
-		volumeList, volumeListErr := ExecVolumeList()
-		if volumeListErr != nil {
-			log.Error(volumeListErr)
+	if e.enabled("status") {
+		e.collectBrickDevices(ch, volumeStatusAll)
+	}
+	if e.enabled("process") {
+		e.collectProcesses(ch, volumeStatusAll)
+	}
+	if e.enabled("status") {
+		for _, volume := range volumeInfo.Volumes() {
+			if !e.monitored(volume.Name) {
+				continue
+			}
+			bricks := volumeStatusAll.Bricks(volume.Name)
+			// the state of the bricks and the capacity of the volumes are cluster scoped, only the leader reports them
+			if !snapshot.Leader {
+				continue
+			}
+			// without volume status every brick would look down, the bricks of a node which is
+			// down can't be reported by the node itself so every brick is reported
+			if !e.failed(snapshot, "status") {
+				online := onlineBricks(bricks)
+				for _, brick := range volume.Bricks {
+					hostname, path := splitBrickName(brick.Name)
+					status := 0.0
+					if online[brick.Name] {
+						status = 1
+					}
+					ch <- prometheus.MustNewConstMetric(brickUp, prometheus.GaugeValue, status, volume.Name, hostname, path)
+				}
+			}
+			capacity, ok := VolumeCapacity(volume, bricks)
+			if !ok {
+				log.Warnf("Cannot compute capacity of volume %v, the status of a subvolume is unknown", volume.Name)
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				volumeUsableSizeTotal, prometheus.GaugeValue, float64(capacity.SizeTotal), volume.Name,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				volumeUsableSizeFree, prometheus.GaugeValue, float64(capacity.SizeFree), volume.Name,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				volumeImbalance, prometheus.GaugeValue, capacity.Imbalance, volume.Name,
+			)
+		}
+		if e.Forecast != nil {
+			e.Forecast.Collect(ch)
 		}
-
-		vols = volumeList.CliOutput.VolList.Volume
 	}
-
-	for _, vol := range vols {
-		filesCount, volumeHealErr := ExecVolumeHealInfo(vol)
+	for vol, healInfo := range snapshot.HealInfo {
+		filesCount, volumeHealErr := healInfo.EntriesOutOfSync()
 		if volumeHealErr == nil {
 			ch <- prometheus.MustNewConstMetric(
 				healInfoFilesCount, prometheus.CounterValue, float64(filesCount), vol,
 			)
 		}
 	}
+	for vol, splitBrain := range snapshot.SplitBrain {
+		if filesCount, err := splitBrain.EntriesOutOfSync(); err == nil {
+			ch <- prometheus.MustNewConstMetric(
+				healInfoSplitBrainCount, prometheus.GaugeValue, float64(filesCount), vol,
+			)
+		}
+	}
 
-	mountBuffer, execMountCheckErr := ExecMountCheck()
-	if execMountCheckErr != nil {
-		log.Error(execMountCheckErr)
-	} else {
-		mounts, err := parseMountOutput(mountBuffer.String())
-		if err != nil {
-			log.Error(err)
-			if len(mounts) > 0 {
-				for _, mount := range mounts {
-					ch <- prometheus.MustNewConstMetric(
-						mountSuccessful, prometheus.GaugeValue, float64(0), mount.volume, mount.mountPoint,
-					)
-				}
+	if e.enabled("mount") {
+		mounts, results := snapshot.mounts, snapshot.mountProbes
+		found := make(map[string]bool, len(mounts))
+		for _, mount := range mounts {
+			found[mount.MountPoint] = true
+			ch <- prometheus.MustNewConstMetric(
+				mountInfo, prometheus.GaugeValue, 1,
+				mount.Volume, mount.MountPoint, mount.Server, strings.Join(mount.Options, ","),
+			)
+			ch <- prometheus.MustNewConstMetric(
+				mountSuccessful, prometheus.GaugeValue, float64(1), mount.Volume, mount.MountPoint,
+			)
+		}
+		for _, mount := range mounts {
+			reason := results[mount.MountPoint].reason
+			writeable := 0.0
+			if reason == "" {
+				writeable = 1
 			}
-		} else {
-			for _, mount := range mounts {
+			ch <- prometheus.MustNewConstMetric(
+				volumeWriteable, prometheus.GaugeValue, writeable, mount.Volume, mount.MountPoint,
+			)
+			for _, r := range probeFailureReasons {
+				failed := 0.0
+				if r == reason {
+					failed = 1
+				}
 				ch <- prometheus.MustNewConstMetric(
-					mountSuccessful, prometheus.GaugeValue, float64(1), mount.volume, mount.mountPoint,
+					mountProbeFailure, prometheus.GaugeValue, failed, mount.Volume, mount.MountPoint, r,
 				)
+			}
 
-				isWriteable, err := ExecTouchOnVolumes(mount.mountPoint)
-				if err != nil {
-					log.Error(err)
+			if stat := results[mount.MountPoint].stat; stat != nil {
+				// block counts are in fragment size units
+				blockSize := float64(stat.Frsize)
+				if blockSize == 0 {
+					blockSize = float64(stat.Bsize)
 				}
-				if isWriteable {
-					ch <- prometheus.MustNewConstMetric(
-						volumeWriteable, prometheus.GaugeValue, float64(1), mount.volume, mount.mountPoint,
-					)
-				} else {
+				for desc, value := range map[*prometheus.Desc]float64{
+					mountSizeTotal:     float64(stat.Blocks) * blockSize,
+					mountSizeFree:      float64(stat.Bfree) * blockSize,
+					mountSizeAvailable: float64(stat.Bavail) * blockSize,
+					mountInodesTotal:   float64(stat.Files),
+					mountInodesFree:    float64(stat.Ffree),
+				} {
 					ch <- prometheus.MustNewConstMetric(
-						volumeWriteable, prometheus.GaugeValue, float64(0), mount.volume, mount.mountPoint,
+						desc, prometheus.GaugeValue, value, mount.Volume, mount.MountPoint,
 					)
 				}
 			}
 		}
+		e.prober().duration.Collect(ch)
+
+		if e.Benchmark != nil {
+			e.Benchmark.Collect(ch)
+		}
+		// expected mount points are reported as failed when they are not mounted
+		for _, mountPoint := range e.Mounts {
+			if !found[mountPoint] {
+				ch <- prometheus.MustNewConstMetric(
+					mountSuccessful, prometheus.GaugeValue, float64(0), "", mountPoint,
+				)
+			}
+		}
 	}
 
-	if e.Quota {
-		for _, volume := range volumeInfo.CliOutput.VolInfo.Volumes.Volume {
-			if e.Volumes[0] == allVolumes || ContainsVolume(e.Volumes, volume.Name) {
-				volumeQuotaJSON, err := ExecVolumeQuotaList(volume.Name)
-				if err != nil {
-					log.Error("Cannot create quota metrics if quotas are not enabled in your gluster server")
-				} else {
-					for _, limit := range volumeQuotaJSON.CliOutput.VolQuota.Limit {
-						if i, err := strconv.Atoi(limit.HardLimit); err != nil {
-							ch <- prometheus.MustNewConstMetric(
-								quotaHardLimit,
-								prometheus.CounterValue,
-								float64(i),
-								limit.Path,
-								volume.Name,
-							)
+	for _, volume := range volumeInfo.CliOutput.VolInfo.Volumes.Volume {
+		if volumeQuotaJSON, ok := snapshot.Quota[volume.Name]; ok {
+			for _, limit := range volumeQuotaJSON.CliOutput.VolQuota.Limit {
+				if i, err := strconv.Atoi(limit.HardLimit); err != nil {
+					ch <- prometheus.MustNewConstMetric(
+						quotaHardLimit,
+						prometheus.CounterValue,
+						float64(i),
+						limit.Path,
+						volume.Name,
+					)
 
-						}
-						if i, err := strconv.Atoi(limit.SoftLimitValue); err != nil {
-							ch <- prometheus.MustNewConstMetric(
-								quotaSoftLimit,
-								prometheus.CounterValue,
-								float64(i),
-								limit.Path,
-								volume.Name,
-							)
+				}
+				if i, err := strconv.Atoi(limit.SoftLimitValue); err != nil {
+					ch <- prometheus.MustNewConstMetric(
+						quotaSoftLimit,
+						prometheus.CounterValue,
+						float64(i),
+						limit.Path,
+						volume.Name,
+					)
 
-						}
+				}
 
-						if i, err := strconv.Atoi(limit.UsedSpace); err != nil {
-							ch <- prometheus.MustNewConstMetric(
-								quotaUsed,
-								prometheus.CounterValue,
-								float64(i),
-								limit.Path,
-								volume.Name,
-							)
+				if i, err := strconv.Atoi(limit.UsedSpace); err != nil {
+					ch <- prometheus.MustNewConstMetric(
+						quotaUsed,
+						prometheus.CounterValue,
+						float64(i),
+						limit.Path,
+						volume.Name,
+					)
 
-						}
+				}
 
-						if i, err := strconv.Atoi(limit.AvailSpace); err != nil {
-							ch <- prometheus.MustNewConstMetric(
-								quotaAvailable,
-								prometheus.CounterValue,
-								float64(i),
-								limit.Path,
-								volume.Name,
-							)
+				if i, err := strconv.Atoi(limit.AvailSpace); err != nil {
+					ch <- prometheus.MustNewConstMetric(
+						quotaAvailable,
+						prometheus.CounterValue,
+						float64(i),
+						limit.Path,
+						volume.Name,
+					)
 
-						}
+				}
 
-						slExceeded := 0.0
-						if limit.SlExceeded != "No" {
-							slExceeded = 1.0
-						}
-						ch <- prometheus.MustNewConstMetric(
-							quotaSoftLimitExceeded,
-							prometheus.CounterValue,
-							slExceeded,
-							limit.Path,
-							volume.Name,
-						)
+				slExceeded := 0.0
+				if limit.SlExceeded != "No" {
+					slExceeded = 1.0
+				}
+				ch <- prometheus.MustNewConstMetric(
+					quotaSoftLimitExceeded,
+					prometheus.CounterValue,
+					slExceeded,
+					limit.Path,
+					volume.Name,
+				)
 
-						hlExceeded := 0.0
-						if limit.HlExceeded != "No" {
-							hlExceeded = 1.0
-						}
-						ch <- prometheus.MustNewConstMetric(
-							quotaHardLimitExceeded,
-							prometheus.CounterValue,
-							hlExceeded,
-							limit.Path,
-							volume.Name,
-						)
-					}
+				hlExceeded := 0.0
+				if limit.HlExceeded != "No" {
+					hlExceeded = 1.0
 				}
+				ch <- prometheus.MustNewConstMetric(
+					quotaHardLimitExceeded,
+					prometheus.CounterValue,
+					hlExceeded,
+					limit.Path,
+					volume.Name,
+				)
 			}
 		}
 	}
 }
 
-type mount struct {
-	mountPoint string
-	volume     string
-}
-
-// ParseMountOutput pares output of system execution 'mount'
-func parseMountOutput(mountBuffer string) ([]mount, error) {
-	mounts := make([]mount, 0, 2)
-	mountRows := strings.Split(mountBuffer, "\n")
-	for _, row := range mountRows {
-		trimmedRow := strings.TrimSpace(row)
-		if len(row) > 3 {
-			mountColumns := strings.Split(trimmedRow, " ")
-			mounts = append(mounts, mount{mountPoint: mountColumns[2], volume: mountColumns[0]})
-		}
-	}
-	return mounts, nil
-}
-
 // ContainsVolume checks a slice if it contains an element
 func ContainsVolume(slice []string, element string) bool {
 	for _, a := range slice {
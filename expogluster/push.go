@@ -0,0 +1,325 @@
+package expogluster
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// push modes
+const (
+	pushModePushgateway = "pushgateway"
+	pushModeRemoteWrite = "remote_write"
+)
+
+// Pusher pushes the metrics of the last snapshot on an interval, to a Pushgateway or with
+// the Prometheus remote-write protocol, for the sites which can't be scraped
+type Pusher struct {
+	// Mode is "pushgateway" or "remote_write"
+	Mode string
+	// URL of the Pushgateway or of the remote-write receiver
+	URL string
+	// Interval is the time between two pushes
+	Interval time.Duration
+	// Timeout is the deadline of each request
+	Timeout time.Duration
+	// Retries is the number of retries of a failed request, the backoff doubles after each retry
+	Retries int
+	// Job is the job label of the pushed metrics
+	Job string
+	// Cluster is the cluster label of the pushed metrics, omitted when empty
+	Cluster string
+	// Username and Password of the basic authentication, disabled when Username is empty
+	Username string
+	Password string
+	// QueueDir holds the remote-write requests which failed during an outage, to send them later
+	QueueDir string
+	// QueueSize is the maximum number of queued requests, the oldest are dropped
+	QueueSize int
+
+	client *http.Client
+}
+
+// NewPusher creates the push output from environment variables, it returns nil when no push mode is configured
+func NewPusher() *Pusher {
+	mode := getEnv("PROM_PUSH_MODE", "")
+	if mode == "" {
+		return nil
+	}
+	if mode != pushModePushgateway && mode != pushModeRemoteWrite {
+		log.Fatalf("Unknown push mode: %v", mode)
+	}
+	url := getEnv("PROM_PUSH_URL", "")
+	if url == "" {
+		log.Fatalf("PROM_PUSH_URL is required by push mode %v", mode)
+	}
+	pusher := &Pusher{
+		Mode:      mode,
+		URL:       url,
+		Interval:  time.Duration(parseInt(getEnv("PROM_PUSH_INTERVAL", "60"))) * time.Second,
+		Timeout:   time.Duration(parseInt(getEnv("PROM_PUSH_TIMEOUT", "10"))) * time.Second,
+		Retries:   parseInt(getEnv("PROM_PUSH_RETRIES", "3")),
+		Job:       getEnv("PROM_PUSH_JOB", "gluster"),
+		Cluster:   getEnv("PROM_PUSH_CLUSTER", ""),
+		Username:  getEnv("PROM_PUSH_USERNAME", ""),
+		Password:  getEnv("PROM_PUSH_PASSWORD", ""),
+		QueueDir:  getEnv("PROM_PUSH_QUEUE_DIR", "/var/lib/gluster_exporter/queue"),
+		QueueSize: parseInt(getEnv("PROM_PUSH_QUEUE_SIZE", "1000")),
+	}
+	// invalid numbers are parsed as 0, time.Tick returns nil for 0 and the pushes would never run
+	if pusher.Interval <= 0 {
+		log.Fatalf("PROM_PUSH_INTERVAL must be a positive number of seconds: %v", getEnv("PROM_PUSH_INTERVAL", ""))
+	}
+	if pusher.Timeout <= 0 {
+		log.Fatalf("PROM_PUSH_TIMEOUT must be a positive number of seconds: %v", getEnv("PROM_PUSH_TIMEOUT", ""))
+	}
+	return pusher
+}
+
+// Start pushes the metrics of the exporter in background
+func (p *Pusher) Start(e *Exporter) {
+	p.client = &http.Client{Timeout: p.Timeout}
+	go func() {
+		for range time.Tick(p.Interval) {
+			if err := p.Push(e); err != nil {
+				log.Errorf("Cannot push metrics to %v: %v", p.URL, err)
+			}
+		}
+	}()
+}
+
+// Push sends the metrics of the last snapshot of the exporter
+func (p *Pusher) Push(e *Exporter) error {
+	families, err := e.gatherSnapshot(p.Interval)
+	if err != nil {
+		return err
+	}
+	instance := e.instance()
+	if p.Mode == pushModePushgateway {
+		return p.retry(func() (bool, error) {
+			return p.pushGateway(families, instance)
+		})
+	}
+	return p.remoteWrite(families, instance)
+}
+
+// statusDoer records the outcome of the last request, the errors of the Pushgateway client only have it in their text
+type statusDoer struct {
+	client *http.Client
+	status int
+	err    error
+}
+
+func (d *statusDoer) Do(req *http.Request) (*http.Response, error) {
+	resp, err := d.client.Do(req)
+	d.err = err
+	if err == nil {
+		d.status = resp.StatusCode
+	}
+	return resp, err
+}
+
+// pushGateway replaces the metrics of the group of the node in the Pushgateway, it is retryable like send.
+// Failed pushes aren't queued since the Pushgateway keeps only the last push
+func (p *Pusher) pushGateway(families []*dto.MetricFamily, instance string) (bool, error) {
+	doer := &statusDoer{client: p.httpClient()}
+	pusher := push.New(p.URL, p.Job).
+		Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return families, nil })).
+		Grouping("instance", instance).
+		Client(doer)
+	if p.Cluster != "" {
+		pusher = pusher.Grouping("cluster", p.Cluster)
+	}
+	if p.Username != "" {
+		pusher = pusher.BasicAuth(p.Username, p.Password)
+	}
+	if err := pusher.Push(); err != nil {
+		return doer.err != nil || retryableStatus(doer.status), err
+	}
+	return false, nil
+}
+
+// remoteWrite sends the queued requests then the metrics, the request is queued when the receiver is unavailable
+func (p *Pusher) remoteWrite(families []*dto.MetricFamily, instance string) error {
+	labels := map[string]string{"job": p.Job, "instance": instance}
+	if p.Cluster != "" {
+		labels["cluster"] = p.Cluster
+	}
+	body := snappy.Encode(nil, encodeWriteRequest(families, labels, time.Now()))
+
+	if err := p.sendQueue(); err != nil {
+		p.enqueue(body)
+		return err
+	}
+	err := p.retry(func() (bool, error) {
+		return p.send(body)
+	})
+	if _, ok := err.(recoverableError); ok {
+		p.enqueue(body)
+	}
+	return err
+}
+
+// recoverableError is a failed request which can be sent again
+type recoverableError struct {
+	error
+}
+
+// send posts a remote-write request, server errors and throttling are recoverable, other errors aren't
+func (p *Pusher) send(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if p.Username != "" {
+		req.SetBasicAuth(p.Username, p.Password)
+	}
+	resp, err := p.httpClient().Do(req)
+	if err != nil {
+		return true, recoverableError{err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	message, _ := ioutil.ReadAll(resp.Body)
+	err = fmt.Errorf("unexpected status %v: %s", resp.Status, bytes.TrimSpace(message))
+	if retryableStatus(resp.StatusCode) {
+		return true, recoverableError{err}
+	}
+	return false, err
+}
+
+// retryableStatus checks if a request which failed with the status can be sent again, after server errors and throttling
+func retryableStatus(status int) bool {
+	return status/100 == 5 || status == http.StatusTooManyRequests
+}
+
+// retry calls fn until it succeeds or fails with an error which can't be retried, waiting
+// one second before the first retry, the wait doubles after each retry
+func (p *Pusher) retry(fn func() (bool, error)) error {
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		retryable, err := fn()
+		if err == nil || !retryable || attempt >= p.Retries {
+			return err
+		}
+		log.Warnf("Push to %v failed, retrying in %v: %v", p.URL, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (p *Pusher) httpClient() *http.Client {
+	if p.client == nil {
+		return &http.Client{Timeout: p.Timeout}
+	}
+	return p.client
+}
+
+// queued lists the queued requests, oldest first
+func (p *Pusher) queued() []string {
+	files, _ := filepath.Glob(filepath.Join(p.QueueDir, "*.snappy"))
+	sort.Strings(files)
+	return files
+}
+
+// enqueue writes the request in the queue directory, the oldest requests are dropped when the queue is full
+func (p *Pusher) enqueue(body []byte) {
+	if err := os.MkdirAll(p.QueueDir, 0755); err != nil {
+		log.Errorf("Cannot create push queue %v: %v", p.QueueDir, err)
+		return
+	}
+	// the name sorts by time, it is written under a temporary name so a partial request is never sent
+	name := filepath.Join(p.QueueDir, fmt.Sprintf("%020d.snappy", time.Now().UnixNano()))
+	if err := ioutil.WriteFile(name+".tmp", body, 0644); err != nil {
+		log.Errorf("Cannot queue push request: %v", err)
+		return
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		log.Errorf("Cannot queue push request: %v", err)
+		return
+	}
+	files := p.queued()
+	for len(files) > p.QueueSize {
+		log.Warnf("Push queue %v is full, dropping %v", p.QueueDir, files[0])
+		os.Remove(files[0])
+		files = files[1:]
+	}
+}
+
+// sendQueue sends the queued requests oldest first, it stops at the first recoverable error
+func (p *Pusher) sendQueue() error {
+	for _, file := range p.queued() {
+		body, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Errorf("Cannot read queued push request %v: %v", file, err)
+			os.Remove(file)
+			continue
+		}
+		if _, err := p.send(body); err != nil {
+			if _, ok := err.(recoverableError); ok {
+				return err
+			}
+			log.Errorf("Dropping queued push request %v: %v", file, err)
+		}
+		os.Remove(file)
+	}
+	return nil
+}
+
+// encodeWriteRequest encodes the metric families as a remote-write WriteRequest protobuf message
+func encodeWriteRequest(families []*dto.MetricFamily, externalLabels map[string]string, now time.Time) []byte {
+	timestamp := now.UnixNano() / int64(time.Millisecond)
+	var request []byte
+	for _, sample := range flatten(families, externalLabels) {
+		sample.labels["__name__"] = sample.name
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, encodeTimeSeries(sample.labels, sample.value, timestamp))
+	}
+	return request
+}
+
+// encodeTimeSeries encodes a TimeSeries message with a single sample, its labels sorted by name
+func encodeTimeSeries(labels map[string]string, value float64, timestamp int64) []byte {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var series []byte
+	for _, name := range names {
+		var label []byte
+		label = protowire.AppendTag(label, 1, protowire.BytesType)
+		label = protowire.AppendString(label, name)
+		label = protowire.AppendTag(label, 2, protowire.BytesType)
+		label = protowire.AppendString(label, labels[name])
+		series = protowire.AppendTag(series, 1, protowire.BytesType)
+		series = protowire.AppendBytes(series, label)
+	}
+	var sample []byte
+	sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+	sample = protowire.AppendFixed64(sample, math.Float64bits(value))
+	sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, uint64(timestamp))
+	series = protowire.AppendTag(series, 2, protowire.BytesType)
+	series = protowire.AppendBytes(series, sample)
+	return series
+}
@@ -0,0 +1,229 @@
+package expogluster
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// remoteWriteServer answers the remote-write requests with the given statuses, then with 204
+type remoteWriteServer struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []prompb.WriteRequest
+}
+
+func (s *remoteWriteServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.statuses) > 0 {
+		status := s.statuses[0]
+		s.statuses = s.statuses[1:]
+		if status/100 != 2 {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+	}
+	compressed, _ := ioutil.ReadAll(r.Body)
+	body, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var request prompb.WriteRequest
+	if err := request.Unmarshal(body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.requests = append(s.requests, request)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var pushFamilies = []*dto.MetricFamily{{
+	Name: proto.String("gluster_up"),
+	Type: dto.MetricType_GAUGE.Enum(),
+	Metric: []*dto.Metric{
+		{Label: labelPairs("volume", "gfs"), Gauge: &dto.Gauge{Value: proto.Float64(1)}},
+	},
+}}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	now := time.Unix(1600000000, 123000000)
+	var request prompb.WriteRequest
+	body := encodeWriteRequest(pushFamilies, map[string]string{"job": "gluster", "instance": "node1"}, now)
+	if err := request.Unmarshal(body); err != nil {
+		t.Fatal(err)
+	}
+	if len(request.Timeseries) != 1 {
+		t.Fatalf("%v series, expected 1", len(request.Timeseries))
+	}
+	series := request.Timeseries[0]
+	expected := []prompb.Label{
+		{Name: "__name__", Value: "gluster_up"},
+		{Name: "instance", Value: "node1"},
+		{Name: "job", Value: "gluster"},
+		{Name: "volume", Value: "gfs"},
+	}
+	if len(series.Labels) != len(expected) {
+		t.Fatalf("labels %v, expected %v", series.Labels, expected)
+	}
+	for i := range expected {
+		if series.Labels[i].Name != expected[i].Name || series.Labels[i].Value != expected[i].Value {
+			t.Errorf("labels %v, expected %v sorted by name", series.Labels, expected)
+			break
+		}
+	}
+	if len(series.Samples) != 1 || series.Samples[0].Value != 1 || series.Samples[0].Timestamp != 1600000000123 {
+		t.Errorf("samples %v", series.Samples)
+	}
+}
+
+func newTestPusher(t *testing.T, url string) (*Pusher, func()) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pusher := &Pusher{
+		Mode:      pushModeRemoteWrite,
+		URL:       url,
+		Timeout:   time.Second,
+		Job:       "gluster",
+		QueueDir:  filepath.Join(dir, "queue"),
+		QueueSize: 10,
+	}
+	return pusher, func() { os.RemoveAll(dir) }
+}
+
+func TestRemoteWriteRetry(t *testing.T) {
+	receiver := &remoteWriteServer{statuses: []int{http.StatusServiceUnavailable}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	pusher, cleanup := newTestPusher(t, server.URL)
+	defer cleanup()
+
+	// a server error is retried
+	pusher.Retries = 1
+	if err := pusher.remoteWrite(pushFamilies, "node1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(receiver.requests) != 1 || len(pusher.queued()) != 0 {
+		t.Fatalf("%v requests received, %v queued, expected the retry to succeed", len(receiver.requests), len(pusher.queued()))
+	}
+
+	// a request rejected by the receiver is neither retried nor queued
+	receiver.statuses = []int{http.StatusBadRequest, http.StatusBadRequest}
+	if err := pusher.remoteWrite(pushFamilies, "node1"); err == nil {
+		t.Fatal("a rejected request didn't fail")
+	}
+	if len(receiver.statuses) != 1 || len(pusher.queued()) != 0 {
+		t.Errorf("the rejected request was retried or queued")
+	}
+}
+
+func TestRemoteWriteQueue(t *testing.T) {
+	receiver := &remoteWriteServer{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	pusher, cleanup := newTestPusher(t, server.URL)
+	defer cleanup()
+
+	// the requests which failed during an outage are queued, then sent oldest first
+	receiver.statuses = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}
+	for i := 0; i < 2; i++ {
+		if err := pusher.remoteWrite(pushFamilies, "node1"); err == nil {
+			t.Fatal("a push during an outage didn't fail")
+		}
+	}
+	if queued := len(pusher.queued()); queued != 2 {
+		t.Fatalf("%v requests queued, expected 2", queued)
+	}
+	if err := pusher.remoteWrite(pushFamilies, "node1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(receiver.requests) != 3 || len(pusher.queued()) != 0 {
+		t.Fatalf("%v requests received, %v queued, expected 3 received", len(receiver.requests), len(pusher.queued()))
+	}
+	for i := 1; i < len(receiver.requests); i++ {
+		previous := receiver.requests[i-1].Timeseries[0].Samples[0].Timestamp
+		if current := receiver.requests[i].Timeseries[0].Samples[0].Timestamp; current < previous {
+			t.Errorf("queued requests weren't sent oldest first")
+		}
+	}
+
+	// the oldest requests are dropped when the queue is full
+	pusher.QueueSize = 2
+	for _, body := range []string{"first", "second", "third"} {
+		pusher.enqueue([]byte(body))
+	}
+	queued := pusher.queued()
+	if len(queued) != 2 {
+		t.Fatalf("%v requests queued, expected 2", len(queued))
+	}
+	if body, _ := ioutil.ReadFile(queued[0]); string(body) != "second" {
+		t.Errorf("oldest queued request %q, expected second", body)
+	}
+}
+
+func TestPushgatewayRetry(t *testing.T) {
+	statuses := []int{}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Method != http.MethodPut || r.URL.Path != "/metrics/job/gluster/instance/node1" {
+			t.Errorf("%v %v, expected a PUT of the group of the node", r.Method, r.URL.Path)
+		}
+		if len(statuses) > 0 {
+			http.Error(w, "push failed", statuses[0])
+			statuses = statuses[1:]
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	pusher, cleanup := newTestPusher(t, server.URL)
+	defer cleanup()
+	pusher.Mode = pushModePushgateway
+	pusher.Retries = 1
+
+	// server errors and throttling are retried
+	statuses = []int{http.StatusServiceUnavailable}
+	if retryable, err := pusher.pushGateway(pushFamilies, "node1"); err == nil || !retryable {
+		t.Errorf("push to an unavailable Pushgateway: retryable %v, error %v", retryable, err)
+	}
+	statuses = []int{http.StatusTooManyRequests}
+	if err := pusher.retry(func() (bool, error) { return pusher.pushGateway(pushFamilies, "node1") }); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 3 {
+		t.Errorf("%d requests, expected the throttled push to be retried", requests)
+	}
+
+	// a push rejected by the Pushgateway isn't retried
+	requests = 0
+	statuses = []int{http.StatusBadRequest, http.StatusBadRequest}
+	if retryable, err := pusher.pushGateway(pushFamilies, "node1"); err == nil || retryable {
+		t.Errorf("rejected push: retryable %v, error %v", retryable, err)
+	}
+	if err := pusher.retry(func() (bool, error) { return pusher.pushGateway(pushFamilies, "node1") }); err == nil {
+		t.Error("a rejected push didn't fail")
+	}
+	if requests != 2 {
+		t.Errorf("%d requests, the rejected push was retried", requests)
+	}
+
+	// unreachable Pushgateways are retried
+	pusher.URL = "http://127.0.0.1:1"
+	if retryable, err := pusher.pushGateway(pushFamilies, "node1"); err == nil || !retryable {
+		t.Errorf("push to an unreachable Pushgateway: retryable %v, error %v", retryable, err)
+	}
+}
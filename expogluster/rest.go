@@ -0,0 +1,361 @@
+package expogluster
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// REST is the backend querying the REST management API of GlusterD2
+type REST struct {
+	// URL of the management API, e.g. http://localhost:24007
+	URL string
+	// User and Secret sign requests with a JWT token, requests aren't signed when Secret is empty
+	User   string
+	Secret string
+	Client *http.Client
+}
+
+// restVolume is the volume of "GET /v1/volumes" response
+type restVolume struct {
+	ID                      string            `json:"id"`
+	Name                    string            `json:"name"`
+	Type                    string            `json:"type"`
+	Transport               string            `json:"transport"`
+	DistributeCount         int               `json:"distribute-count"`
+	ReplicaCount            int               `json:"replica-count"`
+	ArbiterCount            int               `json:"arbiter-count"`
+	DisperseCount           int               `json:"disperse-count"`
+	DisperseRedundancyCount int               `json:"disperse-redundancy-count"`
+	Options                 map[string]string `json:"options"`
+	State                   string            `json:"state"`
+	Subvols                 []struct {
+		Bricks []restBrick `json:"bricks"`
+	} `json:"subvols"`
+}
+
+// restBrick is the brick info of GlusterD2 responses
+type restBrick struct {
+	ID         string `json:"id"`
+	Path       string `json:"path"`
+	VolumeName string `json:"volume-name"`
+	PeerID     string `json:"peer-id"`
+	Hostname   string `json:"host"`
+	Type       string `json:"type"`
+}
+
+// restBrickStatus is the brick of "GET /v1/volumes/{name}/bricks" response
+type restBrickStatus struct {
+	Info      restBrick `json:"info"`
+	Online    bool      `json:"online"`
+	Pid       int       `json:"pid"`
+	Port      int       `json:"port"`
+	FS        string    `json:"fs-type"`
+	MountOpts string    `json:"mount-opts"`
+	Device    string    `json:"device"`
+	BlockSize uint64    `json:"block-size"`
+	Size      struct {
+		Capacity uint64 `json:"capacity"`
+		Free     uint64 `json:"free"`
+	} `json:"size"`
+	TotalInodes uint64 `json:"total-inodes"`
+	FreeInodes  uint64 `json:"free-inodes"`
+}
+
+// restPeer is the peer of "GET /v1/peers" response
+type restPeer struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	PeerAddresses []string `json:"peer-addresses"`
+	Online        bool     `json:"online"`
+}
+
+// restHealInfo is the brick of "GET /v1/volumes/{name}/heal-info" response
+type restHealInfo struct {
+	HostID       string `json:"host-id"`
+	Name         string `json:"name"`
+	Status       string `json:"status"`
+	TotalEntries *int64 `json:"total-entries"`
+}
+
+// restError is the error body of GlusterD2 responses
+type restError struct {
+	Errors []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// restVolumeTypes converts GlusterD2 volume types to typeStr of "gluster volume info"
+var restVolumeTypes = map[string]string{
+	"Distribute":    "Distribute",
+	"Replicate":     "Replicate",
+	"Disperse":      "Disperse",
+	"DistReplicate": "Distributed-Replicate",
+	"DistDisperse":  "Distributed-Disperse",
+}
+
+// restVolumeStates converts GlusterD2 volume states to status of "gluster volume info"
+var restVolumeStates = map[string]string{
+	"Created": "0",
+	"Started": "1",
+	"Stopped": "2",
+}
+
+// NewREST creates the REST backend from environment variables, the secret
+// is read from PROM_REST_SECRET_FILE when given (GlusterD2 keeps it in /var/lib/glusterd2/auth)
+func NewREST() *REST {
+	rest := &REST{
+		URL:    getEnv("PROM_REST_URL", "http://localhost:24007"),
+		User:   getEnv("PROM_REST_USER", "glustercli"),
+		Secret: getEnv("PROM_REST_SECRET", ""),
+		Client: &http.Client{
+			Timeout: time.Duration(parseInt(getEnv("PROM_REST_TIMEOUT", "10"))) * time.Second,
+		},
+	}
+	if secretFile := getEnv("PROM_REST_SECRET_FILE", ""); secretFile != "" {
+		secret, err := ioutil.ReadFile(secretFile)
+		if err != nil {
+			log.Fatalf("couldn't read REST secret file: %v", err)
+		}
+		rest.Secret = strings.TrimSpace(string(secret))
+	}
+	return rest
+}
+
+// token creates the JWT token expected by GlusterD2, qsh claim binds the token to the request
+func (r *REST) token(method, path string) string {
+	qsh := sha256.Sum256([]byte(method + "&" + path))
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss": r.User,
+		"iat": now.Unix(),
+		"exp": now.Add(10 * time.Second).Unix(),
+		"qsh": hex.EncodeToString(qsh[:]),
+	})
+
+	encoding := base64.RawURLEncoding
+	unsigned := encoding.EncodeToString(header) + "." + encoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, []byte(r.Secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + encoding.EncodeToString(mac.Sum(nil))
+}
+
+// get requests the path of the management API and unmarshalls the response
+func (r *REST) get(path string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(r.URL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	if r.Secret != "" {
+		req.Header.Set("Authorization", "bearer "+r.token(req.Method, req.URL.Path))
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var restErr restError
+		if json.NewDecoder(resp.Body).Decode(&restErr) == nil && len(restErr.Errors) > 0 {
+			return fmt.Errorf("%v %v: %v", req.Method, path, restErr.Errors[0].Message)
+		}
+		return fmt.Errorf("%v %v: %v", req.Method, path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (r *REST) volumes() ([]restVolume, error) {
+	var volumes []restVolume
+	err := r.get("/v1/volumes", &volumes)
+	return volumes, err
+}
+
+// VolumeInfo queries the volumes and converts them to VolumeInfoJSON struct
+func (r *REST) VolumeInfo() (VolumeInfoJSON, error) {
+	var volumeInfo VolumeInfoJSON
+	volumes, err := r.volumes()
+	if err != nil {
+		return volumeInfo, err
+	}
+
+	for _, vol := range volumes {
+		volume := VolumeInfoVolume{
+			Name:            vol.Name,
+			ID:              vol.ID,
+			Status:          restVolumeStates[vol.State],
+			StatusStr:       vol.State,
+			TypeStr:         restVolumeTypes[vol.Type],
+			Transport:       vol.Transport,
+			DistCount:       strconv.Itoa(vol.DistributeCount),
+			ReplicaCount:    strconv.Itoa(vol.ReplicaCount),
+			ArbiterCount:    strconv.Itoa(vol.ArbiterCount),
+			DisperseCount:   strconv.Itoa(vol.DisperseCount),
+			RedundancyCount: strconv.Itoa(vol.DisperseRedundancyCount),
+			OptCount:        strconv.Itoa(len(vol.Options)),
+		}
+		for name, value := range vol.Options {
+			volume.Options.Option = append(volume.Options.Option, VolumeInfoOption{Name: name, Value: value})
+		}
+		for _, subvol := range vol.Subvols {
+			for _, brick := range subvol.Bricks {
+				isArbiter := "0"
+				if brick.Type == "Arbiter" {
+					isArbiter = "1"
+				}
+				volume.Bricks.Brick = append(volume.Bricks.Brick, VolumeInfoBrick{
+					UUID:      brick.ID,
+					Name:      brick.Hostname + ":" + brick.Path,
+					HostUUID:  brick.PeerID,
+					IsArbiter: isArbiter,
+				})
+			}
+		}
+		volume.BrickCount = strconv.Itoa(len(volume.Bricks.Brick))
+		volumeInfo.CliOutput.VolInfo.Volumes.Volume = append(volumeInfo.CliOutput.VolInfo.Volumes.Volume, volume)
+	}
+	volumeInfo.CliOutput.VolInfo.Volumes.Count = strconv.Itoa(len(volumes))
+	volumeInfo.CliOutput.OpRet = "0"
+	volumeInfo.CliOutput.OpErrno = "0"
+	return volumeInfo, nil
+}
+
+// VolumeList queries the volumes and converts them to VolumeListJSON struct
+func (r *REST) VolumeList() (*VolumeListJSON, error) {
+	volumeList := &VolumeListJSON{}
+	volumes, err := r.volumes()
+	if err != nil {
+		return volumeList, err
+	}
+	for _, vol := range volumes {
+		volumeList.CliOutput.VolList.Volume = append(volumeList.CliOutput.VolList.Volume, vol.Name)
+	}
+	volumeList.CliOutput.VolList.Count = strconv.Itoa(len(volumes))
+	return volumeList, nil
+}
+
+// PeerStatus queries the peers and converts them to PeerStatusJSON struct
+func (r *REST) PeerStatus() (*PeerStatusJSON, error) {
+	peerStatus := &PeerStatusJSON{}
+	var peers []restPeer
+	if err := r.get("/v1/peers", &peers); err != nil {
+		return peerStatus, err
+	}
+	for _, p := range peers {
+		peer := PeerStatusPeer{
+			UUID:      p.ID,
+			Hostname:  p.Name,
+			Connected: "0",
+			StateStr:  "Peer in Cluster",
+			State:     "3",
+		}
+		if len(p.PeerAddresses) > 0 {
+			peer.Hostnames.Hostname = p.PeerAddresses[0]
+		}
+		if p.Online {
+			peer.Connected = "1"
+		}
+		peerStatus.CliOutput.PeerStatus.Peer = append(peerStatus.CliOutput.PeerStatus.Peer, peer)
+	}
+	return peerStatus, nil
+}
+
+// VolumeStatus queries bricks status of each volume and converts them to VolumeStatusJSON struct
+func (r *REST) VolumeStatus() (*VolumeStatusJSON, error) {
+	volumeStatus := &VolumeStatusJSON{}
+	volumes, err := r.volumes()
+	if err != nil {
+		return volumeStatus, err
+	}
+
+	for _, vol := range volumes {
+		var bricks []restBrickStatus
+		if err := r.get("/v1/volumes/"+url.PathEscape(vol.Name)+"/bricks", &bricks); err != nil {
+			return volumeStatus, err
+		}
+		volume := VolumeStatusVolume{VolName: vol.Name, NodeCount: strconv.Itoa(len(bricks))}
+		for _, brick := range bricks {
+			node := VolumeStatusNode{
+				Hostname:    brick.Info.Hostname,
+				Peerid:      brick.Info.PeerID,
+				Path:        brick.Info.Path,
+				Pid:         strconv.Itoa(brick.Pid),
+				Port:        strconv.Itoa(brick.Port),
+				FsName:      brick.FS,
+				MntOptions:  brick.MountOpts,
+				Device:      brick.Device,
+				BlockSize:   strconv.FormatUint(brick.BlockSize, 10),
+				SizeTotal:   strconv.FormatUint(brick.Size.Capacity, 10),
+				SizeFree:    strconv.FormatUint(brick.Size.Free, 10),
+				InodesTotal: strconv.FormatUint(brick.TotalInodes, 10),
+				InodesFree:  strconv.FormatUint(brick.FreeInodes, 10),
+				Status:      "0",
+			}
+			node.Ports.TCP = node.Port
+			if brick.Online {
+				node.Status = "1"
+			}
+			volume.Node = append(volume.Node, node)
+		}
+		volumeStatus.CliOutput.VolStatus.Volumes.Volume = append(volumeStatus.CliOutput.VolStatus.Volumes.Volume, volume)
+	}
+	volumeStatus.CliOutput.OpRet = "0"
+	volumeStatus.CliOutput.OpErrno = "0"
+	return volumeStatus, nil
+}
+
+// VolumeHealInfo queries heal info of the volume and converts it to VolumeHealInfoJSON struct
+func (r *REST) VolumeHealInfo(volumeName string) (*VolumeHealInfoJSON, error) {
+	healInfo := &VolumeHealInfoJSON{}
+	var bricks []restHealInfo
+	if err := r.get("/v1/volumes/"+url.PathEscape(volumeName)+"/heal-info", &bricks); err != nil {
+		return healInfo, err
+	}
+	for _, brick := range bricks {
+		// entries of disconnected bricks are unknown, as "-" in the command line output
+		entries := "-"
+		if brick.TotalEntries != nil {
+			entries = strconv.FormatInt(*brick.TotalEntries, 10)
+		}
+		healInfo.HealInfo.Bricks.Brick = append(healInfo.HealInfo.Bricks.Brick, HealInfoBrick{
+			HostUUID:        brick.HostID,
+			Name:            brick.Name,
+			Status:          brick.Status,
+			NumberOfEntries: entries,
+		})
+	}
+	return healInfo, nil
+}
+
+// VolumeHealSplitBrain isn't available in the management API
+func (r *REST) VolumeHealSplitBrain(volumeName string) (*VolumeHealInfoJSON, error) {
+	return &VolumeHealInfoJSON{}, fmt.Errorf("volume heal split-brain info: %w", ErrUnsupported)
+}
+
+// VolumeProfile isn't available in the management API
+func (r *REST) VolumeProfile(volumeName string) (*VolumeProfileJSON, error) {
+	return &VolumeProfileJSON{}, fmt.Errorf("volume profile: %w", ErrUnsupported)
+}
+
+// VolumeQuotaList isn't available in the management API
+func (r *REST) VolumeQuotaList(volumeName string) (VolumeQuotaJSON, error) {
+	return VolumeQuotaJSON{}, fmt.Errorf("volume quota: %w", ErrUnsupported)
+}
@@ -0,0 +1,316 @@
+package expogluster
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// verifyToken checks the token as GlusterD2 does, it returns its claims, nil when the token is invalid
+func verifyToken(t *testing.T, r *http.Request, secret string) map[string]interface{} {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "bearer ") {
+		t.Errorf("authorization header %q", auth)
+		return nil
+	}
+	parts := strings.Split(strings.TrimPrefix(auth, "bearer "), ".")
+	if len(parts) != 3 {
+		t.Errorf("token %q isn't a JWT", auth)
+		return nil
+	}
+
+	encoding := base64.RawURLEncoding
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+		t.Error("invalid token signature")
+		return nil
+	}
+
+	var header map[string]string
+	if b, err := encoding.DecodeString(parts[0]); err != nil || json.Unmarshal(b, &header) != nil {
+		t.Errorf("invalid token header %q", parts[0])
+		return nil
+	}
+	if header["alg"] != "HS256" || header["typ"] != "JWT" {
+		t.Errorf("token header %v", header)
+	}
+	var claims map[string]interface{}
+	if b, err := encoding.DecodeString(parts[1]); err != nil || json.Unmarshal(b, &claims) != nil {
+		t.Errorf("invalid token claims %q", parts[1])
+		return nil
+	}
+	return claims
+}
+
+func TestRESTToken(t *testing.T) {
+	var claims map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims = verifyToken(t, r, "secret"); claims == nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		qsh := sha256.Sum256([]byte(r.Method + "&" + r.URL.Path))
+		if claims["qsh"] != hex.EncodeToString(qsh[:]) {
+			t.Errorf("qsh claim %v doesn't match %v %v", claims["qsh"], r.Method, r.URL.Path)
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	rest := &REST{URL: server.URL + "/", User: "glustercli", Secret: "secret"}
+	if _, err := rest.VolumeHealInfo("gfs"); err != nil {
+		t.Fatal(err)
+	}
+	if claims["iss"] != "glustercli" {
+		t.Errorf("iss claim %v, expected glustercli", claims["iss"])
+	}
+	iat, _ := claims["iat"].(float64)
+	exp, _ := claims["exp"].(float64)
+	if now := float64(time.Now().Unix()); iat > now || iat < now-5 || exp <= iat {
+		t.Errorf("iat claim %v, exp claim %v, now %v", iat, exp, now)
+	}
+}
+
+func TestRESTWithoutSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("unexpected authorization header %q", auth)
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	rest := &REST{URL: server.URL}
+	if _, err := rest.VolumeInfo(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRESTErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/peers" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errors":[{"code":1,"message":"invalid token"}]}`))
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	rest := &REST{URL: server.URL, Secret: "wrong"}
+	if _, err := rest.PeerStatus(); err == nil || err.Error() != "GET /v1/peers: invalid token" {
+		t.Errorf("error %v, expected the message of GlusterD2", err)
+	}
+	if _, err := rest.VolumeInfo(); err == nil || err.Error() != "GET /v1/volumes: 502 Bad Gateway" {
+		t.Errorf("error %v, expected the response status", err)
+	}
+
+	if _, err := rest.VolumeProfile("gfs"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("profile error %v, expected %v", err, ErrUnsupported)
+	}
+	if _, err := rest.VolumeQuotaList("gfs"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("quota error %v, expected %v", err, ErrUnsupported)
+	}
+	if _, err := rest.VolumeHealSplitBrain("gfs"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("split-brain error %v, expected %v", err, ErrUnsupported)
+	}
+}
+
+func TestRESTHealInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/volumes/gfs/heal-info" {
+			t.Errorf("unexpected path %v", r.URL.Path)
+		}
+		w.Write([]byte(`[
+			{"host-id":"u1","name":"server1:/data/brick","status":"Connected","total-entries":3},
+			{"host-id":"u2","name":"server2:/data/brick","status":"Transport endpoint is not connected"}
+		]`))
+	}))
+	defer server.Close()
+
+	healInfo, err := (&REST{URL: server.URL}).VolumeHealInfo("gfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bricks := healInfo.HealInfo.Bricks.Brick
+	if len(bricks) != 2 {
+		t.Fatalf("%v bricks, expected 2", len(bricks))
+	}
+	if bricks[0].NumberOfEntries != "3" || bricks[0].HostUUID != "u1" {
+		t.Errorf("connected brick %+v", bricks[0])
+	}
+	// the entries of a disconnected brick are unknown
+	if bricks[1].NumberOfEntries != "-" {
+		t.Errorf("disconnected brick entries %q, expected -", bricks[1].NumberOfEntries)
+	}
+}
+
+// newRecordedREST serves responses of GlusterD2 recorded in testdata, by path
+func newRecordedREST(t *testing.T, fixtures map[string]string) (*REST, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fixture, ok := fixtures[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[{"code":2,"message":"not found"}]}`))
+			return
+		}
+		content, err := ioutil.ReadFile(filepath.Join("testdata", fixture))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(content)
+	}))
+	return &REST{URL: server.URL}, server.Close
+}
+
+func TestRESTVolumeInfo(t *testing.T) {
+	rest, stop := newRecordedREST(t, map[string]string{"/v1/volumes": "gd2_volumes.json"})
+	defer stop()
+
+	volumeInfo, err := rest.VolumeInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if volumeInfo.CliOutput.OpErrno != "0" || volumeInfo.CliOutput.VolInfo.Volumes.Count != "2" {
+		t.Errorf("cli output %+v", volumeInfo.CliOutput)
+	}
+	volumes := volumeInfo.CliOutput.VolInfo.Volumes.Volume
+	if len(volumes) != 2 {
+		t.Fatalf("%d volumes, expected 2", len(volumes))
+	}
+
+	gfs := volumes[0]
+	for field, values := range map[string][2]string{
+		"name":         {gfs.Name, "gfs"},
+		"id":           {gfs.ID, "1c5c9c2d-6b1e-4c0e-9b38-0d6b0b1d9a01"},
+		"status":       {gfs.Status, "1"},
+		"statusStr":    {gfs.StatusStr, "Started"},
+		"typeStr":      {gfs.TypeStr, "Replicate"},
+		"transport":    {gfs.Transport, "tcp"},
+		"brickCount":   {gfs.BrickCount, "3"},
+		"distCount":    {gfs.DistCount, "1"},
+		"replicaCount": {gfs.ReplicaCount, "3"},
+		"arbiterCount": {gfs.ArbiterCount, "1"},
+		"optCount":     {gfs.OptCount, "1"},
+	} {
+		if values[0] != values[1] {
+			t.Errorf("gfs %v is %q, expected %q", field, values[0], values[1])
+		}
+	}
+	if options := gfs.Options.Option; len(options) != 1 || options[0].Name != "cluster/replicate.self-heal-daemon" || options[0].Value != "on" {
+		t.Errorf("gfs options %+v", options)
+	}
+	bricks := gfs.Bricks.Brick
+	if len(bricks) != 3 {
+		t.Fatalf("gfs bricks %+v", bricks)
+	}
+	if bricks[0].Name != "server1:/data/brick" || bricks[0].UUID != "a1b2c3d4-0000-4000-8000-000000000011" ||
+		bricks[0].HostUUID != "0b1c2d3e-0000-4000-8000-000000000001" || bricks[0].IsArbiter != "0" {
+		t.Errorf("gfs brick %+v", bricks[0])
+	}
+	if bricks[2].Name != "server3:/data/arbiter" || bricks[2].IsArbiter != "1" {
+		t.Errorf("gfs arbiter brick %+v", bricks[2])
+	}
+
+	// bricks of all the subvolumes are listed in order
+	backup := volumes[1]
+	if backup.TypeStr != "Distributed-Replicate" || backup.Status != "2" || backup.DistCount != "2" || backup.OptCount != "0" {
+		t.Errorf("backup volume %+v", backup)
+	}
+	if bricks := backup.Bricks.Brick; len(bricks) != 4 || bricks[2].Name != "server1:/data/backup2" {
+		t.Errorf("backup bricks %+v", bricks)
+	}
+
+	list, err := rest.VolumeList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := list.CliOutput.VolList.Volume; list.CliOutput.VolList.Count != "2" || len(names) != 2 || names[0] != "gfs" || names[1] != "backup" {
+		t.Errorf("volume list %+v", list.CliOutput.VolList)
+	}
+}
+
+func TestRESTPeerStatus(t *testing.T) {
+	rest, stop := newRecordedREST(t, map[string]string{"/v1/peers": "gd2_peers.json"})
+	defer stop()
+
+	peerStatus, err := rest.PeerStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := peerStatus.CliOutput.PeerStatus.Peer
+	if len(peers) != 2 {
+		t.Fatalf("%d peers, expected 2", len(peers))
+	}
+	if peers[0].UUID != "0b1c2d3e-0000-4000-8000-000000000001" || peers[0].Hostname != "server1" ||
+		peers[0].Hostnames.Hostname != "server1:24008" || peers[0].Connected != "1" || peers[0].State != "3" {
+		t.Errorf("online peer %+v", peers[0])
+	}
+	if peers[1].Connected != "0" || peers[1].StateStr != "Peer in Cluster" {
+		t.Errorf("offline peer %+v", peers[1])
+	}
+}
+
+func TestRESTVolumeStatus(t *testing.T) {
+	rest, stop := newRecordedREST(t, map[string]string{
+		"/v1/volumes":               "gd2_volumes.json",
+		"/v1/volumes/gfs/bricks":    "gd2_bricks_gfs.json",
+		"/v1/volumes/backup/bricks": "gd2_bricks_gfs.json",
+	})
+	defer stop()
+
+	volumeStatus, err := rest.VolumeStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	volumes := volumeStatus.CliOutput.VolStatus.Volumes.Volume
+	if len(volumes) != 2 || volumes[0].VolName != "gfs" || volumes[0].NodeCount != "2" {
+		t.Fatalf("volumes %+v", volumes)
+	}
+	online := volumes[0].Node[0]
+	for field, values := range map[string][2]string{
+		"hostname":    {online.Hostname, "server1"},
+		"peerid":      {online.Peerid, "0b1c2d3e-0000-4000-8000-000000000001"},
+		"path":        {online.Path, "/data/brick"},
+		"status":      {online.Status, "1"},
+		"pid":         {online.Pid, "2301"},
+		"port":        {online.Port, "49152"},
+		"ports.tcp":   {online.Ports.TCP, "49152"},
+		"fsName":      {online.FsName, "xfs"},
+		"mntOptions":  {online.MntOptions, "rw,noatime,inode64"},
+		"device":      {online.Device, "/dev/mapper/gluster-brick"},
+		"blockSize":   {online.BlockSize, "4096"},
+		"sizeTotal":   {online.SizeTotal, "107374182400"},
+		"sizeFree":    {online.SizeFree, "64424509440"},
+		"inodesTotal": {online.InodesTotal, "52428800"},
+		"inodesFree":  {online.InodesFree, "52000000"},
+	} {
+		if values[0] != values[1] {
+			t.Errorf("online brick %v is %q, expected %q", field, values[0], values[1])
+		}
+	}
+	if offline := volumes[0].Node[1]; offline.Status != "0" || offline.Pid != "0" {
+		t.Errorf("offline brick %+v", offline)
+	}
+
+	// the status fails when the bricks of a volume can't be read
+	rest, stop = newRecordedREST(t, map[string]string{"/v1/volumes": "gd2_volumes.json"})
+	defer stop()
+	if _, err := rest.VolumeStatus(); err == nil || err.Error() != "GET /v1/volumes/gfs/bricks: not found" {
+		t.Errorf("error %v, expected the message of GlusterD2", err)
+	}
+}
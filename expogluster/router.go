@@ -4,24 +4,70 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strings"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 //API routes to commands
 func API(server *Exporter) {
 
+	// health endpoints for load balancers and orchestrators
+	server.Router.HandleFunc("/-/healthy", healthyHandler).Methods("GET", "HEAD")
+	server.Router.HandleFunc("/-/ready", server.readyHandler).Methods("GET", "HEAD")
+
+	// multi-target probe, executes gluster on the target through ssh
+	if server.Probe != nil {
+		server.Router.HandleFunc("/probe", server.probeHandler).Methods("GET")
+	}
+
+	server.noAuthRoutes = map[string][]string{
+		"/-/healthy": {"GET", "HEAD"},
+		"/-/ready":   {"GET", "HEAD"},
+	}
+
 	apiRouter := server.Router.PathPrefix("/api/v1").Subrouter()
-	apiRouter.Use(corsMiddleware)
+	apiRouter.Use(corsMiddleware(server.CORS))
 
-	// routes with no auth (need to be listed in checkIfPathHasNoAuth method)
-	apiRouter.Handle("/metrics", promhttp.Handler())
+	// routes protected by basic auth when users are set in the web configuration file
+	apiRouter.Handle("/metrics", promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer, server.metricsHandler(prometheus.DefaultGatherer),
+	))
+
+	// read-only state of gluster, served from the last snapshot of the exporter
+	apiRouter.HandleFunc("/volumes", server.volumesHandler).Methods("GET", "HEAD")
+	apiRouter.HandleFunc("/volumes/{name}", server.volumeHandler).Methods("GET", "HEAD")
+	apiRouter.HandleFunc("/volumes/{name}/bricks", server.volumeBricksHandler).Methods("GET", "HEAD")
+	apiRouter.HandleFunc("/volumes/{name}/heal", server.volumeHealHandler).Methods("GET", "HEAD")
+	apiRouter.HandleFunc("/peers", server.peersHandler).Methods("GET", "HEAD")
+
+	// webhook of glustereventsd, requests are authenticated by their JWT token
+	if server.Events != nil {
+		apiRouter.HandleFunc("/events", server.receiveEventHandler).Methods("POST")
+		apiRouter.HandleFunc("/events", server.eventsHandler).Methods("GET", "HEAD")
+		server.noAuthRoutes["/api/v1/events"] = []string{"POST"}
+	}
 
 	// catch all - not found
 	apiRouter.PathPrefix("/").HandlerFunc(routeNotFound)
 
 }
 
+// checkIfPathHasNoAuth checks if the route is served without basic auth, the preflight
+// requests of the cross-origin policy of the API are served without basic auth too
+func (e *Exporter) checkIfPathHasNoAuth(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/api/v1/") && e.CORS.allowPreflight(r) {
+		return true
+	}
+	for _, method := range e.noAuthRoutes[r.URL.Path] {
+		if method == r.Method {
+			return true
+		}
+	}
+	return false
+}
+
 func routeNotFound(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	httpError(errors.New("Route not found"), http.StatusNotFound, w)
@@ -37,20 +83,3 @@ func httpError(err error, status int, w http.ResponseWriter) {
 	js, _ := json.MarshalIndent(payload, "", " ")
 	w.Write(js)
 }
-
-func setupCorsResponse(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE, CONNECT, HEAD, PATCH, TRACE")
-}
-
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		setupCorsResponse(w, r)
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(204)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
-}
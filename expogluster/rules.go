@@ -0,0 +1,155 @@
+package expogluster
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// RuleGroups is a Prometheus rules file
+type RuleGroups struct {
+	Groups []RuleGroup `yaml:"groups"`
+}
+
+// RuleGroup is a group of rules evaluated together
+type RuleGroup struct {
+	Name  string `yaml:"name"`
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule is a recording rule when Record is set, an alert rule otherwise
+type Rule struct {
+	Record      string            `yaml:"record,omitempty"`
+	Alert       string            `yaml:"alert,omitempty"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// RuleThresholds configure the generated rules
+type RuleThresholds struct {
+	// Job is the job scraping the exporter, checked by the exporter down alert
+	Job string
+	// For is how long a condition lasts before its alert fires
+	For time.Duration
+	// HealBacklog is the number of entries pending heal above which a growing backlog fires
+	HealBacklog float64
+	// HealWindow is the range over which the growth of the heal backlog is measured
+	HealWindow time.Duration
+	// QuotaUsage is the ratio of a quota hard limit above which its usage fires
+	QuotaUsage float64
+	// DaysUntilFull is the forecast under which a volume or a brick getting full fires
+	DaysUntilFull float64
+}
+
+// Rules generates the recording and alert rules of the metrics of the exporter,
+// the split-brain alert needs the split-brain counts enabled with PROM_SPLIT_BRAIN
+func Rules(thresholds RuleThresholds) RuleGroups {
+	name := metricName
+	forDuration := promDuration(thresholds.For)
+	healDeriv := fmt.Sprintf("volume:%v:deriv%v", name(healInfoFilesCount), promDuration(thresholds.HealWindow))
+	quotaUsage := "path:" + name(quotaUsed) + ":ratio"
+	untilFull := formatFloat(thresholds.DaysUntilFull * 24 * 3600)
+	days := formatFloat(thresholds.DaysUntilFull)
+
+	alert := func(alert, expr, duration, severity, summary, description string) Rule {
+		return Rule{
+			Alert:       alert,
+			Expr:        expr,
+			For:         duration,
+			Labels:      map[string]string{"severity": severity},
+			Annotations: map[string]string{"summary": summary, "description": description},
+		}
+	}
+
+	return RuleGroups{Groups: []RuleGroup{
+		{
+			Name: "gluster.rules",
+			Rules: []Rule{
+				{
+					Record: healDeriv,
+					Expr:   fmt.Sprintf("deriv(%v[%v])", name(healInfoFilesCount), promDuration(thresholds.HealWindow)),
+				},
+				{
+					Record: quotaUsage,
+					// limits without a hard limit are dropped instead of dividing by zero
+					Expr: fmt.Sprintf("%v / (%v > 0)", name(quotaUsed), name(quotaHardLimit)),
+				},
+			},
+		},
+		{
+			Name: "gluster.alerts",
+			Rules: []Rule{
+				alert("GlusterExporterDown",
+					fmt.Sprintf("up{job=%v} == 0", strconv.Quote(thresholds.Job)), forDuration, "critical",
+					"Gluster exporter {{ $labels.instance }} is down",
+					"Prometheus cannot scrape the gluster exporter {{ $labels.instance }}."),
+				alert("GlusterQueryFailed",
+					name(up)+" == 0", forDuration, "critical",
+					"Gluster exporter {{ $labels.instance }} cannot query gluster",
+					"The last query of gluster by the exporter {{ $labels.instance }} failed."),
+				alert("GlusterBrickDown",
+					name(brickUp)+" == 0", forDuration, "critical",
+					"Brick {{ $labels.hostname }}:{{ $labels.path }} of volume {{ $labels.volume }} is down",
+					"The brick {{ $labels.hostname }}:{{ $labels.path }} of volume {{ $labels.volume }} is not online."),
+				alert("GlusterPeerDisconnected",
+					name(peerConnected)+" == 0", forDuration, "critical",
+					"Peer {{ $labels.hostname }} is disconnected",
+					"The peer {{ $labels.hostname }} ({{ $labels.peer }}) is disconnected from {{ $labels.instance }}."),
+				alert("GlusterSplitBrain",
+					name(healInfoSplitBrainCount)+" > 0", "", "critical",
+					"Volume {{ $labels.volume }} has entries in split-brain",
+					"The volume {{ $labels.volume }} has {{ $value }} entries in split-brain, they must be resolved manually."),
+				alert("GlusterHealBacklogGrowing",
+					// the backlog is the value of the alert, "and" keeps the values of its left side
+					fmt.Sprintf("%v > %v and %v > 0", name(healInfoFilesCount), formatFloat(thresholds.HealBacklog), healDeriv),
+					promDuration(thresholds.HealWindow), "warning",
+					"Heal backlog of volume {{ $labels.volume }} is growing",
+					"The volume {{ $labels.volume }} has {{ $value }} entries pending heal and the backlog keeps growing."),
+				alert("GlusterQuotaHardLimitExceeded",
+					name(quotaHardLimitExceeded)+" > 0", "", "critical",
+					"Quota of {{ $labels.path }} in volume {{ $labels.volume }} is exceeded",
+					"The usage of {{ $labels.path }} in volume {{ $labels.volume }} reached its hard limit, writes are refused."),
+				alert("GlusterQuotaHardLimitNear",
+					fmt.Sprintf("%v > %v", quotaUsage, formatFloat(thresholds.QuotaUsage)), forDuration, "warning",
+					"Quota of {{ $labels.path }} in volume {{ $labels.volume }} is nearly exhausted",
+					"The usage of {{ $labels.path }} in volume {{ $labels.volume }} is {{ $value | humanizePercentage }} of its hard limit."),
+				alert("GlusterVolumeFullSoon",
+					fmt.Sprintf("%v < %v", name(volumeSecondsUntilFull), untilFull), forDuration, "warning",
+					"Volume {{ $labels.volume }} is full in less than "+days+" days",
+					"At its current growth, the volume {{ $labels.volume }} is full in {{ $value | humanizeDuration }}."),
+				alert("GlusterBrickFullSoon",
+					fmt.Sprintf("%v < %v", name(brickSecondsUntilFull), untilFull), forDuration, "warning",
+					"Brick {{ $labels.brick }} of volume {{ $labels.volume }} is full in less than "+days+" days",
+					"At its current growth, the brick {{ $labels.brick }} of volume {{ $labels.volume }} is full in {{ $value | humanizeDuration }}."),
+			},
+		},
+	}}
+}
+
+// WriteRules writes the rules as a Prometheus rules file
+func WriteRules(w io.Writer, groups RuleGroups) error {
+	b, err := yaml.Marshal(groups)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// promDuration formats a duration in the largest Prometheus unit dividing it
+func promDuration(d time.Duration) string {
+	for _, unit := range []struct {
+		suffix   string
+		duration time.Duration
+	}{{"d", 24 * time.Hour}, {"h", time.Hour}, {"m", time.Minute}, {"s", time.Second}} {
+		if d >= unit.duration && d%unit.duration == 0 {
+			return strconv.FormatInt(int64(d/unit.duration), 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(d.Milliseconds(), 10) + "ms"
+}
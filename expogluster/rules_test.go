@@ -0,0 +1,53 @@
+package expogluster
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+var testThresholds = RuleThresholds{
+	Job:           "gluster",
+	For:           5 * time.Minute,
+	HealBacklog:   100,
+	HealWindow:    time.Hour,
+	QuotaUsage:    0.9,
+	DaysUntilFull: 7,
+}
+
+func TestRulesExprParse(t *testing.T) {
+	for _, group := range Rules(testThresholds).Groups {
+		for _, rule := range group.Rules {
+			if _, err := parser.ParseExpr(rule.Expr); err != nil {
+				t.Errorf("%v: rule %v%v: %v: %v", group.Name, rule.Record, rule.Alert, rule.Expr, err)
+			}
+		}
+	}
+}
+
+func TestWriteRulesParse(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	if err := WriteRules(buffer, Rules(testThresholds)); err != nil {
+		t.Fatal(err)
+	}
+	if _, errs := rulefmt.Parse(buffer.Bytes()); len(errs) > 0 {
+		t.Fatalf("invalid rules file: %v\n%s", errs, buffer)
+	}
+}
+
+func TestPromDuration(t *testing.T) {
+	for duration, expected := range map[time.Duration]string{
+		48 * time.Hour:          "2d",
+		90 * time.Minute:        "90m",
+		time.Hour:               "1h",
+		30 * time.Second:        "30s",
+		1500 * time.Millisecond: "1500ms",
+	} {
+		if got := promDuration(duration); got != expected {
+			t.Errorf("promDuration(%v) = %v, expected %v", duration, got, expected)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package expogluster
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// Sink writes the metrics to a monitoring system other than Prometheus
+type Sink interface {
+	// Name identifies the sink in the logs
+	Name() string
+	// Write sends the samples collected at the given time
+	Write(samples []sample, now time.Time) error
+}
+
+// Sinks writes the metrics of the last snapshot to the sinks on an interval,
+// the metrics are collected once for all the sinks
+type Sinks struct {
+	Sinks []Sink
+	// Interval is the time between two writes
+	Interval time.Duration
+	// Cluster is the cluster tag of the written metrics, omitted when empty
+	Cluster string
+}
+
+// NewSinks creates the sinks from environment variables, it returns nil when no sink is configured
+func NewSinks() *Sinks {
+	sinks := []Sink{}
+	if influx := NewInfluxSink(); influx != nil {
+		sinks = append(sinks, influx)
+	}
+	if statsd := NewStatsDSink(); statsd != nil {
+		sinks = append(sinks, statsd)
+	}
+	if len(sinks) == 0 {
+		return nil
+	}
+	s := &Sinks{
+		Sinks:    sinks,
+		Interval: time.Duration(parseInt(getEnv("PROM_SINKS_INTERVAL", "60"))) * time.Second,
+		Cluster:  getEnv("PROM_SINKS_CLUSTER", ""),
+	}
+	// invalid numbers are parsed as 0, time.Tick returns nil for 0 and the writes would never run
+	if s.Interval <= 0 {
+		log.Fatalf("PROM_SINKS_INTERVAL must be a positive number of seconds: %v", getEnv("PROM_SINKS_INTERVAL", ""))
+	}
+	return s
+}
+
+// Start writes the metrics of the exporter in background
+func (s *Sinks) Start(e *Exporter) {
+	go func() {
+		for range time.Tick(s.Interval) {
+			s.Write(e)
+		}
+	}()
+}
+
+// Write collects the metrics of the last snapshot and writes them to every sink
+func (s *Sinks) Write(e *Exporter) {
+	families, err := e.gatherSnapshot(s.Interval)
+	if err != nil {
+		log.Errorf("Cannot gather metrics for the sinks: %v", err)
+		return
+	}
+	tags := map[string]string{"instance": e.instance()}
+	if s.Cluster != "" {
+		tags["cluster"] = s.Cluster
+	}
+	samples := flatten(families, tags)
+	now := time.Now()
+	for _, sink := range s.Sinks {
+		if err := sink.Write(samples, now); err != nil {
+			log.Errorf("Cannot write metrics to %v: %v", sink.Name(), err)
+		}
+	}
+}
+
+// sample is a single value of a metric, as exposed by Prometheus: histograms and summaries
+// are split into their _bucket, _sum and _count samples
+type sample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// flatten splits the metric families into samples, the external labels are added to each sample
+func flatten(families []*dto.MetricFamily, externalLabels map[string]string) []sample {
+	samples := []sample{}
+	add := func(name string, labels []*dto.LabelPair, value float64, extra ...string) {
+		s := sample{name: name, labels: make(map[string]string), value: value}
+		for key, value := range externalLabels {
+			s.labels[key] = value
+		}
+		for _, label := range labels {
+			s.labels[label.GetName()] = label.GetValue()
+		}
+		for i := 0; i+1 < len(extra); i += 2 {
+			s.labels[extra[i]] = extra[i+1]
+		}
+		samples = append(samples, s)
+	}
+
+	for _, family := range families {
+		name := family.GetName()
+		for _, m := range family.Metric {
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m.Label, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, m.Label, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, m.Label, m.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				histogram := m.GetHistogram()
+				infinite := false
+				for _, bucket := range histogram.GetBucket() {
+					infinite = infinite || math.IsInf(bucket.GetUpperBound(), 1)
+					add(name+"_bucket", m.Label, float64(bucket.GetCumulativeCount()), "le", formatFloat(bucket.GetUpperBound()))
+				}
+				if !infinite {
+					add(name+"_bucket", m.Label, float64(histogram.GetSampleCount()), "le", "+Inf")
+				}
+				add(name+"_sum", m.Label, histogram.GetSampleSum())
+				add(name+"_count", m.Label, float64(histogram.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				summary := m.GetSummary()
+				for _, quantile := range summary.GetQuantile() {
+					add(name, m.Label, quantile.GetValue(), "quantile", formatFloat(quantile.GetQuantile()))
+				}
+				add(name+"_sum", m.Label, summary.GetSampleSum())
+				add(name+"_count", m.Label, float64(summary.GetSampleCount()))
+			}
+		}
+	}
+	return samples
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
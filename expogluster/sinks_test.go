@@ -0,0 +1,98 @@
+package expogluster
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestFlatten(t *testing.T) {
+	families := []*dto.MetricFamily{
+		{
+			Name: proto.String("gluster_brick_data_read_bytes_total"),
+			Type: dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{
+				{Label: labelPairs("volume", "gfs"), Counter: &dto.Counter{Value: proto.Float64(2048)}},
+			},
+		},
+		{
+			Name:   proto.String("gluster_up"),
+			Type:   dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(1)}}},
+		},
+		{
+			Name:   proto.String("gluster_untyped"),
+			Type:   dto.MetricType_UNTYPED.Enum(),
+			Metric: []*dto.Metric{{Label: labelPairs("instance", "own"), Untyped: &dto.Untyped{Value: proto.Float64(3)}}},
+		},
+		{
+			Name: proto.String("gluster_mount_benchmark_seconds"),
+			Type: dto.MetricType_HISTOGRAM.Enum(),
+			Metric: []*dto.Metric{{
+				Label: labelPairs("op", "write"),
+				Histogram: &dto.Histogram{
+					SampleCount: proto.Uint64(10),
+					SampleSum:   proto.Float64(12.5),
+					Bucket: []*dto.Bucket{
+						{UpperBound: proto.Float64(0.5), CumulativeCount: proto.Uint64(4)},
+						{UpperBound: proto.Float64(5), CumulativeCount: proto.Uint64(9)},
+					},
+				},
+			}},
+		},
+		{
+			Name: proto.String("gluster_latency_seconds"),
+			Type: dto.MetricType_SUMMARY.Enum(),
+			Metric: []*dto.Metric{{
+				Summary: &dto.Summary{
+					SampleCount: proto.Uint64(5),
+					SampleSum:   proto.Float64(1.5),
+					Quantile:    []*dto.Quantile{{Quantile: proto.Float64(0.99), Value: proto.Float64(0.3)}},
+				},
+			}},
+		},
+	}
+
+	labels := func(pairs ...string) map[string]string {
+		labels := map[string]string{"instance": "node1"}
+		for i := 0; i < len(pairs); i += 2 {
+			labels[pairs[i]] = pairs[i+1]
+		}
+		return labels
+	}
+	expected := []sample{
+		{"gluster_brick_data_read_bytes_total", labels("volume", "gfs"), 2048},
+		{"gluster_up", labels(), 1},
+		// the labels of the metric override the external labels
+		{"gluster_untyped", labels("instance", "own"), 3},
+		{"gluster_mount_benchmark_seconds_bucket", labels("op", "write", "le", "0.5"), 4},
+		{"gluster_mount_benchmark_seconds_bucket", labels("op", "write", "le", "5"), 9},
+		// the +Inf bucket is added when missing
+		{"gluster_mount_benchmark_seconds_bucket", labels("op", "write", "le", "+Inf"), 10},
+		{"gluster_mount_benchmark_seconds_sum", labels("op", "write"), 12.5},
+		{"gluster_mount_benchmark_seconds_count", labels("op", "write"), 10},
+		{"gluster_latency_seconds", labels("quantile", "0.99"), 0.3},
+		{"gluster_latency_seconds_sum", labels(), 1.5},
+		{"gluster_latency_seconds_count", labels(), 5},
+	}
+	samples := flatten(families, map[string]string{"instance": "node1"})
+	if !reflect.DeepEqual(samples, expected) {
+		t.Errorf("samples\n%+v\nexpected\n%+v", samples, expected)
+	}
+
+	// the +Inf bucket isn't repeated
+	families[3].Metric[0].Histogram.Bucket = append(families[3].Metric[0].Histogram.Bucket,
+		&dto.Bucket{UpperBound: proto.Float64(math.Inf(1)), CumulativeCount: proto.Uint64(10)})
+	infinite := 0
+	for _, sample := range flatten(families, nil) {
+		if sample.labels["le"] == "+Inf" {
+			infinite++
+		}
+	}
+	if infinite != 1 {
+		t.Errorf("%d +Inf buckets, expected 1", infinite)
+	}
+}
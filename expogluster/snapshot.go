@@ -0,0 +1,459 @@
+package expogluster
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// Snapshot holds the state of gluster read at the last refresh of the exporter
+type Snapshot struct {
+	Time          time.Time
+	VolumeInfo    VolumeInfoJSON
+	VolumeInfoErr error
+	PeerStatus    PeerStatusJSON
+	PeerStatusErr error
+	VolumeStatus  VolumeStatusJSON
+	HealInfo      map[string]VolumeHealInfoJSON
+	SplitBrain    map[string]VolumeHealInfoJSON
+	Profile       map[string]VolumeProfileJSON
+	Quota         map[string]VolumeQuotaJSON
+	// Leader is true when the node runs the cluster scoped collectors
+	Leader bool
+	// Errors are the errors of the failed collectors, by collector name
+	Errors map[string]error
+
+	// mounts are the glusterfs mounts and the results of their probes, by mount point
+	mounts      []Mount
+	mountProbes map[string]mountProbe
+
+	// metrics are collected once, and shared by the scrapes and the outputs pushing the metrics
+	metrics *snapshotMetrics
+}
+
+type snapshotMetrics struct {
+	once    sync.Once
+	metrics []prometheus.Metric
+}
+
+// Up uses OpErrno of "gluster volume info" as indicator of gluster being up
+func (s *Snapshot) Up() bool {
+	if s.VolumeInfoErr != nil {
+		return false
+	}
+	i, _ := strconv.Atoi(s.VolumeInfo.CliOutput.OpErrno)
+	return i == 0
+}
+
+// Refresh executes gluster commands and caches the result as the last snapshot
+func (e *Exporter) Refresh() *Snapshot {
+	e.refreshMu.Lock()
+	defer e.refreshMu.Unlock()
+	return e.refresh()
+}
+
+func (e *Exporter) refresh() *Snapshot {
+	snapshot := &Snapshot{
+		Time:       time.Now(),
+		HealInfo:   make(map[string]VolumeHealInfoJSON),
+		SplitBrain: make(map[string]VolumeHealInfoJSON),
+		Profile:    make(map[string]VolumeProfileJSON),
+		Quota:      make(map[string]VolumeQuotaJSON),
+		Errors:     make(map[string]error),
+		metrics:    &snapshotMetrics{},
+	}
+	e.refreshVolumeInfo(snapshot)
+	// the peers are needed to elect the leader
+	if e.enabled("peer") || e.ClusterMode == clusterModePeer {
+		e.refreshPeerStatus(snapshot)
+	}
+	e.elect(snapshot)
+	if e.enabled("status") {
+		e.refreshVolumeStatus(snapshot)
+	}
+	if e.enabled("heal") && snapshot.Leader {
+		e.refreshHealInfo(snapshot)
+	}
+	if e.Profile {
+		e.refreshProfile(snapshot)
+	}
+	if e.Quota && snapshot.Leader {
+		e.refreshQuota(snapshot)
+	}
+	if e.enabled("mount") {
+		e.refreshMounts(snapshot)
+	}
+	// the forecast is sampled once per refresh, the metrics of a snapshot may be collected several times
+	if e.Forecast != nil && e.enabled("status") {
+		e.refreshForecast(snapshot)
+	}
+
+	e.store(snapshot)
+	return snapshot
+}
+
+// RefreshCollector executes the gluster commands of a single collector and
+// updates the last snapshot, other collectors keep their cached result. All
+// collectors are refreshed when there is no snapshot yet
+func (e *Exporter) RefreshCollector(collector string) *Snapshot {
+	e.refreshMu.Lock()
+	defer e.refreshMu.Unlock()
+
+	e.mu.Lock()
+	delete(e.pending, collector)
+	last := e.snapshot
+	var errors map[string]error
+	if last != nil {
+		errors = make(map[string]error, len(last.Errors))
+		for name, err := range last.Errors {
+			errors[name] = err
+		}
+	}
+	e.mu.Unlock()
+	if last == nil {
+		return e.refresh()
+	}
+	if !e.refreshed(collector) {
+		return last
+	}
+
+	snapshot := *last
+	snapshot.Errors = errors
+	snapshot.metrics = &snapshotMetrics{}
+	delete(snapshot.Errors, collector)
+	switch collector {
+	case "volume":
+		snapshot.Time = time.Now()
+		e.refreshVolumeInfo(&snapshot)
+	case "peer":
+		e.refreshPeerStatus(&snapshot)
+		e.elect(&snapshot)
+	case "status":
+		e.refreshVolumeStatus(&snapshot)
+	case "heal":
+		snapshot.HealInfo = make(map[string]VolumeHealInfoJSON)
+		snapshot.SplitBrain = make(map[string]VolumeHealInfoJSON)
+		if snapshot.Leader {
+			e.refreshHealInfo(&snapshot)
+		}
+	case "quota":
+		snapshot.Quota = make(map[string]VolumeQuotaJSON)
+		if snapshot.Leader {
+			e.refreshQuota(&snapshot)
+		}
+	default:
+		return last
+	}
+
+	e.store(&snapshot)
+	return &snapshot
+}
+
+// triggerRefresh refreshes the collector in background, refreshes already waiting are not queued twice
+func (e *Exporter) triggerRefresh(collector string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.pending == nil {
+		e.pending = make(map[string]bool)
+	}
+	if e.pending[collector] {
+		return
+	}
+	e.pending[collector] = true
+	go e.RefreshCollector(collector)
+}
+
+func (e *Exporter) store(snapshot *Snapshot) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.snapshot = snapshot
+	if snapshot.Up() {
+		e.lastUp = snapshot.Time
+	}
+}
+
+func (e *Exporter) refreshVolumeInfo(snapshot *Snapshot) {
+	snapshot.VolumeInfo, snapshot.VolumeInfoErr = e.backend().VolumeInfo()
+	if snapshot.VolumeInfoErr != nil {
+		log.Errorf("couldn't parse json volume info: %v", snapshot.VolumeInfoErr)
+		snapshot.Errors["volume"] = snapshot.VolumeInfoErr
+	}
+}
+
+func (e *Exporter) refreshPeerStatus(snapshot *Snapshot) {
+	peerStatus, err := e.backend().PeerStatus()
+	if err != nil {
+		log.Errorf("couldn't parse json of peer status: %v", err)
+		snapshot.Errors["peer"] = err
+	}
+	snapshot.PeerStatus, snapshot.PeerStatusErr = *peerStatus, err
+}
+
+func (e *Exporter) refreshVolumeStatus(snapshot *Snapshot) {
+	volumeStatus, err := e.backend().VolumeStatus()
+	if err != nil {
+		log.Errorf("couldn't parse json of volume status: %v", err)
+		snapshot.Errors["status"] = err
+	}
+	snapshot.VolumeStatus = *volumeStatus
+}
+
+func (e *Exporter) refreshHealInfo(snapshot *Snapshot) {
+	for _, vol := range e.volumeNames() {
+		healInfo, err := e.backend().VolumeHealInfo(vol)
+		if err != nil {
+			log.Errorf("couldn't parse json of heal info: %v", err)
+			snapshot.Errors["heal"] = err
+			continue
+		}
+		snapshot.HealInfo[vol] = *healInfo
+
+		if !e.SplitBrain {
+			continue
+		}
+		splitBrain, err := e.backend().VolumeHealSplitBrain(vol)
+		if errors.Is(err, ErrUnsupported) {
+			log.Debugf("Split-brain entries aren't collected: %v", err)
+			continue
+		}
+		if err == nil && splitBrain.OpRet != 0 {
+			err = fmt.Errorf("gluster volume heal %v info split-brain failed: %v", vol, splitBrain.OpErrstr)
+		}
+		if err != nil {
+			log.Errorf("couldn't read split-brain info: %v", err)
+			snapshot.Errors["heal"] = err
+			continue
+		}
+		snapshot.SplitBrain[vol] = *splitBrain
+	}
+}
+
+func (e *Exporter) refreshProfile(snapshot *Snapshot) {
+	for _, volume := range snapshot.VolumeInfo.Volumes() {
+		if !e.monitored(volume.Name) {
+			continue
+		}
+		profile, err := e.backend().VolumeProfile(volume.Name)
+		if errors.Is(err, ErrUnsupported) {
+			log.Debugf("Profile isn't collected: %v", err)
+			return
+		}
+		if err != nil {
+			log.Errorf("Error while executing or marshalling gluster profile output: %v", err)
+			snapshot.Errors["profile"] = err
+			continue
+		}
+		snapshot.Profile[volume.Name] = *profile
+	}
+}
+
+func (e *Exporter) refreshQuota(snapshot *Snapshot) {
+	for _, volume := range snapshot.VolumeInfo.Volumes() {
+		if !e.monitored(volume.Name) {
+			continue
+		}
+		quota, err := e.backend().VolumeQuotaList(volume.Name)
+		if errors.Is(err, ErrUnsupported) {
+			log.Debugf("Quota isn't collected: %v", err)
+			return
+		}
+		if err != nil {
+			log.Errorf("Cannot read quotas of volume %v, are quotas enabled? %v", volume.Name, err)
+			snapshot.Errors["quota"] = err
+			continue
+		}
+		snapshot.Quota[volume.Name] = quota
+	}
+}
+
+// refreshMounts probes the glusterfs mounts and starts the benchmark of the writeable ones
+func (e *Exporter) refreshMounts(snapshot *Snapshot) {
+	mounts, err := ReadMountInfo(e.mountInfoPath())
+	if err != nil {
+		log.Error(err)
+	}
+	snapshot.mounts = mounts
+	snapshot.mountProbes = e.probeMounts(mounts)
+
+	if e.Benchmark != nil {
+		// only writeable mounts are benchmarked, the benchmark would hang on the others
+		writeable := make([]Mount, 0, len(mounts))
+		for _, mount := range mounts {
+			if snapshot.mountProbes[mount.MountPoint].reason == "" {
+				writeable = append(writeable, mount)
+			}
+		}
+		e.Benchmark.Start(writeable)
+	}
+}
+
+// refreshForecast samples the free size of the bricks and of the volumes
+func (e *Exporter) refreshForecast(snapshot *Snapshot) {
+	sampled := false
+	// the series of the volumes and bricks of the cluster, the others are dropped from the forecast
+	present := make(map[string]bool)
+	for _, volume := range snapshot.VolumeInfo.Volumes() {
+		if !e.monitored(volume.Name) {
+			continue
+		}
+		for _, brick := range volume.Bricks {
+			if hostname, _ := splitBrickName(brick.Name); e.reportBrick(hostname, brick.HostUUID) {
+				present[forecastKey(volume.Name, brick.Name)] = true
+			}
+		}
+		bricks := snapshot.VolumeStatus.Bricks(volume.Name)
+		for _, brick := range bricks {
+			if brick.SizeTotal > 0 && e.reportBrick(brick.Hostname, brick.PeerID) {
+				sampled = e.Forecast.Add(snapshot.Time, volume.Name, brick.Hostname+":"+brick.Path, brick.SizeFree) || sampled
+			}
+		}
+		// the capacity of the volumes is cluster scoped, only the leader forecasts it
+		if !snapshot.Leader {
+			continue
+		}
+		present[forecastKey(volume.Name, "")] = true
+		if capacity, ok := VolumeCapacity(volume, bricks); ok {
+			sampled = e.Forecast.Add(snapshot.Time, volume.Name, "", capacity.SizeFree) || sampled
+		}
+	}
+	// without volume info every series would look removed
+	if snapshot.Errors["volume"] == nil && e.Forecast.Retain(present) {
+		sampled = true
+	}
+	if sampled {
+		e.Forecast.Save(snapshot.Time)
+	}
+}
+
+// failed checks if a collector failed in the snapshot
+func (e *Exporter) failed(snapshot *Snapshot, collector string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return snapshot.Errors[collector] != nil
+}
+
+// Snapshot returns the last snapshot, gluster is queried if it was never refreshed
+func (e *Exporter) Snapshot() *Snapshot {
+	e.mu.RLock()
+	snapshot := e.snapshot
+	e.mu.RUnlock()
+
+	if snapshot == nil {
+		return e.Refresh()
+	}
+	return snapshot
+}
+
+// volumeNames returns the monitored volumes, listing all volumes when none were given
+func (e *Exporter) volumeNames() []string {
+	if e.Volumes[0] != allVolumes {
+		return e.Volumes
+	}
+
+	log.Warn("no Volumes were given.")
+	volumeList, volumeListErr := e.backend().VolumeList()
+	if volumeListErr != nil {
+		log.Error(volumeListErr)
+	}
+	return volumeList.CliOutput.VolList.Volume
+}
+
+// monitored checks if the volume was chosen to be monitored
+func (e *Exporter) monitored(volumeName string) bool {
+	return e.Volumes[0] == allVolumes || ContainsVolume(e.Volumes, volumeName)
+}
+
+// backend returns the backend of the exporter, gluster command line is executed locally by default
+func (e *Exporter) backend() Backend {
+	if e.Backend == nil {
+		return &CLI{Runner: LocalRunner{}}
+	}
+	return e.Backend
+}
+
+// runner returns the runner of the commands of the node, like lvs, the commands run where
+// the gluster command line runs, locally with other backends
+func (e *Exporter) runner() Runner {
+	if cli, ok := e.backend().(*CLI); ok && cli.Runner != nil {
+		return cli.Runner
+	}
+	return LocalRunner{}
+}
+
+// refreshed checks if the collector is read by the refreshes, the volume info is always read
+// and profile and quota have their own switches
+func (e *Exporter) refreshed(collector string) bool {
+	switch collector {
+	case "volume":
+		return true
+	case "profile":
+		return e.Profile
+	case "quota":
+		return e.Quota
+	}
+	return e.enabled(collector)
+}
+
+// enabled checks if the collector was chosen to run, all collectors run when none were chosen
+func (e *Exporter) enabled(collector string) bool {
+	return len(e.Collectors) == 0 || ContainsVolume(e.Collectors, collector)
+}
+
+// snapshotCollector collects the metrics of the last snapshot, without querying gluster again
+type snapshotCollector struct {
+	exporter *Exporter
+}
+
+func (c snapshotCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.exporter.Describe(ch)
+}
+
+func (c snapshotCollector) Collect(ch chan<- prometheus.Metric) {
+	c.exporter.collect(ch, c.exporter.Snapshot())
+}
+
+// snapshotMetrics returns the metrics of the snapshot, they are collected on the first call
+func (e *Exporter) snapshotMetrics(snapshot *Snapshot) []prometheus.Metric {
+	collect := func() []prometheus.Metric {
+		ch := make(chan prometheus.Metric)
+		done := make(chan []prometheus.Metric)
+		go func() {
+			metrics := []prometheus.Metric{}
+			for metric := range ch {
+				metrics = append(metrics, metric)
+			}
+			done <- metrics
+		}()
+		start := time.Now()
+		e.collectSnapshot(ch, snapshot)
+		close(ch)
+		e.createdTimes().expire(start)
+		return <-done
+	}
+	if snapshot.metrics == nil {
+		return collect()
+	}
+	snapshot.metrics.once.Do(func() {
+		snapshot.metrics.metrics = collect()
+	})
+	return snapshot.metrics.metrics
+}
+
+// gatherSnapshot gathers the metrics of the last snapshot for the outputs pushing the metrics,
+// gluster is queried when the snapshot is older than maxAge, the exporter not being scraped
+func (e *Exporter) gatherSnapshot(maxAge time.Duration) ([]*dto.MetricFamily, error) {
+	if time.Since(e.Snapshot().Time) >= maxAge {
+		e.Refresh()
+	}
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(snapshotCollector{e}); err != nil {
+		return nil, err
+	}
+	return registry.Gather()
+}
@@ -0,0 +1,134 @@
+package expogluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"gopkg.in/yaml.v2"
+)
+
+// output formats of the state
+const (
+	StateFormatJSON = "json"
+	StateFormatYAML = "yaml"
+	StateFormatProm = "prom"
+)
+
+// State is the state of gluster read by the enabled collectors, as parsed from the gluster commands
+type State struct {
+	Time         time.Time                     `json:"time"`
+	Leader       bool                          `json:"leader"`
+	VolumeInfo   *VolumeInfoJSON               `json:"volumeInfo,omitempty"`
+	PeerStatus   *PeerStatusJSON               `json:"peerStatus,omitempty"`
+	VolumeStatus *VolumeStatusJSON             `json:"volumeStatus,omitempty"`
+	HealInfo     map[string]VolumeHealInfoJSON `json:"healInfo,omitempty"`
+	SplitBrain   map[string]VolumeHealInfoJSON `json:"splitBrain,omitempty"`
+	Profile      map[string]VolumeProfileJSON  `json:"profile,omitempty"`
+	Quota        map[string]VolumeQuotaJSON    `json:"quota,omitempty"`
+	// Errors are the errors of the failed collectors, by collector name
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// State refreshes the snapshot and returns the state read by the enabled collectors
+func (e *Exporter) State() State {
+	snapshot := e.Refresh()
+	state := State{
+		Time:       snapshot.Time,
+		Leader:     snapshot.Leader,
+		HealInfo:   snapshot.HealInfo,
+		SplitBrain: snapshot.SplitBrain,
+		Errors:     make(map[string]string),
+	}
+	if e.enabled("volume") {
+		state.VolumeInfo = &snapshot.VolumeInfo
+	}
+	if e.enabled("peer") {
+		state.PeerStatus = &snapshot.PeerStatus
+	}
+	if e.enabled("status") {
+		state.VolumeStatus = &snapshot.VolumeStatus
+	}
+
+	if e.Profile {
+		state.Profile = snapshot.Profile
+	}
+	if e.Quota && snapshot.Leader {
+		state.Quota = snapshot.Quota
+	}
+
+	e.mu.RLock()
+	for collector, err := range snapshot.Errors {
+		state.Errors[collector] = err.Error()
+	}
+	e.mu.RUnlock()
+	return state
+}
+
+// WriteState writes the state in JSON or YAML
+func WriteState(w io.Writer, state State, format string) error {
+	switch format {
+	case StateFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(state)
+	case StateFormatYAML:
+		// the payloads only have json tags, they are converted to generic values to keep their names
+		b, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		var value interface{}
+		if err := json.Unmarshal(b, &value); err != nil {
+			return err
+		}
+		b, err = yaml.Marshal(value)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+	return fmt.Errorf("unknown format: %v", format)
+}
+
+// WriteMetrics collects the metrics of the exporter and writes them in the Prometheus text format,
+// it returns the errors of the failed collectors
+func (e *Exporter) WriteMetrics(w io.Writer) (map[string]string, error) {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(e); err != nil {
+		return nil, err
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(w, family); err != nil {
+			return nil, err
+		}
+	}
+
+	errors := make(map[string]string)
+	snapshot := e.Snapshot()
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for collector, err := range snapshot.Errors {
+		errors[collector] = err.Error()
+	}
+	return errors, nil
+}
+
+// FailedCollectors lists the names of the failed collectors, sorted
+func FailedCollectors(errors map[string]string) []string {
+	names := make([]string, 0, len(errors))
+	for name := range errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,93 @@
+package expogluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestWriteState(t *testing.T) {
+	runner := &fixtureRunner{fixtures: map[string]string{"volume info": "volume_info_multi.xml"}}
+	e := &Exporter{
+		Backend:    &CLI{Runner: runner},
+		Volumes:    []string{allVolumes},
+		Collectors: []string{"volume", "peer"},
+	}
+	state := e.State()
+	if state.VolumeInfo == nil || state.PeerStatus == nil || state.VolumeStatus != nil {
+		t.Fatalf("state of the enabled collectors: volume info %v, peer status %v, volume status %v",
+			state.VolumeInfo != nil, state.PeerStatus != nil, state.VolumeStatus != nil)
+	}
+	if failed := FailedCollectors(state.Errors); !reflect.DeepEqual(failed, []string{"peer"}) {
+		t.Errorf("failed collectors %v, expected the peer collector", failed)
+	}
+
+	var jsonOutput, yamlOutput bytes.Buffer
+	if err := WriteState(&jsonOutput, state, StateFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteState(&yamlOutput, state, StateFormatYAML); err != nil {
+		t.Fatal(err)
+	}
+
+	// the YAML output has the names of the JSON output
+	var fromJSON, fromYAML interface{}
+	if err := json.Unmarshal(jsonOutput.Bytes(), &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(yamlOutput.Bytes(), &fromYAML); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(normalizeYAML(fromYAML), fromJSON) {
+		t.Errorf("YAML output\n%s\ndiffers from JSON output\n%s", yamlOutput.String(), jsonOutput.String())
+	}
+	if !strings.Contains(yamlOutput.String(), "volumeInfo:") || !strings.Contains(yamlOutput.String(), "volInfo:") {
+		t.Errorf("YAML output without the json names\n%s", yamlOutput.String())
+	}
+
+	var decoded State
+	if err := json.Unmarshal(jsonOutput.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.VolumeInfo, state.VolumeInfo) || decoded.Errors["peer"] != state.Errors["peer"] {
+		t.Errorf("JSON output decoded as %+v", decoded)
+	}
+
+	if err := WriteState(&bytes.Buffer{}, state, "xml"); err == nil {
+		t.Error("state written in an unknown format")
+	}
+}
+
+// normalizeYAML converts the maps decoded from YAML to the types decoded from JSON
+func normalizeYAML(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			converted[key.(string)] = normalizeYAML(item)
+		}
+		return converted
+	case []interface{}:
+		for i, item := range value {
+			value[i] = normalizeYAML(item)
+		}
+		return value
+	case int:
+		return float64(value)
+	}
+	return value
+}
+
+func TestFailedCollectors(t *testing.T) {
+	if failed := FailedCollectors(nil); len(failed) != 0 {
+		t.Errorf("failed collectors %v without errors", failed)
+	}
+	errors := map[string]string{"status": "timeout", "heal": "failed", "peer": "failed"}
+	if failed := FailedCollectors(errors); !reflect.DeepEqual(failed, []string{"heal", "peer", "status"}) {
+		t.Errorf("failed collectors %v, expected them sorted", failed)
+	}
+}
@@ -0,0 +1,106 @@
+package expogluster
+
+import (
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// statsd tag formats
+const (
+	// statsdFormatDogStatsD appends the tags, "name:1|g|#volume:gfs"
+	statsdFormatDogStatsD = "dogstatsd"
+	// statsdFormatTelegraf adds the tags to the name, "name,volume=gfs:1|g", as parsed by the statsd input of Telegraf
+	statsdFormatTelegraf = "telegraf"
+)
+
+// statsdEscaper replaces the characters delimiting the fields of a statsd line
+var statsdEscaper = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", "=", "_", "\n", "_")
+
+// StatsDSink sends every sample as a statsd gauge with tags over UDP, counters are sent
+// as gauges too since their value is the total read from gluster
+type StatsDSink struct {
+	// Address is the host:port of the statsd server
+	Address string
+	// Prefix is added to the name of the metrics
+	Prefix string
+	// Format of the tags, "dogstatsd" or "telegraf"
+	Format string
+}
+
+// NewStatsDSink creates the statsd sink from environment variables, it returns nil when no address is configured
+func NewStatsDSink() *StatsDSink {
+	address := getEnv("PROM_STATSD_ADDRESS", "")
+	if address == "" {
+		return nil
+	}
+	format := getEnv("PROM_STATSD_FORMAT", statsdFormatDogStatsD)
+	if format != statsdFormatDogStatsD && format != statsdFormatTelegraf {
+		log.Fatalf("Unknown statsd format: %v", format)
+	}
+	return &StatsDSink{
+		Address: address,
+		Prefix:  getEnv("PROM_STATSD_PREFIX", ""),
+		Format:  format,
+	}
+}
+
+// Name identifies the sink in the logs
+func (s *StatsDSink) Name() string {
+	return "statsd " + s.Address
+}
+
+// Write sends the samples, batched in datagrams holding whole lines
+func (s *StatsDSink) Write(samples []sample, now time.Time) error {
+	lines := make([]string, 0, len(samples))
+	for _, sample := range samples {
+		if math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+			continue
+		}
+		lines = append(lines, s.lines(sample)...)
+	}
+	conn, err := net.Dial("udp", s.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return writeDatagrams(conn, lines)
+}
+
+// lines formats the sample as gauge lines, ending with a newline
+func (s *StatsDSink) lines(sample sample) []string {
+	keys := make([]string, 0, len(sample.labels))
+	for key := range sample.labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	tags := make([]string, 0, len(keys))
+	for _, key := range keys {
+		separator := ":"
+		if s.Format == statsdFormatTelegraf {
+			separator = "="
+		}
+		tags = append(tags, statsdEscaper.Replace(key)+separator+statsdEscaper.Replace(sample.labels[key]))
+	}
+
+	name := statsdEscaper.Replace(s.Prefix + sample.name)
+	suffix := "|g"
+	if len(tags) > 0 {
+		if s.Format == statsdFormatTelegraf {
+			name += "," + strings.Join(tags, ",")
+		} else {
+			suffix += "|#" + strings.Join(tags, ",")
+		}
+	}
+	value := strconv.FormatFloat(sample.value, 'f', -1, 64)
+	if sample.value < 0 {
+		// a signed value changes the gauge instead of setting it, the gauge is reset first
+		return []string{name + ":0" + suffix + "\n", name + ":" + value + suffix + "\n"}
+	}
+	return []string{name + ":" + value + suffix + "\n"}
+}
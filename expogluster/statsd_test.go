@@ -0,0 +1,57 @@
+package expogluster
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatsDLines(t *testing.T) {
+	labels := map[string]string{"volume": "gfs", "path": "/data/gfs:1|x"}
+	for _, test := range []struct {
+		format   string
+		sample   sample
+		expected []string
+	}{
+		{statsdFormatDogStatsD, sample{"gluster_up", nil, 1}, []string{"gluster.gluster_up:1|g\n"}},
+		{statsdFormatTelegraf, sample{"gluster_up", nil, 1}, []string{"gluster.gluster_up:1|g\n"}},
+		// the tags are sorted, and the separators of the statsd fields are replaced in their keys and values
+		{statsdFormatDogStatsD, sample{"gluster_brick_up", labels, 1}, []string{"gluster.gluster_brick_up:1|g|#path:/data/gfs_1_x,volume:gfs\n"}},
+		{statsdFormatTelegraf, sample{"gluster_brick_up", labels, 1}, []string{"gluster.gluster_brick_up,path=/data/gfs_1_x,volume=gfs:1|g\n"}},
+		{statsdFormatDogStatsD, sample{"gluster_size", nil, 1e21}, []string{"gluster.gluster_size:1000000000000000000000|g\n"}},
+		// a negative value would decrement the gauge, it is reset to 0 first
+		{statsdFormatDogStatsD, sample{"gluster_imbalance", map[string]string{"volume": "gfs"}, -2.5}, []string{
+			"gluster.gluster_imbalance:0|g|#volume:gfs\n",
+			"gluster.gluster_imbalance:-2.5|g|#volume:gfs\n",
+		}},
+		{statsdFormatTelegraf, sample{"gluster_imbalance", map[string]string{"volume": "gfs"}, -2.5}, []string{
+			"gluster.gluster_imbalance,volume=gfs:0|g\n",
+			"gluster.gluster_imbalance,volume=gfs:-2.5|g\n",
+		}},
+	} {
+		sink := &StatsDSink{Prefix: "gluster.", Format: test.format}
+		if lines := sink.lines(test.sample); !reflect.DeepEqual(lines, test.expected) {
+			t.Errorf("%v lines of %+v: %q, expected %q", test.format, test.sample, lines, test.expected)
+		}
+	}
+}
+
+func TestStatsDSinkWrite(t *testing.T) {
+	listener, receive := udpListener(t)
+	defer listener.Close()
+
+	sink := &StatsDSink{Address: listener.LocalAddr().String(), Format: statsdFormatTelegraf}
+	samples := []sample{
+		{"gluster_up", map[string]string{"instance": "node1"}, 1},
+		{"gluster_heal_info_files_count", map[string]string{"instance": "node1"}, math.NaN()},
+		{"gluster_volume_imbalance", map[string]string{"instance": "node1"}, -1},
+	}
+	if err := sink.Write(samples, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	expected := "gluster_up,instance=node1:1|g\ngluster_volume_imbalance,instance=node1:0|g\ngluster_volume_imbalance,instance=node1:-1|g\n"
+	if datagrams := receive(); len(datagrams) != 1 || datagrams[0] != expected {
+		t.Errorf("datagrams %q, expected %q", datagrams, expected)
+	}
+}
@@ -2,6 +2,10 @@ package expogluster
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"os/exec"
 	"strings"
@@ -10,24 +14,101 @@ import (
 )
 
 //Gluster executes oscommands
-func gluster(vars ...string) (*bytes.Buffer, error) {
+func gluster(runner Runner, vars ...string) (*bytes.Buffer, error) {
 	if len(vars) < 1 {
 		log.Println("incorrect url")
 		return nil, nil
 	}
 	args := append(vars, "--xml")
-	gCmd := exec.Command("gluster", args...)
-	log.Println(vars, args, gCmd.Path, gCmd.Args)
-	output, err := gCmd.CombinedOutput()
+	output, err := runner.Run("gluster", args...)
 	if err != nil {
-		log.Println(string(output))
+		return nil, fmt.Errorf("gluster %v failed: %v: %s", strings.Join(vars, " "), err, bytes.TrimSpace(output))
 	}
 
 	xml := strings.NewReader(string(output))
-	json, err := xml2json.Convert(xml)
+	json, err := convertXML(xml)
 	if err != nil {
 		log.Println(err.Error())
 		return json, err
 	}
 	return json, err
 }
+
+// Runner executes a command and returns its combined output
+type Runner interface {
+	Run(name string, args ...string) ([]byte, error)
+}
+
+// LocalRunner executes commands at the local machine
+type LocalRunner struct{}
+
+// Run executes the command at the local machine
+func (LocalRunner) Run(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).CombinedOutput()
+}
+
+// listElements are xml elements always converted to json arrays, xml2json
+// converts them to objects when the list has a single element
+var listElements = map[string]bool{
+	"volume": true,
+	"brick":  true,
+	"node":   true,
+	"peer":   true,
+	"option": true,
+	"limit":  true,
+	"fop":    true,
+}
+
+// convertXML converts gluster xml output to json
+func convertXML(r io.Reader) (*bytes.Buffer, error) {
+	root := &xml2json.Node{}
+	if err := xml2json.NewDecoder(r).Decode(root); err != nil {
+		return nil, err
+	}
+	// gluster prints plain text errors, like a failed connection to glusterd, without xml
+	if len(root.Children) == 0 {
+		return nil, errors.New("no xml element in gluster output")
+	}
+	buf := &bytes.Buffer{}
+	encodeNode(buf, root)
+	return buf, nil
+}
+
+func encodeNode(buf *bytes.Buffer, n *xml2json.Node) {
+	if !n.IsComplex() {
+		// empty elements, like the options of a volume without options, can be objects or lists
+		if strings.TrimSpace(n.Data) == "" {
+			buf.WriteString("null")
+			return
+		}
+		data, _ := json.Marshal(n.Data)
+		buf.Write(data)
+		return
+	}
+
+	buf.WriteString("{")
+	i := 0
+	for label, children := range n.Children {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		i++
+		name, _ := json.Marshal(label)
+		buf.Write(name)
+		buf.WriteString(":")
+
+		if len(children) == 1 && !listElements[label] {
+			encodeNode(buf, children[0])
+			continue
+		}
+		buf.WriteString("[")
+		for j, child := range children {
+			if j > 0 {
+				buf.WriteString(",")
+			}
+			encodeNode(buf, child)
+		}
+		buf.WriteString("]")
+	}
+	buf.WriteString("}")
+}
@@ -0,0 +1,56 @@
+package expogluster
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestConvertXMLLists(t *testing.T) {
+	for _, test := range []struct {
+		name, xml string
+		volumes   int
+	}{
+		{"single element", "<cliOutput><volumes><volume><name>gfs</name></volume></volumes></cliOutput>", 1},
+		{"several elements", "<cliOutput><volumes><volume><name>gfs</name></volume><volume><name>backup</name></volume></volumes></cliOutput>", 2},
+		{"empty element", "<cliOutput><volumes><volume><name>gfs</name><options>\n  </options></volume></volumes></cliOutput>", 1},
+	} {
+		buffer, err := convertXML(strings.NewReader(test.xml))
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		var output struct {
+			CliOutput struct {
+				Volumes struct {
+					// list elements are always json arrays
+					Volume []struct {
+						// other elements are json values when single
+						Name string `json:"name"`
+						// empty elements are null
+						Options struct {
+							Option []struct{} `json:"option"`
+						} `json:"options"`
+					} `json:"volume"`
+				} `json:"volumes"`
+			} `json:"cliOutput"`
+		}
+		if err := json.Unmarshal(buffer.Bytes(), &output); err != nil {
+			t.Fatalf("%v: %v: %s", test.name, err, buffer)
+		}
+		if volumes := output.CliOutput.Volumes.Volume; len(volumes) != test.volumes || volumes[0].Name != "gfs" {
+			t.Errorf("%v: volumes %+v", test.name, volumes)
+		}
+	}
+}
+
+func TestConvertXMLInvalid(t *testing.T) {
+	for _, output := range []string{
+		"Connection failed. Please check if gluster daemon is operational.\n",
+		"",
+		"<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"yes\"?>\n",
+	} {
+		if buffer, err := convertXML(strings.NewReader(output)); err == nil {
+			t.Errorf("no error converting %q: %s", output, buffer)
+		}
+	}
+}
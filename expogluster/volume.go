@@ -2,10 +2,11 @@ package expogluster
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
-	"os/exec"
-	"strconv"
+	"path/filepath"
 	"time"
 
 	// "github.com/google/martian/log"
@@ -13,22 +14,26 @@ import (
 	"github.com/prometheus/common/log"
 )
 
-//ExecMountCheck checks mount point
-func ExecMountCheck() (*bytes.Buffer, error) {
-	stdoutBuffer := &bytes.Buffer{}
-	mountCmd := exec.Command("mount", "-t", "fuse.glusterfs")
-
-	mountCmd.Stdout = stdoutBuffer
-
-	return stdoutBuffer, mountCmd.Run()
-}
-
-//ExecTouchOnVolumes checks mountpoint permission
-func ExecTouchOnVolumes(mountpoint string) (bool, error) {
-	testFileName := fmt.Sprintf("%v/%v_%v", mountpoint, "gluster_mount.test", time.Now())
-	_, createErr := os.Create(testFileName)
-	if createErr != nil {
-		return false, createErr
+// ExecTouchOnVolumes checks mountpoint permission, writing and removing a test file.
+// The content written is read back and compared when readBack is true
+func ExecTouchOnVolumes(mountpoint string, readBack bool) (bool, error) {
+	testFileName := filepath.Join(mountpoint, fmt.Sprintf(".gluster_mount_test_%v_%v", os.Getpid(), time.Now().UnixNano()))
+	content := []byte(testFileName)
+	writeErr := ioutil.WriteFile(testFileName, content, 0600)
+	if writeErr != nil {
+		os.Remove(testFileName)
+		return false, writeErr
+	}
+
+	if readBack {
+		read, readErr := ioutil.ReadFile(testFileName)
+		if readErr == nil && !bytes.Equal(read, content) {
+			readErr = errReadBack
+		}
+		if readErr != nil {
+			os.Remove(testFileName)
+			return false, readErr
+		}
 	}
 	removeErr := os.Remove(testFileName)
 	if removeErr != nil {
@@ -37,10 +42,34 @@ func ExecTouchOnVolumes(mountpoint string) (bool, error) {
 	return true, nil
 }
 
-// ExecVolumeInfo executes "gluster volume info" at the local machine and
+// errReadBack is returned when the content read from the test file differs from the written one
+var errReadBack = errors.New("read back content differs from written content")
+
+// ErrUnsupported is returned by the backends for the queries they can't run, the query
+// is then not collected instead of failing its collector
+var ErrUnsupported = errors.New("not supported by the backend")
+
+// Backend reads the state of gluster
+type Backend interface {
+	VolumeInfo() (VolumeInfoJSON, error)
+	VolumeList() (*VolumeListJSON, error)
+	PeerStatus() (*PeerStatusJSON, error)
+	VolumeProfile(volumeName string) (*VolumeProfileJSON, error)
+	VolumeStatus() (*VolumeStatusJSON, error)
+	VolumeHealInfo(volumeName string) (*VolumeHealInfoJSON, error)
+	VolumeHealSplitBrain(volumeName string) (*VolumeHealInfoJSON, error)
+	VolumeQuotaList(volumeName string) (VolumeQuotaJSON, error)
+}
+
+// CLI is the backend executing gluster command line with --xml output
+type CLI struct {
+	Runner Runner
+}
+
+// VolumeInfo executes "gluster volume info" with the runner of the CLI and
 // returns VolumeInfoJSON struct and error
-func ExecVolumeInfo() (VolumeInfoJSON, error) {
-	bytesBuffer, cmdErr := gluster("volume", "info")
+func (c *CLI) VolumeInfo() (VolumeInfoJSON, error) {
+	bytesBuffer, cmdErr := gluster(c.Runner, "volume", "info")
 	if cmdErr != nil {
 		return VolumeInfoJSON{}, cmdErr
 	}
@@ -53,9 +82,10 @@ func ExecVolumeInfo() (VolumeInfoJSON, error) {
 	return volumeInfo, nil
 }
 
+// VolumeList executes "gluster volume list" with the runner of the CLI and
 // returns VolumeList struct and error
-func ExecVolumeList() (*VolumeListJSON, error) {
-	bytesBuffer, cmdErr := gluster("volume", "list")
+func (c *CLI) VolumeList() (*VolumeListJSON, error) {
+	bytesBuffer, cmdErr := gluster(c.Runner, "volume", "list")
 	if cmdErr != nil {
 		return &VolumeListJSON{}, cmdErr
 	}
@@ -67,10 +97,10 @@ func ExecVolumeList() (*VolumeListJSON, error) {
 	return &volumeList, nil
 }
 
-// ExecPeerStatus executes "gluster peer status" at the local machine and
+// PeerStatus executes "gluster peer status" with the runner of the CLI and
 // returns PeerStatus struct and error
-func ExecPeerStatus() (*PeerStatusJSON, error) {
-	bytesBuffer, cmdErr := gluster("peer", "status")
+func (c *CLI) PeerStatus() (*PeerStatusJSON, error) {
+	bytesBuffer, cmdErr := gluster(c.Runner, "peer", "status")
 	if cmdErr != nil {
 		return &PeerStatusJSON{}, cmdErr
 	}
@@ -83,11 +113,11 @@ func ExecPeerStatus() (*PeerStatusJSON, error) {
 	return &peerStatus, nil
 }
 
-// ExecVolumeProfileGvInfoCumulative executes "gluster volume {volume] profile info cumulative" at the local machine and
+// VolumeProfile executes "gluster volume {volume] profile info cumulative" with the runner of the CLI and
 // returns VolumeInfoJSON struct and error
-func ExecVolumeProfileGvInfoCumulative(volumeName string) (*VolumeProfileJSON, error) {
+func (c *CLI) VolumeProfile(volumeName string) (*VolumeProfileJSON, error) {
 	args := []string{"volume", "profile", volumeName, "info", "cumulative"}
-	bytesBuffer, cmdErr := gluster(args...)
+	bytesBuffer, cmdErr := gluster(c.Runner, args...)
 	if cmdErr != nil {
 		return &VolumeProfileJSON{}, cmdErr
 	}
@@ -99,11 +129,11 @@ func ExecVolumeProfileGvInfoCumulative(volumeName string) (*VolumeProfileJSON, e
 	return &volumeProfile, nil
 }
 
-// ExecVolumeStatusAllDetail executes "gluster volume status all detail" at the local machine
+// VolumeStatus executes "gluster volume status all detail" with the runner of the CLI
 // returns VolumeStatusJSON struct and error
-func ExecVolumeStatusAllDetail() (*VolumeStatusJSON, error) {
+func (c *CLI) VolumeStatus() (*VolumeStatusJSON, error) {
 	args := []string{"volume", "status", "all", "detail"}
-	bytesBuffer, cmdErr := gluster(args...)
+	bytesBuffer, cmdErr := gluster(c.Runner, args...)
 	if cmdErr != nil {
 		return &VolumeStatusJSON{}, cmdErr
 	}
@@ -112,43 +142,44 @@ func ExecVolumeStatusAllDetail() (*VolumeStatusJSON, error) {
 		log.Errorf("Something went wrong while unmarshalling json: %v", err)
 		return &volumeStatus, err
 	}
-
-	log.Infof("%v", volumeStatus.CliOutput.VolStatus.Volumes.Volume[1].Node[0].SizeFree)
 	return &volumeStatus, nil
 }
 
-// ExecVolumeHealInfo executes volume heal info on host system and processes input
-// returns (int) number of unsynced files
-func ExecVolumeHealInfo(volumeName string) (int, error) {
-	entriesOutOfSync := 0
-	bytesBuffer, cmdErr := gluster("volume", "heal", volumeName, "info")
+// VolumeHealInfo executes volume heal info with the runner of the CLI
+// returns VolumeHealInfoJSON struct and error
+func (c *CLI) VolumeHealInfo(volumeName string) (*VolumeHealInfoJSON, error) {
+	bytesBuffer, cmdErr := gluster(c.Runner, "volume", "heal", volumeName, "info")
 	if cmdErr != nil {
-		return -1, cmdErr
+		return &VolumeHealInfoJSON{}, cmdErr
 	}
 	healInfo, err := VolumeHealInfoJSONUnmarshall(bytesBuffer)
 	if err != nil {
 		log.Errorf("Something went wrong while unmarshalling json: %v", err)
-		return -1, err
+		return &healInfo, err
 	}
+	return &healInfo, nil
+}
 
-	for _, brick := range healInfo.HealInfo.Bricks.Brick {
-		var count int
-		var err error
-		count, err = strconv.Atoi(brick.NumberOfEntries)
-		if err != nil {
-			log.Errorf("Something went wrong while parsing brick info: %v", err)
-			return -1, err
-		}
-		entriesOutOfSync += count
+// VolumeHealSplitBrain executes volume heal info split-brain with the runner of the CLI,
+// the output has the format of heal info with the number of entries in split-brain
+func (c *CLI) VolumeHealSplitBrain(volumeName string) (*VolumeHealInfoJSON, error) {
+	bytesBuffer, cmdErr := gluster(c.Runner, "volume", "heal", volumeName, "info", "split-brain")
+	if cmdErr != nil {
+		return &VolumeHealInfoJSON{}, cmdErr
+	}
+	healInfo, err := VolumeHealInfoJSONUnmarshall(bytesBuffer)
+	if err != nil {
+		log.Errorf("Something went wrong while unmarshalling json: %v", err)
+		return &healInfo, err
 	}
-	return entriesOutOfSync, nil
+	return &healInfo, nil
 }
 
-// ExecVolumeQuotaList executes volume quota list on host system and processes input
+// VolumeQuotaList executes volume quota list with the runner of the CLI and processes input
 // returns QuotaList structs and errors
-func ExecVolumeQuotaList(volumeName string) (VolumeQuotaJSON, error) {
+func (c *CLI) VolumeQuotaList(volumeName string) (VolumeQuotaJSON, error) {
 
-	result, cmdErr := gluster("volume", "quota", volumeName, "list")
+	result, cmdErr := gluster(c.Runner, "volume", "quota", volumeName, "list")
 	if cmdErr != nil {
 		return VolumeQuotaJSON{}, cmdErr
 	}
@@ -0,0 +1,328 @@
+package expogluster
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+	"golang.org/x/crypto/bcrypt"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// WebConfig represents the web configuration file, it follows the format used by
+// the Prometheus exporter-toolkit so existing files can be reused
+type WebConfig struct {
+	TLSConfig      TLSServerConfig   `yaml:"tls_server_config"`
+	HTTPConfig     HTTPServerConfig  `yaml:"http_server_config"`
+	BasicAuthUsers map[string]string `yaml:"basic_auth_users"`
+
+	// tlsConfig is built from TLSConfig when the file is loaded, nil when TLS is disabled
+	tlsConfig *tls.Config
+}
+
+// TLSServerConfig holds tls_server_config element of web configuration file
+type TLSServerConfig struct {
+	CertFile                 string   `yaml:"cert_file"`
+	KeyFile                  string   `yaml:"key_file"`
+	ClientAuth               string   `yaml:"client_auth_type"`
+	ClientCAs                string   `yaml:"client_ca_file"`
+	CipherSuites             []string `yaml:"cipher_suites"`
+	MinVersion               string   `yaml:"min_version"`
+	MaxVersion               string   `yaml:"max_version"`
+	PreferServerCipherSuites bool     `yaml:"prefer_server_cipher_suites"`
+}
+
+// HTTPServerConfig holds http_server_config element of web configuration file
+type HTTPServerConfig struct {
+	HTTP2 bool `yaml:"http2"`
+}
+
+var tlsVersions = map[string]uint16{
+	"TLS13": tls.VersionTLS13,
+	"TLS12": tls.VersionTLS12,
+	"TLS11": tls.VersionTLS11,
+	"TLS10": tls.VersionTLS10,
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                           tls.NoClientCert,
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
+// LoadWebConfig reads and validates the web configuration file
+func LoadWebConfig(path string) (*WebConfig, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &WebConfig{
+		TLSConfig:  TLSServerConfig{MinVersion: "TLS12"},
+		HTTPConfig: HTTPServerConfig{HTTP2: true},
+	}
+	if err := yaml.UnmarshalStrict(content, config); err != nil {
+		return nil, err
+	}
+
+	// relative files are resolved against the directory of the config file
+	dir := filepath.Dir(path)
+	config.TLSConfig.CertFile = joinConfigDir(dir, config.TLSConfig.CertFile)
+	config.TLSConfig.KeyFile = joinConfigDir(dir, config.TLSConfig.KeyFile)
+	config.TLSConfig.ClientCAs = joinConfigDir(dir, config.TLSConfig.ClientCAs)
+
+	if config.tlsConfig, err = config.TLSConfig.Build(); err != nil {
+		return nil, err
+	}
+	for user, hash := range config.BasicAuthUsers {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("invalid bcrypt hash for user %q: %v", user, err)
+		}
+	}
+	return config, nil
+}
+
+func joinConfigDir(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// Enabled reports if tls_server_config has certificates configured
+func (c TLSServerConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// Build converts TLSServerConfig to tls.Config, returns nil if tls is disabled
+func (c TLSServerConfig) Build() (*tls.Config, error) {
+	if !c.Enabled() {
+		if c.ClientCAs != "" || c.ClientAuth != "" {
+			return nil, errors.New("client authentication requires cert_file and key_file")
+		}
+		return nil, nil
+	}
+	if c.CertFile == "" {
+		return nil, errors.New("missing cert_file")
+	}
+	if c.KeyFile == "" {
+		return nil, errors.New("missing key_file")
+	}
+
+	// the certificate is reloaded when its files change so certificates can be rotated without restart
+	certificate := &certificateLoader{certFile: c.CertFile, keyFile: c.KeyFile}
+	if _, err := certificate.get(); err != nil {
+		return nil, fmt.Errorf("failed to load X509KeyPair: %v", err)
+	}
+	config := &tls.Config{
+		PreferServerCipherSuites: c.PreferServerCipherSuites,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return certificate.get()
+		},
+	}
+
+	var ok bool
+	if config.MinVersion, ok = tlsVersions[c.MinVersion]; !ok {
+		return nil, fmt.Errorf("unknown TLS version: %v", c.MinVersion)
+	}
+	if c.MaxVersion != "" {
+		if config.MaxVersion, ok = tlsVersions[c.MaxVersion]; !ok {
+			return nil, fmt.Errorf("unknown TLS version: %v", c.MaxVersion)
+		}
+	}
+
+	if len(c.CipherSuites) > 0 {
+		suites := make(map[string]uint16)
+		for _, suite := range tls.CipherSuites() {
+			suites[suite.Name] = suite.ID
+		}
+		for _, name := range c.CipherSuites {
+			id, ok := suites[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown cipher suite: %v", name)
+			}
+			config.CipherSuites = append(config.CipherSuites, id)
+		}
+	}
+
+	if c.ClientCAs != "" {
+		pem, err := ioutil.ReadFile(c.ClientCAs)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %v", c.ClientCAs)
+		}
+		config.ClientCAs = pool
+	}
+
+	if config.ClientAuth, ok = clientAuthTypes[c.ClientAuth]; !ok {
+		return nil, fmt.Errorf("invalid client_auth_type: %v", c.ClientAuth)
+	}
+	if c.ClientCAs != "" && config.ClientAuth == tls.NoClientCert {
+		return nil, errors.New("client_ca_file requires a client_auth_type")
+	}
+	if c.ClientCAs == "" && (config.ClientAuth == tls.VerifyClientCertIfGiven || config.ClientAuth == tls.RequireAndVerifyClientCert) {
+		return nil, errors.New("client_auth_type requires a client_ca_file")
+	}
+
+	return config, nil
+}
+
+// certificateLoader loads the key pair of the server, it is loaded again when the
+// modification time of its files changes
+type certificateLoader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+func (l *certificateLoader) get() (*tls.Certificate, error) {
+	certInfo, err := os.Stat(l.certFile)
+	if err != nil {
+		return l.cached(err)
+	}
+	keyInfo, err := os.Stat(l.keyFile)
+	if err != nil {
+		return l.cached(err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cert != nil && certInfo.ModTime().Equal(l.certMod) && keyInfo.ModTime().Equal(l.keyMod) {
+		return l.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		if l.cert != nil {
+			// the files may be in the middle of their rotation, the previous certificate is served meanwhile
+			log.Errorf("Cannot reload the TLS certificate: %v", err)
+			return l.cert, nil
+		}
+		return nil, err
+	}
+	l.cert, l.certMod, l.keyMod = &cert, certInfo.ModTime(), keyInfo.ModTime()
+	return l.cert, nil
+}
+
+// cached returns the loaded certificate when its files can't be read
+func (l *certificateLoader) cached(err error) (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cert == nil {
+		return nil, err
+	}
+	log.Errorf("Cannot reload the TLS certificate: %v", err)
+	return l.cert, nil
+}
+
+// basicAuthHandler checks users credentials against bcrypt hashes of web configuration file
+type basicAuthHandler struct {
+	users map[string]string
+	next  http.Handler
+	// noAuth checks if the request is served without credentials
+	noAuth func(*http.Request) bool
+
+	mu sync.Mutex
+	// checked holds the last password successfully checked of each user, hashed
+	checked map[string][sha256.Size]byte
+}
+
+// dummyHash is compared when the user is unknown, so the response time doesn't reveal valid users
+var dummyHash = []byte("$2a$10$nTH/CbYaVnXtZxX3CkxP.uJjdUk8CeTS8vlsm2xMxstqpmmMJENem")
+
+func (h *basicAuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.noAuth != nil && h.noAuth(r) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	user, pass, ok := r.BasicAuth()
+	if ok && h.authenticate(user, pass) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("WWW-Authenticate", "Basic")
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	httpError(errors.New("Unauthorized"), http.StatusUnauthorized, w)
+}
+
+func (h *basicAuthHandler) authenticate(user, pass string) bool {
+	hash, exists := h.users[user]
+	if !exists {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(pass))
+		return false
+	}
+
+	// bcrypt is slow on purpose, the last successful check of each user is cached to keep scrapes cheap
+	key := sha256.Sum256([]byte(hash + ":" + pass))
+	h.mu.Lock()
+	checked, cached := h.checked[user]
+	h.mu.Unlock()
+	if cached && subtle.ConstantTimeCompare(checked[:], key[:]) == 1 {
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) != nil {
+		return false
+	}
+	h.mu.Lock()
+	h.checked[user] = key
+	h.mu.Unlock()
+	return true
+}
+
+// ListenAndServe starts the http server, TLS and basic authentication are
+// enabled when the exporter has a web configuration file
+func (e *Exporter) ListenAndServe(server *http.Server) error {
+	if e.WebConfig == "" {
+		log.Info("TLS is disabled.")
+		return server.ListenAndServe()
+	}
+
+	config, err := LoadWebConfig(e.WebConfig)
+	if err != nil {
+		return err
+	}
+
+	if len(config.BasicAuthUsers) > 0 {
+		server.Handler = &basicAuthHandler{
+			users:   config.BasicAuthUsers,
+			next:    server.Handler,
+			noAuth:  e.checkIfPathHasNoAuth,
+			checked: make(map[string][sha256.Size]byte),
+		}
+	}
+
+	tlsConfig := config.tlsConfig
+	if tlsConfig == nil {
+		log.Info("TLS is disabled.")
+		return server.ListenAndServe()
+	}
+
+	log.Info("TLS is enabled.")
+	server.TLSConfig = tlsConfig
+	if !config.HTTPConfig.HTTP2 {
+		server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+	// certificates are served by GetCertificate
+	return server.ListenAndServeTLS("", "")
+}
@@ -0,0 +1,355 @@
+package expogluster
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// writeCertificate writes a self-signed certificate and its key to dir, it returns the certificate
+func writeCertificate(t *testing.T, dir, name string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(filepath.Join(dir, "server.crt"), certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "server.key"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func writeWebConfig(t *testing.T, dir, content string) string {
+	path := filepath.Join(dir, "web.yml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadWebConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeCertificate(t, dir, "server")
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// files are relative to the directory of the configuration file
+	config, err := LoadWebConfig(writeWebConfig(t, dir, `
+tls_server_config:
+  cert_file: server.crt
+  key_file: server.key
+basic_auth_users:
+  admin: `+string(hash)+`
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.TLSConfig.CertFile != filepath.Join(dir, "server.crt") {
+		t.Errorf("cert_file is %q", config.TLSConfig.CertFile)
+	}
+	if config.tlsConfig == nil || config.tlsConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("TLS config is not built with TLS12 as minimum version: %+v", config.tlsConfig)
+	}
+	if !config.HTTPConfig.HTTP2 {
+		t.Error("HTTP2 is disabled by default")
+	}
+
+	config, err = LoadWebConfig(writeWebConfig(t, dir, "basic_auth_users:\n  admin: "+string(hash)+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.tlsConfig != nil {
+		t.Error("TLS is enabled without certificates")
+	}
+
+	for name, content := range map[string]string{
+		"unknown field":            "tls_server_config:\n  cert: server.crt\n",
+		"missing key_file":         "tls_server_config:\n  cert_file: server.crt\n",
+		"missing cert_file":        "tls_server_config:\n  key_file: server.key\n",
+		"missing certificate":      "tls_server_config:\n  cert_file: missing.crt\n  key_file: server.key\n",
+		"unknown TLS version":      "tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  min_version: TLS14\n",
+		"unknown cipher suite":     "tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  cipher_suites: [TLS_NULL]\n",
+		"unknown client auth type": "tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  client_auth_type: Always\n",
+		"client CA without auth":   "tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  client_ca_file: server.crt\n",
+		"verify without client CA": "tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  client_auth_type: RequireAndVerifyClientCert\n",
+		"client auth without TLS":  "tls_server_config:\n  client_auth_type: RequireAnyClientCert\n",
+		"invalid bcrypt hash":      "basic_auth_users:\n  admin: secret\n",
+	} {
+		if _, err := LoadWebConfig(writeWebConfig(t, dir, content)); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+
+	if _, err := LoadWebConfig(filepath.Join(dir, "missing.yml")); err == nil {
+		t.Error("no error for a missing file")
+	}
+}
+
+// serveTLS serves the TLS configuration of the web configuration file, it returns the address
+func serveTLS(t *testing.T, config *WebConfig) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})}
+	go server.Serve(tls.NewListener(listener, config.tlsConfig))
+	return listener.Addr().String(), func() { server.Close() }
+}
+
+func TestTLSVersionsAndCiphers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	der := writeCertificate(t, dir, "server")
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	config, err := LoadWebConfig(writeWebConfig(t, dir, `
+tls_server_config:
+  cert_file: server.crt
+  key_file: server.key
+  max_version: TLS12
+  cipher_suites: [TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, stop := serveTLS(t, config)
+	defer stop()
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := conn.ConnectionState()
+	conn.Close()
+	if state.Version != tls.VersionTLS12 {
+		t.Errorf("negotiated version is %x, expected TLS12", state.Version)
+	}
+	if state.CipherSuite != tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 {
+		t.Errorf("negotiated cipher suite is %v", tls.CipherSuiteName(state.CipherSuite))
+	}
+
+	// the cipher suites of the client must match the configured ones
+	conn, err = tls.Dial("tcp", addr, &tls.Config{
+		RootCAs:      roots,
+		ServerName:   "localhost",
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		MaxVersion:   tls.VersionTLS12,
+	})
+	if err == nil {
+		conn.Close()
+		t.Error("handshake with a cipher suite not configured succeeded")
+	}
+
+	config, err = LoadWebConfig(writeWebConfig(t, dir, `
+tls_server_config:
+  cert_file: server.crt
+  key_file: server.key
+  min_version: TLS13
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, stop13 := serveTLS(t, config)
+	defer stop13()
+
+	conn, err = tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, ServerName: "localhost", MaxVersion: tls.VersionTLS12})
+	if err == nil {
+		conn.Close()
+		t.Error("handshake below the minimum version succeeded")
+	}
+	conn, err = tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version := conn.ConnectionState().Version; version != tls.VersionTLS13 {
+		t.Errorf("negotiated version is %x, expected TLS13", version)
+	}
+	conn.Close()
+}
+
+func TestCertificateReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	first := writeCertificate(t, dir, "first")
+
+	loader := &certificateLoader{certFile: filepath.Join(dir, "server.crt"), keyFile: filepath.Join(dir, "server.key")}
+	cert, err := loader.get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cert.Certificate[0], first) {
+		t.Fatal("the first certificate is not loaded")
+	}
+	if again, _ := loader.get(); again != cert {
+		t.Error("the certificate is loaded again without change")
+	}
+
+	// the modification time is moved forward as the files may be written within the same tick
+	second := writeCertificate(t, dir, "second")
+	future := time.Now().Add(time.Minute)
+	for _, file := range []string{loader.certFile, loader.keyFile} {
+		if err := os.Chtimes(file, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cert, err = loader.get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cert.Certificate[0], second) {
+		t.Error("the certificate is not reloaded after its files changed")
+	}
+
+	// the previous certificate is kept while the files are invalid or missing
+	if err := ioutil.WriteFile(loader.keyFile, []byte("invalid"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if cert, err := loader.get(); err != nil || !bytes.Equal(cert.Certificate[0], second) {
+		t.Errorf("the previous certificate is not kept on invalid files: %v", err)
+	}
+	os.Remove(loader.certFile)
+	if cert, err := loader.get(); err != nil || !bytes.Equal(cert.Certificate[0], second) {
+		t.Errorf("the previous certificate is not kept on missing files: %v", err)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Exporter{
+		CORS: CORSConfig{AllowedOrigins: []string{"https://grafana.example.com"}, AllowedMethods: []string{"GET"}},
+		noAuthRoutes: map[string][]string{
+			"/-/healthy":     {"GET", "HEAD"},
+			"/api/v1/events": {"POST"},
+		},
+	}
+	handler := &basicAuthHandler{
+		users: map[string]string{"admin": string(hash)},
+		next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+		noAuth:  e.checkIfPathHasNoAuth,
+		checked: make(map[string][sha256.Size]byte),
+	}
+
+	for _, test := range []struct {
+		name, method, path, user, pass string
+		status                         int
+	}{
+		{"valid credentials", "GET", "/metrics", "admin", "secret", http.StatusOK},
+		{"valid credentials again", "GET", "/metrics", "admin", "secret", http.StatusOK},
+		{"wrong password", "GET", "/metrics", "admin", "wrong", http.StatusUnauthorized},
+		{"unknown user", "GET", "/metrics", "nobody", "secret", http.StatusUnauthorized},
+		{"no credentials", "GET", "/metrics", "", "", http.StatusUnauthorized},
+		{"health without credentials", "GET", "/-/healthy", "", "", http.StatusOK},
+		{"health with another method", "POST", "/-/healthy", "", "", http.StatusUnauthorized},
+		{"events push without credentials", "POST", "/api/v1/events", "", "", http.StatusOK},
+		{"events read without credentials", "GET", "/api/v1/events", "", "", http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		if test.user != "" {
+			r.SetBasicAuth(test.user, test.pass)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s: status %d, expected %d", test.name, w.Code, test.status)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Basic" {
+			t.Errorf("%s: missing WWW-Authenticate header", test.name)
+		}
+	}
+
+	// the cache holds one entry per user
+	if len(handler.checked) != 1 {
+		t.Errorf("auth cache has %d entries, expected 1", len(handler.checked))
+	}
+
+	// preflight requests of allowed origins are served without credentials
+	r := httptest.NewRequest("OPTIONS", "/api/v1/metrics", nil)
+	r.Header.Set("Origin", "https://grafana.example.com")
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("preflight: status %d", w.Code)
+	}
+	r.Header.Set("Origin", "https://evil.example.com")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("preflight of disallowed origin: status %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Unauthorized") {
+		t.Errorf("unexpected body %q", w.Body.String())
+	}
+}
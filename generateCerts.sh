@@ -0,0 +1,22 @@
+#!/bin/bash
+# generates a self-signed CA, a server and a client certificate to test TLS locally
+set -e
+
+DIR=${1:-certs}
+HOST=${2:-localhost}
+
+mkdir -p "$DIR"
+cd "$DIR"
+
+openssl req -x509 -newkey rsa:2048 -nodes -days 365 -subj "/CN=gluster-exporter-ca" \
+    -keyout ca.key -out ca.crt
+
+openssl req -newkey rsa:2048 -nodes -subj "/CN=$HOST" -keyout server.key -out server.csr
+openssl x509 -req -days 365 -in server.csr -CA ca.crt -CAkey ca.key -CAcreateserial \
+    -extfile <(printf "subjectAltName=DNS:%s,IP:127.0.0.1" "$HOST") -out server.crt
+
+openssl req -newkey rsa:2048 -nodes -subj "/CN=prometheus" -keyout client.key -out client.csr
+openssl x509 -req -days 365 -in client.csr -CA ca.crt -CAkey ca.key -CAcreateserial \
+    -extfile <(printf "extendedKeyUsage=clientAuth") -out client.crt
+
+rm -f server.csr client.csr ca.srl
@@ -5,9 +5,19 @@ go 1.14
 require (
 	github.com/bitly/go-simplejson v0.5.0 // indirect
 	github.com/bmizerany/assert v0.0.0-20160611221934-b7ed37b82869 // indirect
+	github.com/golang/protobuf v1.5.2
+	github.com/golang/snappy v0.0.1
 	github.com/gorilla/handlers v1.4.2
 	github.com/gorilla/mux v1.7.4
 	github.com/prometheus/client_golang v1.7.1
+	github.com/prometheus/client_model v0.2.0
 	github.com/prometheus/common v0.10.0
+	github.com/prometheus/procfs v0.1.3
+	github.com/prometheus/prometheus v1.8.2-0.20200805170718-983ebb4a5133
 	github.com/samuelhug/goxml2json v0.0.0-20160522124512-9f84d7b547d7
+	go.opentelemetry.io/proto/otlp v0.11.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	google.golang.org/grpc v1.42.0
+	google.golang.org/protobuf v1.27.1
+	gopkg.in/yaml.v2 v2.3.0
 )
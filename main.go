@@ -13,6 +13,16 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "collect":
+			os.Exit(collect(os.Args[2:]))
+		case "check":
+			os.Exit(check(os.Args[2:]))
+		case "rules":
+			os.Exit(rules(os.Args[2:]))
+		}
+	}
 
 	promExp := expogluster.NewPromExporter()
 	router := mux.NewRouter()
@@ -24,12 +34,69 @@ func main() {
 		Volumes:  promExp.Volumes,
 		Profile:  promExp.Profile,
 		Quota:    promExp.Quota,
+		Backend:  promExp.Backend,
+
+		SplitBrain: promExp.SplitBrain,
+
+		ClusterMode:      promExp.ClusterMode,
+		LeaderLockFile:   promExp.LeaderLockFile,
+		GlusterdInfoFile: promExp.GlusterdInfoFile,
+		LocalOnly:        promExp.LocalOnly,
+
+		WebConfig: promExp.WebConfig,
+		CORS:      promExp.CORS,
+
+		ReadyMaxAge:     promExp.ReadyMaxAge,
+		GlusterdPidFile: promExp.GlusterdPidFile,
+
+		Forecast: promExp.Forecast,
+		SysPath:  promExp.SysPath,
+		ProcPath: promExp.ProcPath,
+
+		MountInfoPath: promExp.MountInfoPath,
+		Mounts:        promExp.Mounts,
+		MountTimeout:  promExp.MountTimeout,
+		MountReadBack: promExp.MountReadBack,
+		Benchmark:     promExp.Benchmark,
+
+		Logs:   promExp.Logs,
+		Events: promExp.Events,
+
+		OTLP:   promExp.OTLP,
+		Pusher: promExp.Pusher,
+		Sinks:  promExp.Sinks,
+	}
+
+	if probeConfig := os.Getenv("PROM_PROBE_CONFIG"); probeConfig != "" {
+		config, err := expogluster.LoadProbeConfig(probeConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		server.Probe = config
+	}
+
+	if server.Logs != nil {
+		server.Logs.Start()
 	}
 
 	prometheus.MustRegister(server)
+	if server.OTLP != nil {
+		server.OTLP.Start(server)
+	}
+	if server.Pusher != nil {
+		server.Pusher.Start(server)
+	}
+	if server.Sinks != nil {
+		server.Sinks.Start(server)
+	}
+	expogluster.API(server)
 
-	log.Println("Server is listening: http://" + server.Hostname)
-	err := http.ListenAndServe(server.Hostname, handlers.LoggingHandler(os.Stdout, router))
+	log.Println("Server is listening: " + server.Hostname)
+	httpServer := &http.Server{
+		Addr:    server.Hostname,
+		Handler: handlers.LoggingHandler(os.Stdout, router),
+	}
+	err := server.ListenAndServe(httpServer)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	expogluster "github.com/aminueza/docker-gluester-exporter/expogluster"
+)
+
+// rules prints the Prometheus alert and recording rules of the metrics of the exporter
+func rules(args []string) int {
+	flags := flag.NewFlagSet("rules", flag.ContinueOnError)
+	thresholds := expogluster.RuleThresholds{}
+	flags.StringVar(&thresholds.Job, "job", "gluster", "Job scraping the exporter")
+	flags.DurationVar(&thresholds.For, "for", 5*time.Minute, "How long a condition lasts before its alert fires")
+	flags.Float64Var(&thresholds.HealBacklog, "heal-backlog", 100, "Entries pending heal above which a growing backlog fires")
+	flags.DurationVar(&thresholds.HealWindow, "heal-window", 30*time.Minute, "Range over which the growth of the heal backlog is measured")
+	flags.Float64Var(&thresholds.QuotaUsage, "quota-usage", 0.9, "Ratio of a quota hard limit above which its usage fires")
+	flags.Float64Var(&thresholds.DaysUntilFull, "days-until-full", 7, "Days under which a volume or a brick getting full fires")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if err := expogluster.WriteRules(os.Stdout, expogluster.Rules(thresholds)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}